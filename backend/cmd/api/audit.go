@@ -0,0 +1,155 @@
+package main
+
+import (
+	"codemap/backend/internal/audit"
+	"codemap/backend/internal/auth"
+	"codemap/backend/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limits on the number of audit events returned by one request.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 10000
+)
+
+// audit appends event to the audit log on behalf of the caller of r. Failures
+// are logged rather than returned, as the operation has already happened.
+func (app *application) audit(r *http.Request, event models.AuditEvent) {
+	event.IP = clientIP(r)
+	if p := auth.FromContext(r.Context()); p != nil {
+		event.Actor, event.AuthMethod = p.Subject, p.Method
+	}
+	app.appendAudit(event)
+}
+
+// auditSystem appends event to the audit log on behalf of the server itself,
+// for operations that no request started.
+func (app *application) auditSystem(event models.AuditEvent) {
+	event.Actor = "system"
+	app.appendAudit(event)
+}
+
+func (app *application) appendAudit(event models.AuditEvent) {
+	event.ID = models.NewID("aud")
+	event.Time = time.Now().UTC()
+	if err := app.auditLog.Append(&event); err != nil {
+		app.logger.Printf("Could not record audit event %s by %s: %v", event.Action, event.Actor, err)
+	}
+}
+
+// auditLogHandler returns audit events, newest first, filtered by actor,
+// action, project and time range, a page of at most limit events at a time
+// along with the cursor of the next page. With format=jsonl, or an Accept
+// header of application/x-ndjson, the events are exported one JSON object per
+// line instead, all of them unless limit is given; an export cut short by
+// limit ends with a {"truncated": true, "next_cursor": ...} line.
+func (app *application) auditLogHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	jsonl := query.Get("format") == "jsonl" || wantsNDJSON(r)
+
+	filter := models.AuditFilter{
+		Actor:     query.Get("actor"),
+		Action:    query.Get("action"),
+		ProjectID: query.Get("project"),
+		Limit:     defaultAuditLimit,
+	}
+	if jsonl {
+		filter.Limit = 0
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+	for name, dest := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("%s must be an RFC 3339 time", name))
+				return
+			}
+			*dest = t
+		}
+	}
+	cursor := query.Get("cursor")
+
+	if !jsonl {
+		page := auditPage{Events: []models.AuditEvent{}}
+		err := app.auditLog.Scan(filter, cursor, func(e models.AuditEvent, next string) (bool, error) {
+			if len(page.Events) == filter.Limit {
+				page.Truncated = true
+				return false, nil
+			}
+			page.Events = append(page.Events, e)
+			page.NextCursor = next
+			return true, nil
+		})
+		if err != nil {
+			app.auditErrorResponse(w, r, err)
+			return
+		}
+		if !page.Truncated {
+			page.NextCursor = ""
+		}
+		app.writeJSON(w, http.StatusOK, page)
+		return
+	}
+
+	// The export is streamed, so the log is never held in memory
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	enc := json.NewEncoder(w)
+	started, lines, last := false, 0, ""
+	err := app.auditLog.Scan(filter, cursor, func(e models.AuditEvent, next string) (bool, error) {
+		if filter.Limit > 0 && lines == filter.Limit {
+			return false, enc.Encode(map[string]any{"truncated": true, "next_cursor": last})
+		}
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+			started = true
+		}
+		if err := enc.Encode(e); err != nil {
+			return false, err
+		}
+		if lines++; lines%ndjsonFlushEvery == 0 {
+			rc.Flush()
+		}
+		last = next
+		return true, nil
+	})
+	switch {
+	case err != nil && !started:
+		app.auditErrorResponse(w, r, err)
+	case err != nil:
+		app.logError(r, err)
+	case !started:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// auditPage is a page of audit events.
+type auditPage struct {
+	Events     []models.AuditEvent `json:"events"`
+	Truncated  bool                `json:"truncated"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+func (app *application) auditErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, audit.ErrInvalidCursor) {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid cursor: use the next_cursor of the previous page with the same filters")
+		return
+	}
+	app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+}
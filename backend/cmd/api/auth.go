@@ -0,0 +1,155 @@
+package main
+
+import (
+	"codemap/backend/internal/auth"
+	"codemap/backend/internal/database"
+	"codemap/backend/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// authenticate rejects requests without valid credentials and stores the
+// caller's principal in the request context. With authentication disabled
+// every caller is an admin.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.AuthEnabled {
+			principal := &auth.Principal{Subject: "anonymous", Method: "none", Admin: true}
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+			return
+		}
+		principal, err := app.auth.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="codemap"`)
+			app.errorResponse(w, r, http.StatusUnauthorized, "A valid API key or bearer token is required.")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// requireProjectRole is middleware for routes under /projects/{projectID}
+// that need at least role in that project.
+func (app *application) requireProjectRole(role auth.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.authorize(w, r, chi.URLParam(r, "projectID"), role) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// requireAdmin is middleware for server-wide routes that only admins may use.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.FromContext(r.Context()).Admin {
+			app.errorResponse(w, r, http.StatusForbidden, "This operation requires an admin.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorize checks that the caller holds at least role in the project,
+// responding with 403 if not.
+func (app *application) authorize(w http.ResponseWriter, r *http.Request, projectID string, role auth.Role) bool {
+	if auth.FromContext(r.Context()).Can(projectID, role) {
+		return true
+	}
+	app.errorResponse(w, r, http.StatusForbidden, fmt.Sprintf("This operation requires the %s role in project %s.", role, projectID))
+	return false
+}
+
+// whoAmIHandler returns the caller's principal.
+func (app *application) whoAmIHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeJSON(w, http.StatusOK, auth.FromContext(r.Context()))
+}
+
+// listAPIKeysHandler returns every API key, without secrets.
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.db.ListAPIKeys(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.writeJSON(w, http.StatusOK, keys)
+}
+
+// createAPIKeyHandler issues an API key. The token is only returned here; the
+// server keeps just a hash of its secret.
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name  string            `json:"name"`
+		Admin bool              `json:"admin"`
+		Roles map[string]string `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if payload.Name == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "name is required")
+		return
+	}
+	for project, role := range payload.Roles {
+		if project != auth.AllProjects {
+			if _, err := readProjectID(project); err != nil {
+				app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		if !auth.Role(role).Valid() {
+			app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Unknown role %q: use viewer, analyst or admin", role))
+			return
+		}
+	}
+
+	id, token, secretHash, err := auth.GenerateKey()
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	key := &models.APIKey{
+		ID:         id,
+		Name:       payload.Name,
+		SecretHash: secretHash,
+		Admin:      payload.Admin,
+		Roles:      payload.Roles,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := app.db.CreateAPIKey(r.Context(), key); err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.audit(r, models.AuditEvent{
+		Action:  models.AuditAPIKeyCreate,
+		Target:  key.ID,
+		Details: map[string]any{"name": key.Name, "admin": key.Admin, "roles": key.Roles},
+	})
+	app.writeJSON(w, http.StatusCreated, map[string]any{
+		"key":   key,
+		"token": token,
+	})
+}
+
+// deleteAPIKeyHandler revokes an API key.
+func (app *application) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID := chi.URLParam(r, "keyID")
+	err := app.db.DeleteAPIKey(r.Context(), keyID)
+	if errors.Is(err, database.ErrNotFound) {
+		app.errorResponse(w, r, http.StatusNotFound, fmt.Sprintf("API key %s not found", keyID))
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.audit(r, models.AuditEvent{Action: models.AuditAPIKeyDelete, Target: keyID})
+	w.WriteHeader(http.StatusNoContent)
+}
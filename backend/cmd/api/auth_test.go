@@ -0,0 +1,103 @@
+package main
+
+import (
+	"codemap/backend/internal/auth"
+	"codemap/backend/internal/config"
+	"codemap/backend/internal/models"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// apiKeys is an auth.KeyStore backed by a map.
+type apiKeys map[string]*models.APIKey
+
+func (k apiKeys) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	if key, ok := k[id]; ok {
+		return key, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func TestProjectRoles(t *testing.T) {
+	keys := apiKeys{}
+	tokens := map[string]string{}
+	for name, key := range map[string]models.APIKey{
+		"viewer":      {Roles: map[string]string{"proj": "viewer"}},
+		"analyst":     {Roles: map[string]string{"proj": "analyst"}},
+		"admin":       {Roles: map[string]string{"proj": "admin"}},
+		"all-analyst": {Roles: map[string]string{auth.AllProjects: "analyst"}},
+		"other":       {Roles: map[string]string{"other": "admin"}},
+		"server":      {Admin: true},
+	} {
+		id, token, secretHash, err := auth.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		key.ID, key.SecretHash = id, secretHash
+		keys[id] = &key
+		tokens[name] = token
+	}
+
+	newRouter := func(authEnabled bool) http.Handler {
+		app := &application{
+			config: &config.AppConfig{AuthEnabled: authEnabled},
+			auth:   auth.NewAuthenticator(keys, nil, ""),
+		}
+		ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+		r := chi.NewRouter()
+		r.Use(app.authenticate)
+		r.Route("/projects/{projectID}", func(r chi.Router) {
+			r.With(app.requireProjectRole(auth.RoleViewer)).Get("/graph", ok)
+			r.With(app.requireProjectRole(auth.RoleAnalyst)).Post("/analyze", ok)
+			r.With(app.requireProjectRole(auth.RoleAdmin)).Put("/options", ok)
+		})
+		r.With(app.requireAdmin).Post("/gc", ok)
+		return r
+	}
+	enabled, disabled := newRouter(true), newRouter(false)
+
+	tests := []struct {
+		caller string // empty for no credentials
+		method string
+		path   string
+		want   int
+	}{
+		{"", http.MethodGet, "/projects/proj/graph", http.StatusUnauthorized},
+		{"viewer", http.MethodGet, "/projects/proj/graph", http.StatusNoContent},
+		{"viewer", http.MethodPost, "/projects/proj/analyze", http.StatusForbidden},
+		{"viewer", http.MethodPut, "/projects/proj/options", http.StatusForbidden},
+		{"analyst", http.MethodGet, "/projects/proj/graph", http.StatusNoContent},
+		{"analyst", http.MethodPost, "/projects/proj/analyze", http.StatusNoContent},
+		{"analyst", http.MethodPut, "/projects/proj/options", http.StatusForbidden},
+		{"admin", http.MethodPut, "/projects/proj/options", http.StatusNoContent},
+		{"admin", http.MethodPost, "/gc", http.StatusForbidden},
+		{"all-analyst", http.MethodPost, "/projects/any/analyze", http.StatusNoContent},
+		{"all-analyst", http.MethodPut, "/projects/any/options", http.StatusForbidden},
+		{"other", http.MethodGet, "/projects/proj/graph", http.StatusForbidden},
+		{"server", http.MethodPut, "/projects/proj/options", http.StatusNoContent},
+		{"server", http.MethodPost, "/gc", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.caller != "" {
+			r.Header.Set("Authorization", "Bearer "+tokens[tt.caller])
+		}
+		w := httptest.NewRecorder()
+		enabled.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %s as %q = %d, want %d", tt.method, tt.path, tt.caller, w.Code, tt.want)
+		}
+
+		// With authentication disabled every caller is an admin
+		w = httptest.NewRecorder()
+		disabled.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s %s with auth disabled = %d, want %d", tt.method, tt.path, w.Code, http.StatusNoContent)
+		}
+	}
+}
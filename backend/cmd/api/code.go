@@ -0,0 +1,361 @@
+package main
+
+import (
+	"codemap/backend/internal/database"
+	"codemap/backend/internal/models"
+	"codemap/backend/internal/unidiff"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Page sizes of the navigation endpoints.
+const (
+	defaultNavigationPageSize = 100
+	maxNavigationPageSize     = 1000
+)
+
+// Depths of impact analyses.
+const (
+	defaultImpactDepth = 5
+	maxImpactDepth     = 10
+)
+
+// maxDiffBytes caps the size of change sets sent for impact analysis.
+const maxDiffBytes = 10 << 20
+
+// Bounds of path searches: the number of paths and their length.
+const (
+	defaultPathCount     = 10
+	maxPathCount         = 100
+	defaultPathMaxLength = 10
+	maxPathMaxLength     = 15
+)
+
+// The navigation endpoints answer everyday questions about a project's code
+// without Cypher. Files are identified by their path and functions and
+// classes by their ID, which are URL-escaped in the route as they contain
+// slashes.
+
+// listFilesHandler returns a page of a project's files, optionally only
+// those whose path starts with ?path=.
+func (app *application) listFilesHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	prefix := r.URL.Query().Get("path")
+	args := map[string]any{"path": prefix}
+	page, ok := app.readNavigationPage(w, r, args)
+	if !ok {
+		return
+	}
+	files, more, err := app.db.ListFiles(r.Context(), projectID, prefix, page)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.writePage(w, r, files, len(files), more, page, args)
+}
+
+// fileImportsHandler returns a page of the files a file imports.
+func (app *application) fileImportsHandler(w http.ResponseWriter, r *http.Request) {
+	app.relatedFilesHandler(w, r, app.db.FileImports)
+}
+
+// fileImportersHandler returns a page of the files that import a file.
+func (app *application) fileImportersHandler(w http.ResponseWriter, r *http.Request) {
+	app.relatedFilesHandler(w, r, app.db.FileImporters)
+}
+
+func (app *application) relatedFilesHandler(w http.ResponseWriter, r *http.Request, list func(ctx context.Context, projectID, path string, page database.QueryPage) ([]models.FileNode, bool, error)) {
+	path, ok := app.readSymbolID(w, r, "fileID")
+	if !ok {
+		return
+	}
+	page, ok := app.readNavigationPage(w, r, nil)
+	if !ok {
+		return
+	}
+	files, more, err := list(r.Context(), chi.URLParam(r, "projectID"), path, page)
+	if err != nil {
+		app.symbolLookupError(w, r, "File", path, err)
+		return
+	}
+	app.writePage(w, r, files, len(files), more, page, nil)
+}
+
+// getFunctionHandler returns a function with its parameters.
+func (app *application) getFunctionHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.readSymbolID(w, r, "functionID")
+	if !ok {
+		return
+	}
+	fn, err := app.db.GetFunction(r.Context(), chi.URLParam(r, "projectID"), id)
+	if err != nil {
+		app.symbolLookupError(w, r, "Function", id, err)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, fn)
+}
+
+// functionCallersHandler returns a page of the functions that call a function.
+func (app *application) functionCallersHandler(w http.ResponseWriter, r *http.Request) {
+	app.relatedFunctionsHandler(w, r, "Function", "functionID", app.db.FunctionCallers)
+}
+
+// functionCalleesHandler returns a page of the functions a function calls.
+func (app *application) functionCalleesHandler(w http.ResponseWriter, r *http.Request) {
+	app.relatedFunctionsHandler(w, r, "Function", "functionID", app.db.FunctionCallees)
+}
+
+// classMethodsHandler returns a page of the methods of a class.
+func (app *application) classMethodsHandler(w http.ResponseWriter, r *http.Request) {
+	app.relatedFunctionsHandler(w, r, "Class", "classID", app.db.ClassMethods)
+}
+
+func (app *application) relatedFunctionsHandler(w http.ResponseWriter, r *http.Request, kind, param string, list func(ctx context.Context, projectID, id string, page database.QueryPage) ([]models.FunctionNode, bool, error)) {
+	id, ok := app.readSymbolID(w, r, param)
+	if !ok {
+		return
+	}
+	page, ok := app.readNavigationPage(w, r, nil)
+	if !ok {
+		return
+	}
+	functions, more, err := list(r.Context(), chi.URLParam(r, "projectID"), id, page)
+	if err != nil {
+		app.symbolLookupError(w, r, kind, id, err)
+		return
+	}
+	app.writePage(w, r, functions, len(functions), more, page, nil)
+}
+
+// impactHandler returns what transitively depends on a function, class or
+// file (direction=up, the default) or what it depends on (direction=down),
+// up to ?depth= steps away. The symbol's kind is looked up unless ?kind=
+// names it.
+func (app *application) impactHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	symbol, ok := app.readSymbolID(w, r, "symbol")
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	direction := query.Get("direction")
+	if direction == "" {
+		direction = models.ImpactUp
+	}
+	if direction != models.ImpactUp && direction != models.ImpactDown {
+		app.errorResponse(w, r, http.StatusBadRequest, "direction must be up or down")
+		return
+	}
+	depth, ok := app.readBoundedInt(w, r, "depth", defaultImpactDepth, maxImpactDepth)
+	if !ok {
+		return
+	}
+	kind := query.Get("kind")
+	switch kind {
+	case "", models.SymbolFunction, models.SymbolClass, models.SymbolFile:
+	default:
+		app.errorResponse(w, r, http.StatusBadRequest, "kind must be function, class or file")
+		return
+	}
+
+	kind, err := app.db.SymbolKind(r.Context(), projectID, symbol, kind)
+	if err != nil {
+		app.symbolLookupError(w, r, "Symbol", symbol, err)
+		return
+	}
+	impact, err := app.db.Impact(r.Context(), projectID, kind, symbol, direction, depth)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.writeJSON(w, http.StatusOK, impact)
+}
+
+// impactDiffHandler maps a change set to the functions and classes it
+// touches and returns their transitive callers, the entry points among both
+// and the tests that may cover them. The change set is a unified diff, sent
+// as a text/x-diff or text/x-patch body or as {"diff": ...}, or a list of
+// {"path", "start", "end"} line ranges. Lines are numbered as in the version
+// of the code that was analyzed.
+func (app *application) impactDiffHandler(w http.ResponseWriter, r *http.Request) {
+	depth, ok := app.readBoundedInt(w, r, "depth", defaultImpactDepth, maxImpactDepth)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxDiffBytes)
+
+	var changes []unidiff.FileChange
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/x-diff", "text/x-patch", "text/plain":
+		changes, err = unidiff.Parse(r.Body)
+	default:
+		var payload struct {
+			Diff    string `json:"diff"`
+			Changes []struct {
+				Path  string `json:"path"`
+				Start int    `json:"start"`
+				End   int    `json:"end"`
+			} `json:"changes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			app.errorResponse(w, r, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		if payload.Diff != "" {
+			changes, err = unidiff.Parse(strings.NewReader(payload.Diff))
+		}
+		for _, change := range payload.Changes {
+			if change.End == 0 {
+				change.End = change.Start
+			}
+			if change.Path == "" || change.Start < 1 || change.End < change.Start {
+				app.errorResponse(w, r, http.StatusBadRequest, "Each change needs a path and a line range with 1 <= start <= end")
+				return
+			}
+			changes = append(changes, unidiff.FileChange{
+				OldPath: change.Path,
+				NewPath: change.Path,
+				Ranges:  []unidiff.LineRange{{Start: change.Start, End: change.End}},
+			})
+		}
+	}
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid diff: %v", err))
+		return
+	}
+	if len(changes) == 0 {
+		app.errorResponse(w, r, http.StatusBadRequest, "The change set is empty")
+		return
+	}
+
+	impact, err := app.db.DiffImpact(r.Context(), chi.URLParam(r, "projectID"), changes, depth)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.writeJSON(w, http.StatusOK, impact)
+}
+
+// pathsHandler returns the shortest path and up to ?max= simple paths from
+// one function, class or file to another, given by ?from= and ?to=. Paths
+// follow the relationships listed in ?via=, CALLS and IMPORTS by default,
+// and are at most ?max_length= steps long.
+func (app *application) pathsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	query := r.URL.Query()
+	from, to := query.Get("from"), query.Get("to")
+	if from == "" || to == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "from and to are required")
+		return
+	}
+	if from == to {
+		app.errorResponse(w, r, http.StatusBadRequest, "from and to must differ")
+		return
+	}
+	via := []string{"CALLS", "IMPORTS"}
+	if value := query.Get("via"); value != "" {
+		via = nil
+		for _, rel := range strings.Split(value, ",") {
+			rel = strings.ToUpper(strings.TrimSpace(rel))
+			if !slices.Contains(database.PathRelationships, rel) {
+				app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("via must list relationships among %s", strings.Join(database.PathRelationships, ", ")))
+				return
+			}
+			if !slices.Contains(via, rel) {
+				via = append(via, rel)
+			}
+		}
+	}
+	count, ok := app.readBoundedInt(w, r, "max", defaultPathCount, maxPathCount)
+	if !ok {
+		return
+	}
+	maxLength, ok := app.readBoundedInt(w, r, "max_length", defaultPathMaxLength, maxPathMaxLength)
+	if !ok {
+		return
+	}
+
+	fromKind, err := app.db.SymbolKind(r.Context(), projectID, from, "")
+	if err != nil {
+		app.symbolLookupError(w, r, "Symbol", from, err)
+		return
+	}
+	toKind, err := app.db.SymbolKind(r.Context(), projectID, to, "")
+	if err != nil {
+		app.symbolLookupError(w, r, "Symbol", to, err)
+		return
+	}
+	limits := app.queryLimits()
+	paths, err := app.db.Paths(r.Context(), projectID, fromKind, from, toKind, to, via, maxLength, count, limits.Timeout)
+	if err != nil {
+		app.queryErrorResponse(w, r, err, limits)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, paths)
+}
+
+// readBoundedInt reads an integer query parameter between 1 and limit,
+// which defaults to fallback.
+func (app *application) readBoundedInt(w http.ResponseWriter, r *http.Request, name string, fallback, limit int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > limit {
+		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("%s must be between 1 and %d", name, limit))
+		return 0, false
+	}
+	return n, true
+}
+
+// readSymbolID returns the unescaped value of a route parameter naming a
+// file, function or class.
+func (app *application) readSymbolID(w http.ResponseWriter, r *http.Request, param string) (string, bool) {
+	id, err := url.PathUnescape(chi.URLParam(r, param))
+	if err != nil || id == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid %s", param))
+		return "", false
+	}
+	return id, true
+}
+
+// readNavigationPage reads the page of a navigation request. Its cursor is
+// bound to the request path and the arguments that select the listed nodes.
+func (app *application) readNavigationPage(w http.ResponseWriter, r *http.Request, args map[string]any) (database.QueryPage, bool) {
+	page, ok := app.readQueryPage(w, r, r.URL.Path, args, maxNavigationPageSize)
+	if ok && page.Size == 0 {
+		page.Size = defaultNavigationPageSize
+	}
+	return page, ok
+}
+
+// writePage responds with a page of count items and, if more follow, the
+// cursor of the next page.
+func (app *application) writePage(w http.ResponseWriter, r *http.Request, items any, count int, more bool, page database.QueryPage, args map[string]any) {
+	data := map[string]any{"items": items, "offset": page.Offset, "has_more": more}
+	if more {
+		data["next_cursor"] = encodeCursor(page.Offset+count, r.URL.Path, args)
+	}
+	app.writeJSON(w, http.StatusOK, data)
+}
+
+func (app *application) symbolLookupError(w http.ResponseWriter, r *http.Request, kind, id string, err error) {
+	if errors.Is(err, database.ErrNotFound) {
+		app.errorResponse(w, r, http.StatusNotFound, fmt.Sprintf("%s %s not found", kind, id))
+		return
+	}
+	app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"codemap/backend/internal/gc"
+	"codemap/backend/internal/models"
+	"net/http"
+	"strings"
+)
+
+// gcReportHandler reports what the retention policy would delete, without deleting anything.
+func (app *application) gcReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := app.gc.Run(r.Context(), true)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.writeJSON(w, http.StatusOK, report)
+}
+
+// gcRunHandler enforces the retention policy now and reports what was deleted.
+func (app *application) gcRunHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := app.gc.Run(r.Context(), false)
+	app.audit(r, gcAuditEvent(report, err))
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.writeJSON(w, http.StatusOK, report)
+}
+
+// gcFinished records a background collection in the audit log.
+func (app *application) gcFinished(report *gc.Report, err error) {
+	app.auditSystem(gcAuditEvent(report, err))
+}
+
+// gcAuditEvent describes a collection, including the failures of one that
+// deleted only part of what it meant to.
+func gcAuditEvent(report *gc.Report, err error) models.AuditEvent {
+	event := models.AuditEvent{Action: models.AuditGarbageCollect}
+	if report != nil {
+		snapshots := make([]string, len(report.Snapshots))
+		for i, snap := range report.Snapshots {
+			snapshots[i] = snap.ID
+		}
+		event.Details = map[string]any{
+			"snapshots":   snapshots,
+			"objects":     len(report.Objects),
+			"freed_bytes": report.FreedBytes,
+			"temp_dirs":   len(report.TempDirs),
+		}
+		event.Error = strings.Join(report.Errors, "; ")
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	return event
+}
@@ -1,15 +1,26 @@
 package main
 
 import (
-	"archive/zip"
-	"codemap/backend/internal/analysis"
+	"cmp"
+	"codemap/backend/internal/archive"
+	"codemap/backend/internal/auth"
+	"codemap/backend/internal/database"
+	"codemap/backend/internal/gitcache"
+	"codemap/backend/internal/jobs"
+	"codemap/backend/internal/models"
+	"codemap/backend/internal/ratelimit"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -24,19 +35,30 @@ func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Reques
 	app.writeJSON(w, http.StatusOK, data)
 }
 
-// uploadHandler handles the file upload and analysis process.
+// uploadHandler handles the file upload and analysis process. The multipart
+// body is streamed straight to disk, so archives are never held in memory.
+//
+// The caller's access to the project is checked before any of the file is
+// read, so the project is taken from ?project=, the X-Codemap-Project header
+// or a "project" form field that precedes the "codebase" file.
 func (app *application) uploadHandler(w http.ResponseWriter, r *http.Request) {
-	// Increase limit to 500MB for large codebases
-	if err := r.ParseMultipartForm(500 << 20); err != nil { // 500MB max
-		app.errorResponse(w, r, http.StatusBadRequest, "Could not parse multipart form.")
-		return
+	// Large archives take longer to receive than the server's default timeouts
+	extendDeadlines(w)
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.UploadMaxBytes)
+
+	var projectID string
+	if raw := cmp.Or(r.URL.Query().Get("project"), r.Header.Get(projectHeader)); raw != "" {
+		var ok bool
+		if projectID, ok = app.authorizeUploadProject(w, r, raw); !ok {
+			return
+		}
 	}
-	file, handler, err := r.FormFile("codebase")
+
+	mr, err := r.MultipartReader()
 	if err != nil {
-		app.errorResponse(w, r, http.StatusBadRequest, "Could not retrieve the file from form.")
+		app.errorResponse(w, r, http.StatusBadRequest, "Could not parse multipart form.")
 		return
 	}
-	defer file.Close()
 	// Use configured path for temporary uploads
 	tempDir, err := os.MkdirTemp(app.config.TempUploads, "codemap-upload-*")
 	if err != nil {
@@ -44,65 +66,235 @@ func (app *application) uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer os.RemoveAll(tempDir)
-	zipPath := filepath.Join(tempDir, handler.Filename)
-	tempFile, err := os.Create(zipPath)
-	if err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, "Could not create temp file.")
+
+	// The archive bytes charged to the client are refunded unless the archive
+	// is accepted for analysis
+	client := clientID(r)
+	var charged int64
+	accepted := false
+	defer func() {
+		if !accepted {
+			app.quotas.RefundArchive(client, charged)
+		}
+	}()
+
+	var filename, archivePath, digest string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			app.uploadErrorResponse(w, r, err)
+			return
+		}
+		switch part.FormName() {
+		case "project":
+			if archivePath != "" {
+				app.errorResponse(w, r, http.StatusBadRequest, "The project field must precede the codebase file.")
+				return
+			}
+			value, err := io.ReadAll(io.LimitReader(part, 256))
+			if err != nil {
+				app.uploadErrorResponse(w, r, err)
+				return
+			}
+			if projectID != "" {
+				if string(value) != projectID {
+					app.errorResponse(w, r, http.StatusBadRequest, "The project field does not match the requested project.")
+					return
+				}
+				break
+			}
+			var ok bool
+			if projectID, ok = app.authorizeUploadProject(w, r, string(value)); !ok {
+				return
+			}
+		case "codebase":
+			if archivePath != "" {
+				app.errorResponse(w, r, http.StatusBadRequest, "Upload a single codebase file.")
+				return
+			}
+			if projectID == "" {
+				var ok bool
+				if projectID, ok = app.authorizeUploadProject(w, r, ""); !ok {
+					return
+				}
+			}
+			// Charge the body against the daily archive quota up front. A body
+			// of unknown length is charged what is left of the quota, up to the
+			// upload limit, and may not read past it; what it does not use is
+			// refunded once it has been received.
+			reserved, src := r.ContentLength, io.Reader(part)
+			if reserved < 0 {
+				reserved = min(app.config.UploadMaxBytes, app.quotas.RemainingArchive(client))
+				if reserved < app.config.UploadMaxBytes {
+					src = http.MaxBytesReader(w, part, reserved)
+				}
+			}
+			if err := app.quotas.ReserveArchive(client, reserved); err != nil {
+				app.quotaErrorResponse(w, r, err)
+				return
+			}
+			charged = reserved
+			filename = part.FileName()
+			if filename == "" {
+				filename = "codebase"
+			}
+			archivePath = filepath.Join(tempDir, filename)
+			// Stream the file to a local temp file, hashing it on the way
+			if digest, err = saveFile(archivePath, src); err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) && tooLarge.Limit < app.config.UploadMaxBytes {
+					app.quotaErrorResponse(w, r, &ratelimit.ExceededError{
+						Quota:      "archive_bytes",
+						RetryAfter: time.Until(app.quotas.Usage(client).ArchiveBytesReset),
+					})
+					return
+				}
+				app.uploadErrorResponse(w, r, err)
+				return
+			}
+			if r.ContentLength < 0 {
+				if info, err := os.Stat(archivePath); err == nil {
+					app.quotas.RefundArchive(client, reserved-info.Size())
+					charged = info.Size()
+				}
+			}
+		}
+		part.Close()
+	}
+	if archivePath == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "Could not retrieve the file from form.")
 		return
 	}
-	// Stream file to local temp file first (better for large files)
-	_, err = io.Copy(tempFile, file)
-	tempFile.Close() // Close file before reading again
+	accepted = app.analyzeArchive(w, r, projectID, archivePath, filename, digest)
+}
+
+// projectHeader names the project of an upload, as ?project= does.
+const projectHeader = "X-Codemap-Project"
+
+// authorizeUploadProject validates the project ID given with an upload, where
+// an empty one means the default project, and checks that the caller may
+// analyze into it.
+func (app *application) authorizeUploadProject(w http.ResponseWriter, r *http.Request, raw string) (string, bool) {
+	projectID, err := readProjectID(raw)
 	if err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, "Could not save uploaded file.")
-		return
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return projectID, app.authorize(w, r, projectID, auth.RoleAnalyst)
+}
+
+// analyzeArchive stores an uploaded archive in S3 under its SHA-256 digest,
+// extracts it and analyzes it into the project, writing the response. If the
+// project's latest snapshot was made from the same archive by the same analyzer
+// version, that snapshot is returned instead. It reports whether the analysis
+// succeeded.
+func (app *application) analyzeArchive(w http.ResponseWriter, r *http.Request, projectID, archivePath, filename, digest string) bool {
+	// Identify the archive format from its magic bytes
+	format, err := archive.Detect(archivePath)
+	if errors.Is(err, archive.ErrUnsupportedFormat) {
+		app.errorResponse(w, r, http.StatusUnsupportedMediaType, "Unsupported archive format. Upload a zip, tar, tar.gz, tar.bz2, tar.zst or git bundle.")
+		return false
+	}
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, "Could not read uploaded file.")
+		return false
 	}
+	details := map[string]any{"sha256": digest, "format": format}
+	if info, err := os.Stat(archivePath); err == nil {
+		details["size"] = info.Size()
+	}
+	app.audit(r, models.AuditEvent{Action: models.AuditUpload, ProjectID: projectID, Target: filename, Details: details})
 
-	// Read file for S3 upload (now from disk, not memory)
-	zipData, err := os.ReadFile(zipPath)
+	// Skip the pipeline if this archive is what the project's graph already holds
+	existing, err := app.existingSnapshot(r.Context(), projectID, digest)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if existing != nil {
+		app.logger.Printf("Upload %s (sha256 %s) matches snapshot %s, skipping analysis", filename, digest, existing.ID)
+		app.writeJSON(w, http.StatusOK, map[string]string{
+			"message":      "This archive has already been analyzed. Returning the existing snapshot.",
+			"s3_key":       existing.S3Key,
+			"format":       string(format),
+			"project_id":   projectID,
+			"job_id":       existing.JobID,
+			"snapshot_id":  existing.ID,
+			"sha256":       digest,
+			"deduplicated": "true",
+		})
+		return true
+	}
+
+	// Stream the archive to S3
+	archiveFile, err := os.Open(archivePath)
 	if err != nil {
 		app.errorResponse(w, r, http.StatusInternalServerError, "Could not read temp file.")
-		return
+		return false
 	}
-
-	// Upload to S3
-	s3Key, err := app.s3.UploadZipFile(zipData, handler.Filename)
+	s3Key, err := app.s3.UploadArchive(archiveFile, digest, format.ContentType())
+	archiveFile.Close()
 	if err != nil {
 		app.errorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to upload to S3: %v", err))
-		return
+		return false
 	}
+	app.logger.Printf("📤 Uploaded %s (%s) to S3: %s", filename, format, s3Key)
 
-	app.logger.Printf("📤 Uploaded %s to S3: %s (Size: %d bytes)", handler.Filename, s3Key, len(zipData))
-	// Unzip the file into a subdirectory
-	unzipDest := filepath.Join(tempDir, "unzipped")
-	if err := unzip(zipPath, unzipDest); err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to unzip file: %v", err))
-		return
-	}
-	// Pass the configured tools path and the unzipped directory to the runner
-	analysisResult, err := analysis.Run(app.config.ToolsPath, unzipDest)
+	// Extract the archive into a temp directory
+	tempDir, err := os.MkdirTemp(app.config.TempUploads, "codemap-extract-*")
 	if err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
-		return
+		app.errorResponse(w, r, http.StatusInternalServerError, "Could not create temp directory.")
+		return false
 	}
-	// Import the result into Neo4j
+	defer os.RemoveAll(tempDir)
+	unzipDest := filepath.Join(tempDir, "unzipped")
+	if !app.extractArchive(w, r, format, archivePath, unzipDest) {
+		return false
+	}
+	// Bundles carry history, so record the commit they were created from
+	var commit *models.CommitInfo
+	if format == archive.GitBundle {
+		if commit, err = gitcache.ReadCommit(r.Context(), unzipDest); err != nil {
+			app.logger.Printf("Could not read commit of git bundle %s: %v", filename, err)
+		}
+	}
+	// Analyze the unzipped directory and import the result into Neo4j
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute) // 5-minute timeout for import
 	defer cancel()
-	if err := app.db.ImportAnalysis(ctx, analysisResult); err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to import data to Neo4j: %v", err))
-		return
+	result, err := app.analyzeNow(ctx, analysisJob{
+		ProjectID: projectID,
+		Client:    clientID(r),
+		Source:    "upload",
+		SourceDir: unzipDest,
+		S3Key:     s3Key,
+		Commit:    commit,
+		Archive:   digest,
+	})
+	if err != nil {
+		app.analysisErrorResponse(w, r, err)
+		return false
 	}
 	// Send a success response
 	app.writeJSON(w, http.StatusAccepted, map[string]string{
-		"message": "Upload successful. Codebase has been analyzed and imported.",
-		"s3_key":  s3Key,
+		"message":     "Upload successful. Codebase has been analyzed and imported.",
+		"s3_key":      s3Key,
+		"format":      string(format),
+		"project_id":  projectID,
+		"job_id":      result.Snapshot.JobID,
+		"snapshot_id": result.Snapshot.ID,
+		"sha256":      digest,
 	})
+	return true
 }
 
 // githubHandler handles GitHub repository URL submission for analysis.
 func (app *application) githubHandler(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
 		RepoURL string `json:"repo_url"`
+		Project string `json:"project"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -115,49 +307,50 @@ func (app *application) githubHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate GitHub URL format
-	if !strings.Contains(payload.RepoURL, "github.com") {
+	if err := gitcache.ValidateRemote(payload.RepoURL); err != nil {
 		app.errorResponse(w, r, http.StatusBadRequest, "Please provide a valid GitHub repository URL")
 		return
 	}
 
-	// Upload GitHub repo to S3 and get the local temp directory path
-	s3Key, tempDir, err := app.s3.UploadGitRepo(payload.RepoURL)
+	projectID, err := readProjectID(payload.Project)
 	if err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to clone and upload repository: %v", err))
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	// Clean up temp directory after we're done
-	defer os.RemoveAll(tempDir)
-
-	app.logger.Printf("📤 Uploaded GitHub repo to S3: %s", s3Key)
-
-	// Run analysis on the cloned repository
-	analysisResult, err := analysis.Run(app.config.ToolsPath, tempDir)
-	if err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Analysis failed: %v", err))
+	if !app.authorize(w, r, projectID, auth.RoleAnalyst) {
 		return
 	}
 
-	// Import analysis results into Neo4j
-	if err := app.db.ImportAnalysis(r.Context(), analysisResult); err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to import analysis to Neo4j: %v", err))
+	app.audit(r, models.AuditEvent{Action: models.AuditClone, ProjectID: projectID, Target: payload.RepoURL})
+
+	// Clone the repository, upload it to S3, analyze it and import the results into Neo4j
+	result, err := app.analyzeNow(r.Context(), analysisJob{
+		ProjectID: projectID,
+		Client:    clientID(r),
+		Source:    "github",
+		RepoURL:   payload.RepoURL,
+	})
+	if err != nil {
+		app.analysisErrorResponse(w, r, err)
 		return
 	}
 
 	app.writeJSON(w, http.StatusAccepted, map[string]string{
 		"message":        "GitHub repository analyzed and imported to Neo4j successfully.",
-		"s3_key":         s3Key,
+		"s3_key":         result.Snapshot.S3Key,
 		"repo_url":       payload.RepoURL,
-		"files_analyzed": fmt.Sprintf("%d", len(analysisResult.Files)),
+		"files_analyzed": fmt.Sprintf("%d", result.Snapshot.Metrics.Files),
+		"project_id":     projectID,
+		"job_id":         result.Snapshot.JobID,
+		"snapshot_id":    result.Snapshot.ID,
 	})
 }
 
 // analyzeLocalHandler processes a local directory without requiring upload.
 func (app *application) analyzeLocalHandler(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
-		Path string `json:"path"`
+		Path    string `json:"path"`
+		Project string `json:"project"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		app.errorResponse(w, r, http.StatusBadRequest, "Invalid JSON payload")
@@ -167,31 +360,59 @@ func (app *application) analyzeLocalHandler(w http.ResponseWriter, r *http.Reque
 		app.errorResponse(w, r, http.StatusBadRequest, "Path is required")
 		return
 	}
-	// Check if the directory exists
-	if _, err := os.Stat(payload.Path); os.IsNotExist(err) {
-		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Directory does not exist: %s", payload.Path))
+	projectID, err := readProjectID(payload.Project)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
-	// Run analysis directly on the local directory
-	analysisResult, err := analysis.Run(app.config.ToolsPath, payload.Path)
-	if err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+	if !app.authorize(w, r, projectID, auth.RoleAnalyst) {
+		return
+	}
+	if len(app.config.LocalRoots) == 0 {
+		app.errorResponse(w, r, http.StatusForbidden, "Local analysis is disabled: no LOCAL_ANALYSIS_ROOTS are configured.")
 		return
 	}
-	// Import to Neo4j
+	// Only directories under the configured roots may be analyzed
+	path, root, err := resolveLocalPath(payload.Path, app.config.LocalRoots)
+	switch {
+	case errors.Is(err, errOutsideRoots):
+		app.errorResponse(w, r, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, os.ErrNotExist):
+		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Directory does not exist: %s", payload.Path))
+		return
+	case err != nil:
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	app.audit(r, models.AuditEvent{Action: models.AuditAnalyzeLocal, ProjectID: projectID, Target: path, Details: map[string]any{"root": root}})
+
+	// Run analysis directly on the local directory and import to Neo4j
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
-	if err := app.db.ImportAnalysis(ctx, analysisResult); err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to import data to Neo4j: %v", err))
+	result, err := app.analyzeNow(ctx, analysisJob{
+		ProjectID: projectID,
+		Client:    clientID(r),
+		Source:    "local",
+		SourceDir: path,
+	})
+	if err != nil {
+		app.analysisErrorResponse(w, r, err)
 		return
 	}
 	app.writeJSON(w, http.StatusOK, map[string]string{
 		"message":       "Local directory analyzed and imported successfully.",
-		"analyzed_path": payload.Path,
+		"analyzed_path": path,
+		"root":          root,
+		"project_id":    projectID,
+		"job_id":        result.Snapshot.JobID,
+		"snapshot_id":   result.Snapshot.ID,
 	})
 }
 
-// queryHandler accepts a POST request with a Cypher query and returns the result.
+// queryHandler accepts a POST request with a read-only Cypher query and
+// returns a page of its rows with truncation and timing metadata, or streams
+// all of them as NDJSON.
 func (app *application) queryHandler(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
 		Query  string         `json:"query"`
@@ -202,21 +423,130 @@ func (app *application) queryHandler(w http.ResponseWriter, r *http.Request) {
 		app.errorResponse(w, r, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
+	if strings.TrimSpace(payload.Query) == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "Query is required")
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	format, ok := app.readResultFormat(w, r, database.FormatRaw)
+	if !ok {
+		return
+	}
+	limits := app.queryLimits()
+	page, ok := app.readQueryPage(w, r, payload.Query, payload.Params, limits.MaxRows)
+	if !ok {
+		return
+	}
+	if wantsNDJSON(r) {
+		app.streamQuery(w, r, payload.Query, payload.Params, format, page.Offset, app.streamLimits(), nil)
+		return
+	}
+	result, ok := app.runQuery(w, r, payload.Query, payload.Params, format, page, limits, nil)
+	if !ok {
+		return
+	}
+	app.writeJSON(w, http.StatusOK, result)
+}
+
+// readResultFormat reads the format query parameter, which selects how query
+// results are shaped: "raw" records, a flattened "table" or a "graph" of nodes
+// and edges.
+func (app *application) readResultFormat(w http.ResponseWriter, r *http.Request, fallback string) (string, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return fallback, true
+	}
+	if !database.ValidFormat(format) {
+		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Unknown format %q: use raw, table or graph", format))
+		return "", false
+	}
+	return format, true
+}
 
-	// --- THE ONLY CHANGE IS HERE ---
-	// The handler now calls the database method, keeping the logic separate.
-	results, err := app.db.Query(ctx, payload.Query, payload.Params)
+// runQuery runs a client query through the gateway within limits and returns
+// a page of its result, with a cursor for the next page if records remain. On
+// failure it writes the error response and returns false.
+func (app *application) runQuery(w http.ResponseWriter, r *http.Request, cypher string, params map[string]any, format string, page database.QueryPage, limits database.QueryLimits, details map[string]any) (*database.QueryResult, bool) {
+	// The gateway validates the query and streams it within the limits; the
+	// request context cancels it if the client goes away.
+	result, err := app.meterQuery(r, cypher, params, details, func(ctx context.Context) (*database.QueryResult, error) {
+		return app.db.GatedQuery(ctx, cypher, params, format, page, limits)
+	})
 	if err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to execute query: %v", err))
+		app.queryErrorResponse(w, r, err, limits)
+		return nil, false
+	}
+	if result.More {
+		result.NextCursor = encodeCursor(result.Offset+result.Records, cypher, params)
+	}
+	return result, true
+}
+
+// meterQuery runs a client query with run, charging the caller's query time
+// quota and recording it in the audit log along with details.
+func (app *application) meterQuery(r *http.Request, cypher string, params map[string]any, details map[string]any, run func(ctx context.Context) (*database.QueryResult, error)) (*database.QueryResult, error) {
+	client := clientID(r)
+	if err := app.quotas.AllowQuery(client); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	result, err := run(r.Context())
+	elapsed := time.Since(start)
+	app.quotas.ChargeQuery(client, elapsed)
+
+	event := models.AuditEvent{
+		Action:     models.AuditQuery,
+		Details:    map[string]any{"query": cypher, "params": params},
+		DurationMS: elapsed.Milliseconds(),
+	}
+	for key, value := range details {
+		event.Details[key] = value
+	}
+	if err != nil {
+		event.Error = err.Error()
+	} else {
+		event.Details["rows"] = result.Records
+		event.Details["offset"] = result.Offset
+		event.Details["truncated"] = result.Truncated
+	}
+	app.audit(r, event)
+	return result, err
+}
+
+// queryErrorResponse writes the error response for a failed client query.
+func (app *application) queryErrorResponse(w http.ResponseWriter, r *http.Request, err error, limits database.QueryLimits) {
+	if app.quotaErrorResponse(w, r, err) {
 		return
 	}
-	// -----------------------------
+	var rejected *database.QueryRejectedError
+	switch {
+	case errors.As(err, &rejected):
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Query rejected: %s.", rejected.Reason))
+	case errors.Is(err, context.DeadlineExceeded):
+		app.errorResponse(w, r, http.StatusGatewayTimeout, fmt.Sprintf("Query exceeded the %s time limit.", limits.Timeout))
+	default:
+		app.errorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to execute query: %v", err))
+	}
+}
+
+// queryLimits returns the configured limits on client queries.
+func (app *application) queryLimits() database.QueryLimits {
+	return database.QueryLimits{
+		MaxCost:  float64(app.config.QueryMaxCost),
+		MaxRows:  app.config.QueryMaxRows,
+		MaxBytes: app.config.QueryMaxBytes,
+		Timeout:  app.config.QueryTimeout,
+	}
+}
 
-	// Send the results back as JSON.
-	app.writeJSON(w, http.StatusOK, results)
+// streamLimits returns the limits on streamed client queries. Streams are
+// not held in memory, so only their cost and duration are limited.
+func (app *application) streamLimits() database.QueryLimits {
+	return database.QueryLimits{
+		MaxCost: float64(app.config.QueryMaxCost),
+		Timeout: app.config.QueryStreamTimeout,
+	}
 }
 
 // --- HELPER METHODS ---
@@ -236,6 +566,185 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 	app.writeJSON(w, status, errData)
 }
 
+// existingSnapshot returns the project's latest snapshot if it was made from the
+// archive with the given digest by the current analyzer version, or nil. Older
+// snapshots of the archive do not count: the graph and search index only hold
+// the latest one, so re-uploading an earlier archive has to import it again.
+func (app *application) existingSnapshot(ctx context.Context, projectID, digest string) (*models.Snapshot, error) {
+	latest, err := app.db.LatestSnapshot(ctx, projectID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if app.analyzerVersion == "" || latest.ArchiveSHA256 != digest || latest.AnalyzerVersion != app.analyzerVersion {
+		return nil, nil
+	}
+	return latest, nil
+}
+
+// extractArchive extracts an archive within the configured limits. On failure
+// it writes the response, reporting rejected archives as 422 with the reason.
+func (app *application) extractArchive(w http.ResponseWriter, r *http.Request, format archive.Format, archivePath, dest string) bool {
+	err := archive.Extract(r.Context(), format, archivePath, dest, app.archiveLimits())
+	if err == nil {
+		return true
+	}
+	var rejection *archive.RejectionError
+	if errors.As(err, &rejection) {
+		app.writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
+			"error":  "The archive was rejected.",
+			"reason": rejection.Reason,
+			"entry":  rejection.Entry,
+			"detail": rejection.Detail,
+		})
+		return false
+	}
+	app.errorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to extract archive: %v", err))
+	return false
+}
+
+// archiveLimits returns the configured bounds for extracting uploads.
+func (app *application) archiveLimits() archive.Limits {
+	return archive.Limits{
+		MaxTotalBytes: app.config.ArchiveMaxBytes,
+		MaxFileBytes:  app.config.ArchiveMaxFileBytes,
+		MaxEntries:    app.config.ArchiveMaxEntries,
+		MaxRatio:      int64(app.config.ArchiveMaxRatio),
+	}
+}
+
+// analysisErrorResponse reports a failed analysis run. A project that is
+// already being analyzed is a conflict rather than a server error.
+func (app *application) analysisErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, jobs.ErrProjectBusy) {
+		app.errorResponse(w, r, http.StatusConflict, "An analysis of this project is already in progress.")
+		return
+	}
+	if app.quotaErrorResponse(w, r, err) {
+		return
+	}
+	app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+}
+
+// uploadErrorResponse reports a failure to receive an upload body.
+func (app *application) uploadErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		app.errorResponse(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload exceeds the %d MB limit.", tooLarge.Limit>>20))
+		return
+	}
+	app.errorResponse(w, r, http.StatusBadRequest, "Could not save uploaded file.")
+}
+
+// extendDeadlines lifts the server's read and write timeouts for handlers that
+// receive large bodies or run an analysis before responding.
+func extendDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+}
+
+// saveFile streams r into a new file at path and returns its hex SHA-256 digest.
+func saveFile(path string, r io.Reader) (string, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// projectIDPattern restricts project IDs to URL-safe slugs.
+var projectIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// readProjectID validates a project ID supplied by the client. Requests that
+// don't name a project use the "default" project.
+func readProjectID(raw string) (string, error) {
+	if raw == "" {
+		return "default", nil
+	}
+	if !projectIDPattern.MatchString(raw) {
+		return "", fmt.Errorf("Invalid project ID %q: use up to 64 letters, digits, '.', '_' or '-'", raw)
+	}
+	return raw, nil
+}
+
+// errOutsideRoots is returned for local paths outside every allowed root.
+var errOutsideRoots = errors.New("Path is not under an allowed root directory")
+
+// resolveLocalPath resolves an absolute directory path with symlinks evaluated
+// and returns it with the root it lies under. Symlinks inside the directory
+// must not lead out of that root either, as the analyzer follows them.
+func resolveLocalPath(path string, roots []string) (resolved, root string, err error) {
+	if !filepath.IsAbs(path) {
+		return "", "", fmt.Errorf("Path must be absolute: %s", path)
+	}
+	resolved, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		// Don't reveal whether paths outside the roots exist
+		if _, _, ok := rootOf(filepath.Clean(path), roots); !ok {
+			return "", "", errOutsideRoots
+		}
+		return "", "", err
+	}
+	root, realRoot, ok := rootOf(resolved, roots)
+	if !ok {
+		return "", "", errOutsideRoots
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", "", err
+	}
+	if !info.IsDir() {
+		return "", "", fmt.Errorf("Path is not a directory: %s", path)
+	}
+
+	err = filepath.WalkDir(resolved, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			return nil // dangling links are skipped by the analyzer
+		}
+		if !within(target, realRoot) {
+			return fmt.Errorf("%w: %s links to %s", errOutsideRoots, p, target)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return resolved, root, nil
+}
+
+// rootOf returns the configured root that path lies under, and that root with
+// symlinks evaluated.
+func rootOf(path string, roots []string) (root, real string, ok bool) {
+	for _, root := range roots {
+		real, err := filepath.EvalSymlinks(root)
+		if err == nil && within(path, real) {
+			return root, real, true
+		}
+	}
+	return "", "", false
+}
+
+// within reports whether path is dir or inside it. Both must be clean.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // logError is a helper for logging errors.
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.Println(err)
@@ -276,41 +785,3 @@ func (app *application) debugNeo4jHandler(w http.ResponseWriter, r *http.Request
 
 	app.writeJSON(w, http.StatusOK, debugInfo)
 }
-
-// unzip function to extract a zip archive.
-func unzip(src, dest string) error {
-	r, err := zip.OpenReader(src)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-	os.MkdirAll(dest, 0755)
-	for _, f := range r.File {
-		fpath := filepath.Join(dest, f.Name)
-		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
-			return fmt.Errorf("%s: illegal file path", fpath)
-		}
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, os.ModePerm)
-			continue
-		}
-		if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-			return err
-		}
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return err
-		}
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(outFile, rc)
-		outFile.Close()
-		rc.Close()
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
\ No newline at end of file
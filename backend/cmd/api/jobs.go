@@ -0,0 +1,23 @@
+package main
+
+import (
+	"codemap/backend/internal/auth"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// getJobHandler returns the status of an analysis job.
+func (app *application) getJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+	job, ok := app.jobs.Get(jobID)
+	if !ok {
+		app.errorResponse(w, r, http.StatusNotFound, fmt.Sprintf("Job %s not found", jobID))
+		return
+	}
+	if !app.authorize(w, r, job.ProjectID, auth.RoleViewer) {
+		return
+	}
+	app.writeJSON(w, http.StatusOK, job)
+}
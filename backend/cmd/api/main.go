@@ -1,13 +1,26 @@
 package main
 
 import (
+	"codemap/backend/internal/analysis"
+	"codemap/backend/internal/audit"
+	"codemap/backend/internal/auth"
 	"codemap/backend/internal/config"
 	"codemap/backend/internal/database"
+	"codemap/backend/internal/gc"
+	"codemap/backend/internal/gitcache"
+	"codemap/backend/internal/jobs"
+	"codemap/backend/internal/queries"
+	"codemap/backend/internal/ratelimit"
 	"codemap/backend/internal/s3"
+	"codemap/backend/internal/scheduler"
+	"codemap/backend/internal/search"
+	"codemap/backend/internal/uploads"
+	"codemap/backend/internal/webhook"
 	"context"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -18,10 +31,27 @@ import (
 )
 
 type application struct {
-	config *config.AppConfig
-	db     *database.DB
-	logger *log.Logger
-	s3     *s3.Service
+	config   *config.AppConfig
+	db       *database.DB
+	logger   *log.Logger
+	s3       *s3.Service
+	webhooks *webhook.Dispatcher
+	jobs     *jobs.Queue
+	git      *gitcache.Cache
+	uploads  *uploads.Store
+	gc       *gc.Collector
+	auth     *auth.Authenticator
+	limiters map[string]*ratelimit.Limiter // by route group
+	quotas   *ratelimit.Quotas
+	queries  *queries.Catalog
+	search   *search.Cache
+	auditLog *audit.Log
+
+	// trustedProxies may set the client IP with forwarding headers.
+	trustedProxies []*net.IPNet
+
+	// analyzerVersion identifies the analysis tool's code; see analysis.Version.
+	analyzerVersion string
 }
 
 func main() {
@@ -40,16 +70,136 @@ func main() {
 	}
 	defer db.Close(context.Background())
 
-	s3Service, err := s3.NewS3Service(cfg.S3Region, cfg.AWSAccessKey, cfg.AWSSecretKey, cfg.S3Bucket)
+	s3Service, err := s3.NewS3Service(cfg.S3Region, cfg.AWSAccessKey, cfg.AWSSecretKey, cfg.S3Bucket, cfg.S3Endpoint, cfg.S3PathStyle)
 	if err != nil {
 		logger.Fatalf("Could not initialize S3 service: %v", err)
 	}
 
+	gitCache, err := gitcache.New(cfg.GitCacheDir, cfg.TempUploads, cfg.GitCacheMaxBytes, logger)
+	if err != nil {
+		logger.Fatalf("Could not initialize git cache: %v", err)
+	}
+
+	analyzerVersion, err := analysis.Version(cfg.ToolsPath)
+	if err != nil {
+		logger.Printf("Warning: could not determine analyzer version, upload deduplication is disabled: %v", err)
+	}
+
+	uploadStore, err := uploads.NewStore(cfg.UploadDir, cfg.UploadMaxBytes, cfg.UploadExpiry)
+	if err != nil {
+		logger.Fatalf("Could not initialize upload store: %v", err)
+	}
+
+	var verifier *auth.Verifier
+	if cfg.JWTSecret != "" || cfg.JWTPublicKeyFile != "" {
+		verifier, err = auth.NewVerifier(cfg.JWTSecret, cfg.JWTPublicKeyFile, cfg.JWTIssuer, cfg.JWTAudience)
+		if err != nil {
+			logger.Fatalf("Could not initialize JWT verification: %v", err)
+		}
+	}
+	if !cfg.AuthEnabled {
+		logger.Println("Warning: authentication is disabled, every caller is an admin.")
+	}
+
+	collector := gc.New(db, s3Service, gc.Policy{
+		KeepSnapshots: cfg.RetentionKeepSnapshots,
+		MaxAge:        cfg.RetentionMaxAge,
+		MaxBytes:      cfg.RetentionMaxBytes,
+		Grace:         cfg.GCGracePeriod,
+	}, gc.TempRoots(cfg.TempUploads, os.TempDir()), logger)
+
+	if cfg.WebhookKeyFile == "" {
+		logger.Fatalf("WEBHOOK_KEY_FILE must be set to a persistent path for the webhook key")
+	}
+	// A new key is only generated while no secrets were sealed with the old one
+	hasSecrets, err := db.HasWebhookSecrets(context.Background())
+	if err != nil {
+		logger.Fatalf("Could not check for webhook secrets: %v", err)
+	}
+	sealer, err := webhook.LoadSealer(cfg.WebhookKeyFile, !hasSecrets)
+	if err != nil {
+		logger.Fatalf("Could not load webhook key: %v", err)
+	}
+	if cfg.WebhookAllowPrivate {
+		logger.Println("Warning: webhooks may be delivered to private addresses.")
+	}
+	webhooks := webhook.NewDispatcher(db, sealer, logger, cfg.WebhookMaxAttempts, cfg.WebhookTimeout, cfg.WebhookAllowPrivate)
+	queue := jobs.NewQueue(cfg.JobWorkers, cfg.JobQueueSize, logger)
+
+	limits := map[string]ratelimit.Rate{
+		"default":  {PerMinute: cfg.RateLimitPerMinute, Burst: cfg.RateLimitBurst},
+		"analysis": {PerMinute: cfg.RateLimitAnalysisPerMinute, Burst: cfg.RateLimitAnalysisBurst},
+		"query":    {PerMinute: cfg.RateLimitQueryPerMinute, Burst: cfg.RateLimitQueryBurst},
+		"auth":     {PerMinute: cfg.RateLimitAuthPerMinute, Burst: cfg.RateLimitAuthBurst},
+	}
+	quota := ratelimit.Quota{
+		MaxJobs:            cfg.QuotaMaxJobs,
+		ArchiveBytesPerDay: cfg.QuotaArchiveBytesPerDay,
+		QueryTimePerMinute: cfg.QuotaQueryTimePerMinute,
+	}
+	if !cfg.RateLimitEnabled {
+		logger.Printf("Warning: rate limits and quotas are disabled")
+		for group := range limits {
+			limits[group] = ratelimit.Rate{}
+		}
+		quota = ratelimit.Quota{}
+	}
+	limiters := make(map[string]*ratelimit.Limiter, len(limits))
+	for group, rate := range limits {
+		limiters[group] = ratelimit.NewLimiter(rate)
+	}
+
+	if cfg.AuditLogDir == "" {
+		logger.Fatalf("AUDIT_LOG_DIR must be set to a durable directory for the audit log")
+	}
+	auditLog, err := audit.Open(cfg.AuditLogDir)
+	if err != nil {
+		logger.Fatalf("Could not open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	var trustedProxies []*net.IPNet
+	for _, cidr := range cfg.TrustedProxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			logger.Fatalf("Invalid trusted proxy %q: %v", cidr, err)
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+
+	catalog, err := queries.Load(cfg.QueryCatalogs...)
+	if err != nil {
+		logger.Fatalf("Could not load query catalog: %v", err)
+	}
+
 	app := &application{
-		config: cfg,
-		db:     db,
-		logger: logger,
-		s3:     s3Service,
+		config:   cfg,
+		db:       db,
+		logger:   logger,
+		s3:       s3Service,
+		webhooks: webhooks,
+		jobs:     queue,
+		git:      gitCache,
+		uploads:  uploadStore,
+		gc:       collector,
+		auth:     auth.NewAuthenticator(db, verifier, cfg.AuthBootstrapKeyHash),
+		limiters: limiters,
+		quotas:   ratelimit.NewQuotas(quota),
+		queries:  catalog,
+		auditLog: auditLog,
+
+		trustedProxies:  trustedProxies,
+		analyzerVersion: analyzerVersion,
+	}
+	app.search = search.NewCache(app.loadLatestSymbols, cfg.SearchCacheProjects)
+	uploadStore.OnExpire(app.refundUpload)
+
+	sched := scheduler.New(db, app.enqueueScheduledAnalysis, queue.Busy, logger)
+	if cfg.SchedulerEnabled {
+		sched.Start()
+	}
+	if cfg.GCInterval > 0 {
+		collector.Start(cfg.GCInterval, app.gcFinished)
 	}
 
 	srv := &http.Server{
@@ -88,5 +238,11 @@ func main() {
 		logger.Fatalf("Error during shutdown: %v", err)
 	}
 
+	// Stop background work, then wait for webhook deliveries that are already on the wire.
+	sched.Close()
+	collector.Close()
+	queue.Close()
+	webhooks.Close()
+
 	logger.Println("Server stopped gracefully.")
 }
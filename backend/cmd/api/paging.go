@@ -0,0 +1,172 @@
+package main
+
+import (
+	"codemap/backend/internal/database"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ndjsonFlushEvery is how many lines a query stream buffers before flushing
+// them to the client.
+const ndjsonFlushEvery = 500
+
+// cursor is the decoded form of the opaque page tokens of query results and
+// navigation lists. It holds the offset of the next record and a fingerprint
+// of the query, so a token cannot be used to page through a different one.
+// Queries are identified by their Cypher, or by the request path for
+// navigation lists, along with their parameters.
+type cursor struct {
+	Offset int    `json:"o"`
+	Query  string `json:"q"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor returns the token for the page of a query that starts at
+// offset. Pages are only stable for queries with a deterministic order.
+func encodeCursor(offset int, query string, params map[string]any) string {
+	data, _ := json.Marshal(cursor{Offset: offset, Query: queryFingerprint(query, params)})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the offset a token for the given query points to.
+func decodeCursor(token, query string, params map[string]any) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Offset < 0 {
+		return 0, errInvalidCursor
+	}
+	if c.Query != queryFingerprint(query, params) {
+		return 0, errInvalidCursor
+	}
+	return c.Offset, nil
+}
+
+// queryFingerprint identifies a query and its parameters. Maps are encoded
+// with sorted keys, so equal parameters give equal fingerprints.
+func queryFingerprint(query string, params map[string]any) string {
+	data, _ := json.Marshal([]any{query, params})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// readQueryPage reads the cursor and page_size query parameters of a request
+// paging through query. Page sizes are capped at maxRows, if set; without a
+// page size the page holds as many records as the limits allow.
+func (app *application) readQueryPage(w http.ResponseWriter, r *http.Request, query string, params map[string]any, maxRows int) (database.QueryPage, bool) {
+	var page database.QueryPage
+	values := r.URL.Query()
+	if token := values.Get("cursor"); token != "" {
+		offset, err := decodeCursor(token, query, params)
+		if err != nil {
+			app.errorResponse(w, r, http.StatusBadRequest, "Invalid cursor: use the next_cursor of the previous page of the same query")
+			return page, false
+		}
+		page.Offset = offset
+	}
+	if value := values.Get("page_size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 {
+			app.errorResponse(w, r, http.StatusBadRequest, "page_size must be a positive integer")
+			return page, false
+		}
+		if maxRows > 0 && size > maxRows {
+			size = maxRows
+		}
+		page.Size = size
+	}
+	return page, true
+}
+
+// wantsNDJSON reports whether the client asked for a streamed response: its
+// Accept header lists application/x-ndjson, and prefers it to application/json
+// if it lists that too.
+func wantsNDJSON(r *http.Request) bool {
+	ndjsonQ, jsonQ := 0.0, -1.0
+	for _, header := range r.Header.Values("Accept") {
+		for _, item := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(item)
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if value, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(value, 64); err != nil {
+					continue
+				}
+			}
+			switch mediaType {
+			case "application/x-ndjson":
+				ndjsonQ = max(ndjsonQ, q)
+			case "application/json":
+				jsonQ = max(jsonQ, q)
+			}
+		}
+	}
+	return ndjsonQ > 0 && ndjsonQ > jsonQ
+}
+
+// streamQuery runs a client query and streams its records as NDJSON from
+// offset on, without holding the result in memory. Errors before the first
+// record get the usual error responses; later ones end the stream with an
+// {"error": ...} line.
+func (app *application) streamQuery(w http.ResponseWriter, r *http.Request, cypher string, params map[string]any, format string, offset int, limits database.QueryLimits, details map[string]any) {
+	rc := http.NewResponseController(w)
+	// Streams may outlast the server's write timeout
+	if limits.Timeout > 0 {
+		rc.SetWriteDeadline(time.Now().Add(limits.Timeout + 10*time.Second))
+	} else {
+		rc.SetWriteDeadline(time.Time{})
+	}
+
+	started := false
+	start := func() {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		started = true
+	}
+	lines := 0
+	emit := func(line []byte) error {
+		if !started {
+			start()
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		if lines++; lines%ndjsonFlushEvery == 0 {
+			rc.Flush()
+		}
+		return nil
+	}
+
+	streamDetails := map[string]any{"stream": true}
+	for key, value := range details {
+		streamDetails[key] = value
+	}
+	_, err := app.meterQuery(r, cypher, params, streamDetails, func(ctx context.Context) (*database.QueryResult, error) {
+		return app.db.StreamQuery(ctx, cypher, params, format, offset, limits, emit)
+	})
+	switch {
+	case err != nil && !started:
+		app.queryErrorResponse(w, r, err, limits)
+	case err != nil:
+		app.logError(r, err)
+		line, _ := json.Marshal(map[string]string{"error": fmt.Sprintf("Query failed after %d lines: %v", lines, err)})
+		w.Write(append(line, '\n'))
+	case !started:
+		start()
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWantsNDJSON(t *testing.T) {
+	tests := []struct {
+		accept []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{"application/x-ndjson"}, true},
+		{[]string{"Application/X-NDJSON"}, true},
+		{[]string{"application/x-ndjson; charset=utf-8"}, true},
+		{[]string{"text/plain, application/x-ndjson"}, true},
+		{[]string{"application/json", "application/x-ndjson"}, false},
+		{[]string{"application/json;q=0.5, application/x-ndjson"}, true},
+		{[]string{"application/json, application/x-ndjson;q=0.9"}, false},
+		{[]string{"application/x-ndjson;q=0"}, false},
+		{[]string{"application/x-ndjson;q=bogus"}, false},
+		{[]string{"application/json"}, false},
+		{[]string{"*/*"}, false},
+		{[]string{"application/x-ndjsonx"}, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		for _, value := range tt.accept {
+			r.Header.Add("Accept", value)
+		}
+		if got := wantsNDJSON(r); got != tt.want {
+			t.Errorf("wantsNDJSON(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
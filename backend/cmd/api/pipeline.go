@@ -0,0 +1,326 @@
+package main
+
+import (
+	"codemap/backend/internal/analysis"
+	"codemap/backend/internal/archive"
+	"codemap/backend/internal/database"
+	"codemap/backend/internal/gitcache"
+	"codemap/backend/internal/jobs"
+	"codemap/backend/internal/models"
+	"codemap/backend/internal/s3"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// analysisJob describes a single run of the analysis pipeline.
+type analysisJob struct {
+	ID        string
+	ProjectID string
+	Source    string // "upload", "github", "local", "schedule" or "reanalyze"
+	SourceDir string
+	S3Key     string
+	RepoURL   string
+	CommitSHA string             // revision of RepoURL to check out; HEAD if empty
+	Commit    *models.CommitInfo // commit that was analyzed, if known
+	Archive   string             // SHA-256 of the uploaded archive, if any
+	Client    string             // caller whose job quota the run counts against, if any
+}
+
+// jobResult is the outcome of a successful pipeline run.
+type jobResult struct {
+	Snapshot *models.Snapshot
+	Diff     *models.SnapshotDiff
+}
+
+// analyzeNow runs job synchronously as a tracked job of its project. It fails
+// with jobs.ErrProjectBusy if the project already has a job in progress and
+// with a quota error if the client has too many.
+func (app *application) analyzeNow(ctx context.Context, job analysisJob) (*jobResult, error) {
+	if job.Client != "" {
+		release, err := app.quotas.AcquireJob(job.Client)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	var result *jobResult
+	_, err := app.jobs.Run(ctx, job.ProjectID, job.Source, func(ctx context.Context, jobID string) (string, error) {
+		job.ID = jobID
+		var err error
+		result, err = app.runAnalysis(ctx, job)
+		if err != nil {
+			return "", err
+		}
+		return result.Snapshot.ID, nil
+	})
+	return result, err
+}
+
+// enqueueScheduledAnalysis queues a background analysis of a project's git remote.
+func (app *application) enqueueScheduledAnalysis(project models.Project, commit string) error {
+	_, err := app.jobs.Submit(project.ID, "schedule", func(ctx context.Context, jobID string) (string, error) {
+		result, err := app.runAnalysis(ctx, analysisJob{
+			ID:        jobID,
+			ProjectID: project.ID,
+			Source:    "schedule",
+			RepoURL:   project.RepoURL,
+			CommitSHA: commit,
+		})
+		if err != nil {
+			return "", err
+		}
+		return result.Snapshot.ID, nil
+	})
+	return err
+}
+
+// enqueueArchiveAnalysis queues extraction and analysis of a verified archive
+// on behalf of client. tempDir holds the archive and is removed when the job
+// finishes.
+func (app *application) enqueueArchiveAnalysis(client, projectID string, format archive.Format, tempDir, archivePath, s3Key, digest string) (jobs.Job, error) {
+	return app.enqueueUploadJob(client, projectID, tempDir, func(ctx context.Context, jobID string) (string, error) {
+		return app.analyzeStoredArchive(ctx, jobID, projectID, format, tempDir, archivePath, s3Key, digest)
+	})
+}
+
+// enqueueDirectUploadAnalysis queues analysis of an archive of size bytes that
+// the client stored under key, whose SHA-256 S3 verified. The job downloads it
+// into tempDir, moves it to its content address and analyzes it as
+// enqueueArchiveAnalysis does.
+func (app *application) enqueueDirectUploadAnalysis(client, projectID, tempDir, key, digest string, size int64) (jobs.Job, error) {
+	return app.enqueueUploadJob(client, projectID, tempDir, func(ctx context.Context, jobID string) (string, error) {
+		archivePath := filepath.Join(tempDir, "archive")
+		body, err := app.s3.Open(key)
+		if err != nil {
+			return "", err
+		}
+		got, err := saveFile(archivePath, body)
+		body.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to download upload: %w", err)
+		}
+		if got != digest {
+			return "", fmt.Errorf("downloaded upload has SHA-256 %s, expected %s", got, digest)
+		}
+		format, err := archive.Detect(archivePath)
+		if err != nil {
+			return "", err
+		}
+		archiveFile, err := os.Open(archivePath)
+		if err != nil {
+			return "", err
+		}
+		s3Key, err := app.s3.PromoteArchive(key, digest, format.ContentType(), size, archiveFile)
+		archiveFile.Close()
+		if err != nil {
+			return "", err
+		}
+		return app.analyzeStoredArchive(ctx, jobID, projectID, format, tempDir, archivePath, s3Key, digest)
+	})
+}
+
+// enqueueUploadJob queues run as an upload job of client, counted against its
+// job quota. tempDir is removed when the job finishes.
+func (app *application) enqueueUploadJob(client, projectID, tempDir string, run func(ctx context.Context, jobID string) (string, error)) (jobs.Job, error) {
+	release, err := app.quotas.AcquireJob(client)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return jobs.Job{}, err
+	}
+	job, err := app.jobs.Submit(projectID, "upload", func(ctx context.Context, jobID string) (string, error) {
+		defer release()
+		defer os.RemoveAll(tempDir)
+		return run(ctx, jobID)
+	})
+	if err != nil {
+		release()
+		os.RemoveAll(tempDir)
+	}
+	return job, err
+}
+
+// analyzeStoredArchive extracts and analyzes an archive stored under s3Key,
+// unless it is what the project's latest snapshot was made from, and returns the
+// snapshot's ID.
+func (app *application) analyzeStoredArchive(ctx context.Context, jobID, projectID string, format archive.Format, tempDir, archivePath, s3Key, digest string) (string, error) {
+	existing, err := app.existingSnapshot(ctx, projectID, digest)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return existing.ID, nil
+	}
+
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := archive.Extract(ctx, format, archivePath, sourceDir, app.archiveLimits()); err != nil {
+		return "", err
+	}
+	var commit *models.CommitInfo
+	if format == archive.GitBundle {
+		commit, _ = gitcache.ReadCommit(ctx, sourceDir)
+	}
+	result, err := app.runAnalysis(ctx, analysisJob{
+		ID:        jobID,
+		ProjectID: projectID,
+		Source:    "upload",
+		SourceDir: sourceDir,
+		S3Key:     s3Key,
+		Commit:    commit,
+		Archive:   digest,
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.Snapshot.ID, nil
+}
+
+// runAnalysis analyzes job.SourceDir, imports the result into the project's
+// graph and records a snapshot. Webhooks subscribed to the project are notified
+// when the job starts, completes or fails and when the snapshot diff crosses
+// their thresholds.
+func (app *application) runAnalysis(ctx context.Context, job analysisJob) (*jobResult, error) {
+	if job.ID == "" {
+		job.ID = models.NewID("job")
+	}
+	project, err := app.db.EnsureProject(ctx, job.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	app.webhooks.Dispatch(job.ProjectID, models.EventJobStarted, map[string]any{
+		"job_id":     job.ID,
+		"source":     job.Source,
+		"s3_key":     job.S3Key,
+		"repo_url":   job.RepoURL,
+		"commit_sha": job.CommitSHA,
+	})
+
+	result, err := app.executeAnalysis(ctx, project, job)
+	if err != nil {
+		app.webhooks.Dispatch(job.ProjectID, models.EventJobFailed, map[string]any{
+			"job_id": job.ID,
+			"source": job.Source,
+			"error":  err.Error(),
+		})
+		return nil, err
+	}
+
+	app.webhooks.Dispatch(job.ProjectID, models.EventJobCompleted, map[string]any{
+		"job_id":   job.ID,
+		"snapshot": result.Snapshot,
+		"diff":     result.Diff,
+	})
+	if result.Diff != nil {
+		app.webhooks.DispatchFunc(job.ProjectID, models.EventThresholdExceeded, func(hook models.Webhook) (any, bool) {
+			exceeded := hook.Thresholds.Exceeded(*result.Diff)
+			if len(exceeded) == 0 {
+				return nil, false
+			}
+			return map[string]any{
+				"job_id":     job.ID,
+				"snapshot":   result.Snapshot,
+				"diff":       result.Diff,
+				"thresholds": hook.Thresholds,
+				"exceeded":   exceeded,
+			}, true
+		})
+	}
+	return result, nil
+}
+
+func (app *application) executeAnalysis(ctx context.Context, project *models.Project, job analysisJob) (*jobResult, error) {
+	var modules []models.Module
+
+	// Jobs for a git remote check it out from the mirror cache (and archive it to S3) first.
+	if job.SourceDir == "" && job.RepoURL != "" {
+		worktree, err := app.git.Checkout(ctx, job.RepoURL, job.CommitSHA)
+		if err != nil {
+			return nil, err
+		}
+		defer worktree.Close()
+
+		if project.Options.FetchSubmodules {
+			submodules, err := worktree.InitSubmodules(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, sub := range submodules {
+				modules = append(modules, models.Module{Path: sub.Path, URL: sub.URL, Commit: sub.Commit})
+			}
+		}
+
+		s3Key, err := app.s3.UploadDir(worktree.Dir, s3.RepoName(job.RepoURL))
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload repository: %w", err)
+		}
+		app.logger.Printf("📤 Uploaded git repo to S3: %s", s3Key)
+		job.S3Key = s3Key
+		job.SourceDir = worktree.Dir
+		job.Commit, err = gitcache.ReadCommit(ctx, worktree.Dir)
+		if err != nil {
+			job.Commit = &models.CommitInfo{SHA: worktree.Commit}
+		}
+	}
+
+	// Pass the configured tools path and the source directory to the runner
+	analysisResult, err := analysis.Run(app.config.ToolsPath, job.SourceDir)
+	if err != nil {
+		return nil, err
+	}
+	analysisResult.Modules = modules
+
+	var skipped []models.SkippedFile
+	for _, file := range analysisResult.Files {
+		if file.Skipped != "" {
+			skipped = append(skipped, models.SkippedFile{Path: file.Path, Reason: file.Skipped})
+		}
+	}
+
+	previous, err := app.db.LatestSnapshot(ctx, job.ProjectID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, err
+	}
+
+	if err := app.db.ImportAnalysis(ctx, job.ProjectID, analysisResult); err != nil {
+		return nil, fmt.Errorf("failed to import data to Neo4j: %w", err)
+	}
+	// The search index is dropped once the snapshot is recorded, so that an
+	// index built meanwhile is not kept under the previous snapshot's ID
+	defer app.search.Invalidate(job.ProjectID)
+
+	metrics, err := app.db.ComputeMetrics(ctx, job.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &models.Snapshot{
+		ID:        models.NewID("snap"),
+		ProjectID: job.ProjectID,
+		JobID:     job.ID,
+		Source:    job.Source,
+		S3Key:     job.S3Key,
+		RepoURL:   job.RepoURL,
+		Commit:    job.Commit,
+		Metrics:   metrics,
+
+		ArchiveSHA256:   job.Archive,
+		AnalyzerVersion: app.analyzerVersion,
+		Skipped:         skipped,
+		CreatedAt:       time.Now().UTC(),
+	}
+	if err := app.db.CreateSnapshot(ctx, snapshot); err != nil {
+		return nil, err
+	}
+
+	result := &jobResult{Snapshot: snapshot}
+	if previous != nil {
+		diff := metrics.Diff(previous.Metrics)
+		diff.Previous = previous.ID
+		result.Diff = &diff
+	}
+	return result, nil
+}
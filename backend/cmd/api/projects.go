@@ -0,0 +1,244 @@
+package main
+
+import (
+	"codemap/backend/internal/archive"
+	"codemap/backend/internal/database"
+	"codemap/backend/internal/gitcache"
+	"codemap/backend/internal/models"
+	"codemap/backend/internal/scheduler"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// getProjectHandler returns a project and, if scheduled, its next run.
+func (app *application) getProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	project, err := app.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		app.projectLookupError(w, r, projectID, err)
+		return
+	}
+	data := map[string]any{"project": project}
+	if schedule, err := scheduler.ParseSchedule(project.Schedule); err == nil && project.Schedule != "" {
+		data["next_run"] = schedule.Next(time.Now())
+	}
+	app.writeJSON(w, http.StatusOK, data)
+}
+
+// setScheduleHandler stores the cron schedule used to periodically
+// re-analyze a project's git remote.
+func (app *application) setScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := readProjectID(chi.URLParam(r, "projectID"))
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var payload struct {
+		Schedule string `json:"schedule"`
+		RepoURL  string `json:"repo_url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	schedule, err := scheduler.ParseSchedule(payload.Schedule)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Default to the remote the project was last analyzed from.
+	if payload.RepoURL == "" {
+		project, err := app.db.GetProject(r.Context(), projectID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if project != nil {
+			payload.RepoURL = project.RepoURL
+		}
+	}
+	if payload.RepoURL == "" {
+		if latest, err := app.db.LatestSnapshot(r.Context(), projectID); err == nil {
+			payload.RepoURL = latest.RepoURL
+		}
+	}
+	if payload.RepoURL == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "repo_url is required for projects that were not analyzed from git")
+		return
+	}
+	if err := gitcache.ValidateRemote(payload.RepoURL); err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "repo_url must be an https://github.com/ repository URL")
+		return
+	}
+
+	project, err := app.db.SetProjectSchedule(r.Context(), projectID, payload.RepoURL, payload.Schedule)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.audit(r, models.AuditEvent{
+		Action:    models.AuditScheduleSet,
+		ProjectID: projectID,
+		Target:    payload.RepoURL,
+		Details:   map[string]any{"schedule": payload.Schedule},
+	})
+	app.writeJSON(w, http.StatusOK, map[string]any{
+		"project":  project,
+		"next_run": schedule.Next(time.Now()),
+	})
+}
+
+// deleteScheduleHandler stops periodic re-analysis of a project.
+func (app *application) deleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	project, err := app.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		app.projectLookupError(w, r, projectID, err)
+		return
+	}
+	if _, err := app.db.SetProjectSchedule(r.Context(), projectID, project.RepoURL, ""); err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.audit(r, models.AuditEvent{Action: models.AuditScheduleDelete, ProjectID: projectID})
+	app.writeJSON(w, http.StatusOK, map[string]string{"message": "Schedule removed."})
+}
+
+// setProjectOptionsHandler updates how a project's source is fetched.
+func (app *application) setProjectOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := readProjectID(chi.URLParam(r, "projectID"))
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	var opts models.ProjectOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	project, err := app.db.SetProjectOptions(r.Context(), projectID, opts)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.audit(r, models.AuditEvent{Action: models.AuditProjectOptions, ProjectID: projectID, Details: map[string]any{"options": opts}})
+	app.writeJSON(w, http.StatusOK, project)
+}
+
+// listSnapshotsHandler returns the snapshots of a project, newest first.
+func (app *application) listSnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	if _, err := app.db.GetProject(r.Context(), projectID); err != nil {
+		app.projectLookupError(w, r, projectID, err)
+		return
+	}
+	snapshots, err := app.db.ListSnapshots(r.Context(), projectID)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.writeJSON(w, http.StatusOK, snapshots)
+}
+
+// reanalyzeSnapshotHandler re-runs the pipeline on the archived source of a
+// snapshot, e.g. after an analyzer upgrade or a change of project options. The
+// result is recorded as a new snapshot.
+func (app *application) reanalyzeSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	extendDeadlines(w)
+	projectID := chi.URLParam(r, "projectID")
+	snapshotID := chi.URLParam(r, "snapshotID")
+	snapshot, err := app.db.GetSnapshot(r.Context(), projectID, snapshotID)
+	if errors.Is(err, database.ErrNotFound) {
+		app.errorResponse(w, r, http.StatusNotFound, fmt.Sprintf("Snapshot %s not found in project %s", snapshotID, projectID))
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if snapshot.S3Key == "" {
+		app.errorResponse(w, r, http.StatusConflict, fmt.Sprintf("Snapshot %s has no archived source", snapshotID))
+		return
+	}
+
+	// Fetch the archive back from S3
+	tempDir, err := os.MkdirTemp(app.config.TempUploads, "codemap-reanalyze-*")
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, "Could not create temp directory.")
+		return
+	}
+	defer os.RemoveAll(tempDir)
+	archivePath := filepath.Join(tempDir, "archive")
+	archiveFile, err := os.Create(archivePath)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, "Could not create temp file.")
+		return
+	}
+	_, err = app.s3.Download(snapshot.S3Key, archiveFile)
+	archiveFile.Close()
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	format, err := archive.Detect(archivePath)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Archived source of snapshot %s is unreadable: %v", snapshotID, err))
+		return
+	}
+	sourceDir := filepath.Join(tempDir, "source")
+	if !app.extractArchive(w, r, format, archivePath, sourceDir) {
+		return
+	}
+
+	app.audit(r, models.AuditEvent{
+		Action:    models.AuditReanalyze,
+		ProjectID: projectID,
+		Target:    snapshotID,
+		Details:   map[string]any{"s3_key": snapshot.S3Key},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	result, err := app.analyzeNow(ctx, analysisJob{
+		ProjectID: projectID,
+		Client:    clientID(r),
+		Source:    "reanalyze",
+		SourceDir: sourceDir,
+		S3Key:     snapshot.S3Key,
+		RepoURL:   snapshot.RepoURL,
+		Commit:    snapshot.Commit,
+		Archive:   snapshot.ArchiveSHA256,
+	})
+	if err != nil {
+		app.analysisErrorResponse(w, r, err)
+		return
+	}
+	app.writeJSON(w, http.StatusAccepted, map[string]any{
+		"message":         "Snapshot source re-analyzed and imported.",
+		"project_id":      projectID,
+		"reanalyzed_from": snapshotID,
+		"job_id":          result.Snapshot.JobID,
+		"snapshot":        result.Snapshot,
+		"diff":            result.Diff,
+	})
+}
+
+// projectLookupError responds to a failed project lookup with 404 or 500.
+func (app *application) projectLookupError(w http.ResponseWriter, r *http.Request, projectID string, err error) {
+	if errors.Is(err, database.ErrNotFound) {
+		app.errorResponse(w, r, http.StatusNotFound, fmt.Sprintf("Project %s not found", projectID))
+		return
+	}
+	app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"codemap/backend/internal/auth"
+	"codemap/backend/internal/queries"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// listQueriesHandler returns the catalog of named queries.
+func (app *application) listQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeJSON(w, http.StatusOK, app.queries.List())
+}
+
+// getQueryHandler returns a named query.
+func (app *application) getQueryHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	entry, ok := app.queries.Get(name)
+	if !ok {
+		app.errorResponse(w, r, http.StatusNotFound, fmt.Sprintf("Query %s not found", name))
+		return
+	}
+	app.writeJSON(w, http.StatusOK, entry)
+}
+
+// runNamedQueryHandler runs a named query against a project after validating
+// its parameters, paging or streaming the result like queryHandler. Viewers
+// of the project may run catalog queries, as they cannot read outside it.
+func (app *application) runNamedQueryHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	entry, ok := app.queries.Get(name)
+	if !ok {
+		app.errorResponse(w, r, http.StatusNotFound, fmt.Sprintf("Query %s not found", name))
+		return
+	}
+
+	var payload struct {
+		Project string         `json:"project"`
+		Params  map[string]any `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	projectID, err := readProjectID(payload.Project)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !app.authorize(w, r, projectID, auth.RoleViewer) {
+		return
+	}
+	params, err := entry.Bind(projectID, payload.Params)
+	var paramErr *queries.ParamError
+	if errors.As(err, &paramErr) {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid parameters: "+paramErr.Error())
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	limits := app.queryLimits()
+	if entry.Limits.MaxRows > 0 && (limits.MaxRows == 0 || entry.Limits.MaxRows < limits.MaxRows) {
+		limits.MaxRows = entry.Limits.MaxRows
+	}
+	if entry.Limits.Timeout > 0 && (limits.Timeout == 0 || entry.Limits.Timeout < limits.Timeout) {
+		limits.Timeout = entry.Limits.Timeout
+	}
+	// Queries are shaped as the catalog says unless the caller asks otherwise
+	format, ok := app.readResultFormat(w, r, entry.Result)
+	if !ok {
+		return
+	}
+	page, ok := app.readQueryPage(w, r, entry.Cypher, params, limits.MaxRows)
+	if !ok {
+		return
+	}
+	details := map[string]any{"name": entry.Name}
+	// The entry's limits bound buffered results; streams are not buffered
+	if wantsNDJSON(r) {
+		app.streamQuery(w, r, entry.Cypher, params, format, page.Offset, app.streamLimits(), details)
+		return
+	}
+	result, ok := app.runQuery(w, r, entry.Cypher, params, format, page, limits, details)
+	if !ok {
+		return
+	}
+	app.writeJSON(w, http.StatusOK, map[string]any{
+		"query":      entry.Name,
+		"project_id": projectID,
+		"result":     entry.Result,
+		"params":     params,
+		"data":       result,
+	})
+}
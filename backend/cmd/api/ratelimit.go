@@ -0,0 +1,171 @@
+package main
+
+import (
+	"codemap/backend/internal/auth"
+	"codemap/backend/internal/ratelimit"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimit is middleware applying the route group's token buckets, one per
+// client IP and one per authenticated caller. It must run after authenticate.
+func (app *application) rateLimit(group string) func(http.Handler) http.Handler {
+	limiter := app.limiters[group]
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, wait := limiter.Allow("ip:" + clientIP(r))
+			if client := clientID(r); ok && !strings.HasPrefix(client, "ip:") {
+				ok, wait = limiter.Allow(bucketKey(client))
+			}
+			if !ok {
+				app.tooManyRequests(w, r, wait, "Rate limit exceeded.")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitIP is middleware applying the route group's token bucket of the
+// client IP only. Unlike rateLimit it may run before authenticate.
+func (app *application) rateLimitIP(group string) func(http.Handler) http.Handler {
+	limiter := app.limiters[group]
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, wait := limiter.Allow("ip:" + clientIP(r)); !ok {
+				app.tooManyRequests(w, r, wait, "Rate limit exceeded.")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientID identifies the caller for quotas: the subject of its credentials,
+// or its IP when authentication is disabled.
+func clientID(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil && p.Method != "none" {
+		return p.Subject
+	}
+	return "ip:" + clientIP(r)
+}
+
+// bucketKey is the key of a client's token buckets, kept apart from those of
+// IPs.
+func bucketKey(client string) string {
+	if strings.HasPrefix(client, "ip:") {
+		return client
+	}
+	return "sub:" + client
+}
+
+// clientIP returns the IP of the client; realIP has already applied the
+// forwarding headers of trusted proxies.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// realIP is middleware replacing the request's RemoteAddr with the client IP
+// that a trusted proxy forwarded. The forwarding headers of other requests
+// are ignored, as any client can set them.
+func (app *application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := forwardedIP(r, app.trustedProxies); ip != "" {
+			r.RemoteAddr = ip
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedIP returns the client IP in X-Forwarded-For or X-Real-IP, or "" if
+// the request did not come from a trusted proxy or forwarded no valid IP.
+func forwardedIP(r *http.Request, trusted []*net.IPNet) string {
+	if !isTrusted(net.ParseIP(clientIP(r)), trusted) {
+		return ""
+	}
+	// Each proxy appends the address it got the request from, so the client
+	// is the last address that is not itself a trusted proxy.
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			return ""
+		}
+		if i == 0 || !isTrusted(ip, trusted) {
+			return ip.String()
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// tooManyRequests responds with 429 and a Retry-After header.
+func (app *application) tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// quotaErrorResponse responds with 429 if err is a quota error and reports
+// whether it did.
+func (app *application) quotaErrorResponse(w http.ResponseWriter, r *http.Request, err error) bool {
+	var exceeded *ratelimit.ExceededError
+	if !errors.As(err, &exceeded) {
+		return false
+	}
+	app.tooManyRequests(w, r, exceeded.RetryAfter, fmt.Sprintf("Quota exceeded: %s.", exceeded))
+	return true
+}
+
+// usageHandler returns the caller's rate limits and quota usage. Admins may
+// pass ?client= to see another client's. Unlimited rates report -1 remaining
+// and unlimited quotas a zero maximum.
+func (app *application) usageHandler(w http.ResponseWriter, r *http.Request) {
+	client := clientID(r)
+	if other := r.URL.Query().Get("client"); other != "" && other != client {
+		if !auth.FromContext(r.Context()).Admin {
+			app.errorResponse(w, r, http.StatusForbidden, "Only admins can see the usage of other clients.")
+			return
+		}
+		client = other
+	}
+
+	type rateUsage struct {
+		ratelimit.Rate
+		Remaining int `json:"remaining"`
+	}
+	limits := make(map[string]rateUsage, len(app.limiters))
+	for group, limiter := range app.limiters {
+		limits[group] = rateUsage{Rate: limiter.Rate(), Remaining: limiter.Remaining(bucketKey(client))}
+	}
+	app.writeJSON(w, http.StatusOK, map[string]any{
+		"client":      client,
+		"rate_limits": limits,
+		"quota":       app.quotas.Usage(client),
+	})
+}
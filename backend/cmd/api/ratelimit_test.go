@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedIP(t *testing.T) {
+	var trusted []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "fd00::/8"} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trusted = append(trusted, network)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{name: "untrusted peer", remoteAddr: "203.0.113.9:4000", forwarded: []string{"198.51.100.1"}, realIP: "198.51.100.2", want: ""},
+		{name: "trusted peer", remoteAddr: "10.0.0.2:4000", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "spoofed hop", remoteAddr: "10.0.0.2:4000", forwarded: []string{"1.2.3.4, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "proxy chain", remoteAddr: "10.0.0.2:4000", forwarded: []string{"198.51.100.1, 10.0.0.3", "10.0.0.4"}, want: "198.51.100.1"},
+		{name: "only proxies", remoteAddr: "10.0.0.2:4000", forwarded: []string{"10.0.0.5, 10.0.0.3"}, want: "10.0.0.5"},
+		{name: "ipv6", remoteAddr: "[fd00::1]:4000", forwarded: []string{"2001:db8::1"}, want: "2001:db8::1"},
+		{name: "malformed hop", remoteAddr: "10.0.0.2:4000", forwarded: []string{"198.51.100.1, bogus"}, want: ""},
+		{name: "real ip header", remoteAddr: "10.0.0.2:4000", realIP: "198.51.100.2", want: "198.51.100.2"},
+		{name: "no headers", remoteAddr: "10.0.0.2:4000", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := forwardedIP(r, trusted); got != tt.want {
+				t.Errorf("forwardedIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"codemap/backend/internal/auth"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -13,15 +14,15 @@ func (app *application) routes() http.Handler {
 
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(app.realIP)
 	r.Use(middleware.Logger)
 
 	// CORS settings
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"}, // frontend origin
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-Key", "Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset"},
+		ExposedHeaders:   []string{"Link", "Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by browsers
 	}))
@@ -29,10 +30,83 @@ func (app *application) routes() http.Handler {
 	// API v1 routes
 	r.Route("/v1", func(r chi.Router) {
 		r.Get("/healthcheck", app.healthCheckHandler)
-		r.Post("/upload", app.uploadHandler)
-		r.Post("/github", app.githubHandler)
-		r.Post("/analyze-local", app.analyzeLocalHandler)
-		r.Post("/query", app.queryHandler)
+
+		// Everything else needs credentials. Routes that name a project check
+		// the caller's role in it; the rest check it in their handlers.
+		// Routes that start analyses or run queries have their own, tighter
+		// rate limits on top of the default one. Callers are limited by IP
+		// before their credentials are checked, which throttles guessing them.
+		r.Group(func(r chi.Router) {
+			r.Use(app.rateLimitIP("auth"))
+			r.Use(app.authenticate)
+			r.Use(app.rateLimit("default"))
+			analysis := app.rateLimit("analysis")
+
+			r.Get("/me", app.whoAmIHandler)
+			r.Get("/usage", app.usageHandler)
+			r.Get("/queries", app.listQueriesHandler)
+			r.Get("/queries/{name}", app.getQueryHandler)
+			r.With(app.rateLimit("query")).Post("/queries/{name}/run", app.runNamedQueryHandler)
+			r.With(analysis).Post("/upload", app.uploadHandler)
+			r.Route("/uploads", func(r chi.Router) {
+				r.Use(app.tusMiddleware)
+				r.Options("/", app.uploadOptionsHandler)
+				r.With(analysis).Post("/", app.createUploadHandler)
+				r.Head("/{uploadID}", app.headUploadHandler)
+				r.Patch("/{uploadID}", app.patchUploadHandler)
+				r.Delete("/{uploadID}", app.deleteUploadHandler)
+				r.With(analysis).Post("/{uploadID}/analyze", app.analyzeUploadHandler)
+				r.With(analysis).Post("/{uploadID}/complete", app.completeUploadHandler)
+			})
+			r.With(analysis).Post("/github", app.githubHandler)
+			r.Get("/jobs/{jobID}", app.getJobHandler)
+
+			r.Route("/projects/{projectID}", func(r chi.Router) {
+				viewer := app.requireProjectRole(auth.RoleViewer)
+				analyst := app.requireProjectRole(auth.RoleAnalyst)
+				admin := app.requireProjectRole(auth.RoleAdmin)
+
+				r.With(viewer).Get("/", app.getProjectHandler)
+				r.With(admin).Put("/options", app.setProjectOptionsHandler)
+				r.With(viewer).Get("/snapshots", app.listSnapshotsHandler)
+				r.With(viewer).Get("/files", app.listFilesHandler)
+				r.With(viewer).Get("/files/{fileID}/imports", app.fileImportsHandler)
+				r.With(viewer).Get("/files/{fileID}/importers", app.fileImportersHandler)
+				r.With(viewer).Get("/functions/{functionID}", app.getFunctionHandler)
+				r.With(viewer).Get("/functions/{functionID}/callers", app.functionCallersHandler)
+				r.With(viewer).Get("/functions/{functionID}/callees", app.functionCalleesHandler)
+				r.With(viewer).Get("/classes/{classID}/methods", app.classMethodsHandler)
+				r.With(viewer, app.rateLimit("query")).Get("/search", app.searchHandler)
+				r.With(viewer, app.rateLimit("query")).Get("/impact/{symbol}", app.impactHandler)
+				r.With(viewer, app.rateLimit("query")).Post("/impact/diff", app.impactDiffHandler)
+				r.With(viewer, app.rateLimit("query")).Get("/paths", app.pathsHandler)
+				r.With(analyst, analysis).Post("/snapshots/{snapshotID}/reanalyze", app.reanalyzeSnapshotHandler)
+				r.With(admin).Put("/schedule", app.setScheduleHandler)
+				r.With(admin).Delete("/schedule", app.deleteScheduleHandler)
+
+				r.Route("/webhooks", func(r chi.Router) {
+					r.Use(admin)
+					r.Get("/", app.listWebhooksHandler)
+					r.Post("/", app.createWebhookHandler)
+					r.Delete("/{webhookID}", app.deleteWebhookHandler)
+					r.Get("/{webhookID}/deliveries", app.listDeliveriesHandler)
+				})
+			})
+
+			// Server-wide operations. Raw Cypher and local paths are not
+			// confined to a project, so they are admin-only as well.
+			r.Group(func(r chi.Router) {
+				r.Use(app.requireAdmin)
+				r.With(analysis).Post("/analyze-local", app.analyzeLocalHandler)
+				r.With(app.rateLimit("query")).Post("/query", app.queryHandler)
+				r.Get("/gc", app.gcReportHandler)
+				r.Post("/gc", app.gcRunHandler)
+				r.Get("/admin/audit", app.auditLogHandler)
+				r.Get("/apikeys", app.listAPIKeysHandler)
+				r.Post("/apikeys", app.createAPIKeyHandler)
+				r.Delete("/apikeys/{keyID}", app.deleteAPIKeyHandler)
+			})
+		})
 	})
 
 	return r
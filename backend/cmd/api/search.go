@@ -0,0 +1,104 @@
+package main
+
+import (
+	"codemap/backend/internal/database"
+	"codemap/backend/internal/models"
+	"codemap/backend/internal/search"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Numbers of search hits returned.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchHandler finds functions, classes, properties and files by name
+// (?q=), or with ?mode=text by what their names, doc comments, string
+// literals and file paths say. Hits can be filtered by ?kind=
+// (comma-separated), ?language=, ?exported= and ?path=, a glob on their
+// file's path. Only the project's latest snapshot is searched, whose ID the
+// response holds.
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	mode := values.Get("mode")
+	if mode != "" && mode != "name" && mode != "text" {
+		app.errorResponse(w, r, http.StatusBadRequest, "mode must be name or text")
+		return
+	}
+	q := search.Query{
+		Text:     strings.TrimSpace(values.Get("q")),
+		Language: values.Get("language"),
+		PathGlob: values.Get("path"),
+	}
+	if q.Text == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "q is required")
+		return
+	}
+	if value := values.Get("kind"); value != "" {
+		for _, kind := range strings.Split(value, ",") {
+			kind = strings.TrimSpace(kind)
+			if !slices.Contains([]string{models.SymbolFunction, models.SymbolClass, models.SymbolProperty, models.SymbolFile}, kind) {
+				app.errorResponse(w, r, http.StatusBadRequest, "kind must list function, class, property or file")
+				return
+			}
+			q.Kinds = append(q.Kinds, kind)
+		}
+	}
+	if value := values.Get("exported"); value != "" {
+		exported, err := strconv.ParseBool(value)
+		if err != nil {
+			app.errorResponse(w, r, http.StatusBadRequest, "exported must be true or false")
+			return
+		}
+		q.Exported = &exported
+	}
+	limit, ok := app.readBoundedInt(w, r, "limit", defaultSearchLimit, maxSearchLimit)
+	if !ok {
+		return
+	}
+	q.Limit = limit
+
+	index, err := app.search.Get(r.Context(), chi.URLParam(r, "projectID"))
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	find := index.Search
+	if mode == "text" {
+		find = index.SearchText
+	}
+	hits, err := find(q)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid search: %v", err))
+		return
+	}
+	app.writeJSON(w, http.StatusOK, map[string]any{"snapshot_id": index.Snapshot(), "hits": hits})
+}
+
+// loadLatestSymbols returns the symbols of a project's graph for its search
+// index, with the ID of the snapshot that the graph was imported for, the
+// latest one.
+func (app *application) loadLatestSymbols(ctx context.Context, projectID string) ([]models.Symbol, string, error) {
+	snapshotID := ""
+	snapshot, err := app.db.LatestSnapshot(ctx, projectID)
+	switch {
+	case err == nil:
+		snapshotID = snapshot.ID
+	case !errors.Is(err, database.ErrNotFound):
+		return nil, "", err
+	}
+	symbols, err := app.db.SearchSymbols(ctx, projectID)
+	if err != nil {
+		return nil, "", err
+	}
+	return symbols, snapshotID, nil
+}
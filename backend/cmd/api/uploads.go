@@ -0,0 +1,411 @@
+package main
+
+import (
+	"codemap/backend/internal/auth"
+	"codemap/backend/internal/models"
+	"codemap/backend/internal/s3"
+	"codemap/backend/internal/uploads"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// The resumable upload endpoints implement the core tus 1.0.0 protocol
+// (https://tus.io/protocols/resumable-upload) with the creation, termination
+// and expiration extensions. Clients create an upload, PATCH chunks to it and
+// use HEAD to find where to resume after a dropped connection. Once every byte
+// has arrived, POST /v1/uploads/{uploadID}/analyze analyzes the archive like a
+// regular upload; the "filename" and "project" metadata name the archive and
+// the project.
+//
+// POST /v1/uploads without an Upload-Length header instead starts a direct
+// upload: the client declares the archive's size and SHA-256, PUTs it to the
+// returned presigned object storage URL and then calls
+// POST /v1/uploads/{uploadID}/complete, which verifies the object and queues
+// its analysis. The archive never passes through the API server on the way in.
+const tusVersion = "1.0.0"
+
+// tusMiddleware sets the protocol version header and rejects clients that
+// speak a different version.
+func (app *application) tusMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if v := r.Header.Get("Tus-Resumable"); v != "" && v != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			app.errorResponse(w, r, http.StatusPreconditionFailed, fmt.Sprintf("Unsupported tus version %s", v))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// uploadOptionsHandler advertises the supported protocol and extensions.
+func (app *application) uploadOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,termination,expiration")
+	if max := app.uploads.MaxSize(); max > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(max, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createUploadHandler starts a resumable upload of Upload-Length bytes, or a
+// direct upload if the header is missing.
+func (app *application) createUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upload-Length") == "" {
+		app.createDirectUploadHandler(w, r)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		app.errorResponse(w, r, http.StatusBadRequest, "Upload-Length header is required")
+		return
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	projectID, err := readProjectID(metadata["project"])
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !app.authorize(w, r, projectID, auth.RoleAnalyst) {
+		return
+	}
+
+	upload, err := app.uploads.Create(length, clientID(r), metadata)
+	if errors.Is(err, uploads.ErrTooLarge) {
+		app.errorResponse(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload exceeds the %d MB limit.", app.uploads.MaxSize()>>20))
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := app.quotas.ReserveArchive(clientID(r), length); err != nil {
+		app.uploads.Delete(upload.ID)
+		app.quotaErrorResponse(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/v1/uploads/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	app.writeJSON(w, http.StatusCreated, upload)
+}
+
+// headUploadHandler reports how many bytes of an upload have been received.
+func (app *application) headUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, err := app.uploads.Get(chi.URLParam(r, "uploadID"))
+	if err != nil {
+		w.WriteHeader(uploadStatus(err))
+		return
+	}
+	if !auth.FromContext(r.Context()).Can(uploadProject(upload), auth.RoleAnalyst) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	setUploadHeaders(w, upload)
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// patchUploadHandler appends a chunk to an upload.
+func (app *application) patchUploadHandler(w http.ResponseWriter, r *http.Request) {
+	extendDeadlines(w)
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		app.errorResponse(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		app.errorResponse(w, r, http.StatusBadRequest, "Upload-Offset header is required")
+		return
+	}
+
+	uploadID := chi.URLParam(r, "uploadID")
+	if _, ok := app.authorizeUpload(w, r, uploadID); !ok {
+		return
+	}
+	upload, err := app.uploads.Append(uploadID, offset, r.Body)
+	if upload != nil {
+		setUploadHeaders(w, upload)
+	}
+	if err != nil {
+		app.errorResponse(w, r, uploadStatus(err), err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteUploadHandler abandons an upload, refunding its archive bytes.
+func (app *application) deleteUploadHandler(w http.ResponseWriter, r *http.Request) {
+	uploadID := chi.URLParam(r, "uploadID")
+	upload, ok := app.authorizeUpload(w, r, uploadID)
+	if !ok {
+		return
+	}
+	if err := app.uploads.Delete(uploadID); err != nil {
+		app.errorResponse(w, r, uploadStatus(err), err.Error())
+		return
+	}
+	app.refundUpload(upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// analyzeUploadHandler analyzes a completed upload. The upload is discarded
+// once analyzed. If the analysis fails it is discarded as well and its
+// archive bytes are refunded, as for a failed regular upload.
+func (app *application) analyzeUploadHandler(w http.ResponseWriter, r *http.Request) {
+	extendDeadlines(w)
+	uploadID := chi.URLParam(r, "uploadID")
+	upload, ok := app.authorizeUpload(w, r, uploadID)
+	if !ok {
+		return
+	}
+	path, err := app.uploads.Path(uploadID)
+	if err != nil {
+		app.errorResponse(w, r, uploadStatus(err), err.Error())
+		return
+	}
+	projectID, err := readProjectID(upload.Metadata["project"])
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	filename := filepath.Base(upload.Metadata["filename"])
+	if filename == "." || filename == "/" {
+		filename = uploadID
+	}
+
+	analyzed := app.analyzeArchive(w, r, projectID, path, filename, upload.SHA256)
+	if err := app.uploads.Delete(uploadID); err != nil {
+		app.logger.Printf("Could not delete upload %s: %v", uploadID, err)
+		return
+	}
+	if !analyzed {
+		app.refundUpload(upload)
+	}
+}
+
+// sha256Pattern matches a hex-encoded SHA-256 digest.
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// createDirectUploadHandler starts an upload that the client PUTs straight to
+// object storage through a presigned URL.
+func (app *application) createDirectUploadHandler(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Filename string `json:"filename"`
+		Project  string `json:"project"`
+		Size     int64  `json:"size"`
+		SHA256   string `json:"sha256"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if payload.Size <= 0 {
+		app.errorResponse(w, r, http.StatusBadRequest, "size is required")
+		return
+	}
+	payload.SHA256 = strings.ToLower(payload.SHA256)
+	if !sha256Pattern.MatchString(payload.SHA256) {
+		app.errorResponse(w, r, http.StatusBadRequest, "sha256 must be the hex SHA-256 digest of the archive")
+		return
+	}
+	projectID, err := readProjectID(payload.Project)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !app.authorize(w, r, projectID, auth.RoleAnalyst) {
+		return
+	}
+
+	metadata := map[string]string{"filename": filepath.Base(payload.Filename), "project": payload.Project}
+	upload, err := app.uploads.CreateDirect(payload.Size, payload.SHA256, clientID(r), metadata, func(id string) string {
+		return "uploads/" + id
+	})
+	if errors.Is(err, uploads.ErrTooLarge) {
+		app.errorResponse(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload exceeds the %d MB limit.", app.uploads.MaxSize()>>20))
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := app.quotas.ReserveArchive(clientID(r), payload.Size); err != nil {
+		app.uploads.Delete(upload.ID)
+		app.quotaErrorResponse(w, r, err)
+		return
+	}
+	url, signed, err := app.s3.PresignPut(upload.ObjectKey, payload.Size, payload.SHA256, app.config.PresignExpiry)
+	if err != nil {
+		app.uploads.Delete(upload.ID)
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// The PUT must carry the signed size and checksum; clients set Host themselves
+	headers := make(map[string]string, len(signed))
+	for name := range signed {
+		if !strings.EqualFold(name, "Host") {
+			headers[name] = signed.Get(name)
+		}
+	}
+	w.Header().Set("Location", "/v1/uploads/"+upload.ID)
+	app.writeJSON(w, http.StatusCreated, map[string]any{
+		"upload":             upload,
+		"upload_url":         url,
+		"upload_method":      http.MethodPut,
+		"upload_headers":     headers,
+		"upload_url_expires": time.Now().Add(app.config.PresignExpiry).UTC(),
+		"complete_url":       "/v1/uploads/" + upload.ID + "/complete",
+	})
+}
+
+// completeUploadHandler checks that a direct upload arrived with the declared
+// size and checksum and queues its analysis. S3 verified the checksum when the
+// object was stored, so nothing is downloaded here; the analysis job fetches
+// the archive and moves it to its content address.
+func (app *application) completeUploadHandler(w http.ResponseWriter, r *http.Request) {
+	uploadID := chi.URLParam(r, "uploadID")
+	upload, ok := app.authorizeUpload(w, r, uploadID)
+	if !ok {
+		return
+	}
+	if upload.ObjectKey == "" {
+		app.errorResponse(w, r, http.StatusConflict, "Resumable uploads are analyzed with POST /v1/uploads/{uploadID}/analyze")
+		return
+	}
+	projectID, err := readProjectID(upload.Metadata["project"])
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	size, digest, ok, err := app.s3.Stat(upload.ObjectKey)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+	if !ok {
+		app.errorResponse(w, r, http.StatusConflict, "The archive has not been uploaded yet.")
+		return
+	}
+	if size != upload.Length {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Uploaded object is %d bytes, expected %d.", size, upload.Length))
+		return
+	}
+	if digest != upload.SHA256 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Uploaded object has SHA-256 %q, expected %s.", digest, upload.SHA256))
+		return
+	}
+
+	tempDir, err := os.MkdirTemp(app.config.TempUploads, "codemap-upload-*")
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, "Could not create temp directory.")
+		return
+	}
+	job, err := app.enqueueDirectUploadAnalysis(clientID(r), projectID, tempDir, upload.ObjectKey, digest, size)
+	if err != nil {
+		app.analysisErrorResponse(w, r, err)
+		return
+	}
+	app.audit(r, models.AuditEvent{
+		Action:    models.AuditUpload,
+		ProjectID: projectID,
+		Target:    upload.Metadata["filename"],
+		Details:   map[string]any{"sha256": digest, "size": size, "upload_id": uploadID},
+	})
+	if err := app.uploads.Delete(uploadID); err != nil {
+		app.logger.Printf("Could not delete upload %s: %v", uploadID, err)
+	}
+	app.writeJSON(w, http.StatusAccepted, map[string]string{
+		"message":    "Upload verified. Analysis has been queued.",
+		"s3_key":     s3.ArchiveKey(digest),
+		"sha256":     digest,
+		"project_id": projectID,
+		"job_id":     job.ID,
+	})
+}
+
+// authorizeUpload loads an upload and checks that the caller may upload to its
+// project, writing the error response if not.
+func (app *application) authorizeUpload(w http.ResponseWriter, r *http.Request, uploadID string) (*uploads.Upload, bool) {
+	upload, err := app.uploads.Get(uploadID)
+	if err != nil {
+		app.errorResponse(w, r, uploadStatus(err), err.Error())
+		return nil, false
+	}
+	if !app.authorize(w, r, uploadProject(upload), auth.RoleAnalyst) {
+		return nil, false
+	}
+	return upload, true
+}
+
+// refundUpload returns the archive bytes reserved for an upload that was
+// abandoned, expired or failed to the client charged for them.
+func (app *application) refundUpload(upload *uploads.Upload) {
+	if upload.Client != "" {
+		app.quotas.RefundArchive(upload.Client, upload.Length)
+	}
+}
+
+// uploadProject returns the project an upload was created for.
+func uploadProject(upload *uploads.Upload) string {
+	if project := upload.Metadata["project"]; project != "" {
+		return project
+	}
+	return "default"
+}
+
+func setUploadHeaders(w http.ResponseWriter, upload *uploads.Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+}
+
+// uploadStatus maps upload store errors to HTTP statuses.
+func uploadStatus(err error) int {
+	switch {
+	case errors.Is(err, uploads.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, uploads.ErrOffsetMismatch), errors.Is(err, uploads.ErrIncomplete), errors.Is(err, uploads.ErrDirect):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma-separated
+// pairs of a key and an optional base64-encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Upload-Metadata value for %q", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"codemap/backend/internal/database"
+	"codemap/backend/internal/models"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// createWebhookHandler subscribes a URL to a project's analysis lifecycle events.
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := readProjectID(chi.URLParam(r, "projectID"))
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var payload struct {
+		URL        string            `json:"url"`
+		Secret     string            `json:"secret"`
+		Events     []string          `json:"events"`
+		Thresholds models.Thresholds `json:"thresholds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+
+	if err := app.webhooks.CheckURL(r.Context(), payload.URL); err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(payload.Events) == 0 {
+		payload.Events = models.WebhookEvents
+	}
+	for _, event := range payload.Events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Unknown event %q", event))
+			return
+		}
+	}
+	if payload.Thresholds.ImportCycleFiles < 0 || payload.Thresholds.DeadFunctions < 0 {
+		app.errorResponse(w, r, http.StatusBadRequest, "Thresholds must not be negative")
+		return
+	}
+	if payload.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			app.errorResponse(w, r, http.StatusInternalServerError, "Could not generate webhook secret.")
+			return
+		}
+		payload.Secret = hex.EncodeToString(secret)
+	}
+	sealed, err := app.webhooks.Seal(payload.Secret)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if _, err := app.db.EnsureProject(r.Context(), projectID); err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	hook := &models.Webhook{
+		ID:         models.NewID("wh"),
+		ProjectID:  projectID,
+		URL:        payload.URL,
+		Secret:     payload.Secret,
+		Events:     payload.Events,
+		Thresholds: payload.Thresholds,
+		CreatedAt:  time.Now().UTC(),
+	}
+	stored := *hook
+	stored.Secret = sealed
+	if err := app.db.CreateWebhook(r.Context(), &stored); err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	app.audit(r, models.AuditEvent{
+		Action:    models.AuditWebhookCreate,
+		ProjectID: projectID,
+		Target:    hook.ID,
+		Details:   map[string]any{"url": hook.URL, "events": hook.Events},
+	})
+	// The secret is only ever returned here, so the subscriber can verify signatures.
+	app.writeJSON(w, http.StatusCreated, hook)
+}
+
+// listWebhooksHandler returns a project's webhooks without their secrets.
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	hooks, err := app.db.ListWebhooks(r.Context(), chi.URLParam(r, "projectID"))
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.writeJSON(w, http.StatusOK, hooks)
+}
+
+// deleteWebhookHandler removes a webhook and its delivery log.
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID := chi.URLParam(r, "webhookID")
+	err := app.db.DeleteWebhook(r.Context(), chi.URLParam(r, "projectID"), webhookID)
+	if errors.Is(err, database.ErrNotFound) {
+		app.errorResponse(w, r, http.StatusNotFound, fmt.Sprintf("Webhook %s not found", webhookID))
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.audit(r, models.AuditEvent{Action: models.AuditWebhookDelete, ProjectID: chi.URLParam(r, "projectID"), Target: webhookID})
+	app.writeJSON(w, http.StatusOK, map[string]string{"message": "Webhook deleted."})
+}
+
+// listDeliveriesHandler returns the delivery log of a webhook, newest first.
+func (app *application) listDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	webhookID := chi.URLParam(r, "webhookID")
+
+	hooks, err := app.db.ListWebhooks(r.Context(), projectID)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !slices.ContainsFunc(hooks, func(h models.Webhook) bool { return h.ID == webhookID }) {
+		app.errorResponse(w, r, http.StatusNotFound, fmt.Sprintf("Webhook %s not found", webhookID))
+		return
+	}
+
+	limit := 50
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 500 {
+			app.errorResponse(w, r, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := app.db.ListDeliveries(r.Context(), webhookID, limit)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.writeJSON(w, http.StatusOK, deliveries)
+}
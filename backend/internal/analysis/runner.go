@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"path/filepath"
 )
 
 // Run executes the Node.js analysis tool and returns the parsed data.
@@ -49,6 +50,13 @@ func Run(toolsPath string, targetDir string) (*models.Analysis, error) {
 		return nil, fmt.Errorf("failed to unmarshal analysis result: %w\nOutput received: %s", err, string(output))
 	}
 
+	// Store paths relative to the analyzed directory so they are stable across runs.
+	for i := range analysisResult.Files {
+		if rel, err := filepath.Rel(targetDir, analysisResult.Files[i].Path); err == nil {
+			analysisResult.Files[i].Path = filepath.ToSlash(rel)
+		}
+	}
+
 	fmt.Println("Successfully parsed analysis output.")
 	return &analysisResult, nil
 }
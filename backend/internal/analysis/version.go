@@ -0,0 +1,42 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Version identifies the analyzer by hashing its sources and locked
+// dependencies, so that results produced by different analyzer code can be
+// told apart.
+func Version(toolsPath string) (string, error) {
+	h := sha256.New()
+	files := []string{"main.js", "package-lock.json"}
+	err := filepath.WalkDir(filepath.Join(toolsPath, "src"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(toolsPath, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	// WalkDir visits files in lexical order, so the hash is deterministic.
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(toolsPath, name))
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(filepath.ToSlash(name) + "\x00"))
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
@@ -0,0 +1,419 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format is an archive format recognized by its magic bytes.
+type Format string
+
+// Supported archive formats.
+const (
+	Zip       Format = "zip"
+	Tar       Format = "tar"
+	TarGz     Format = "tar.gz"
+	TarBz2    Format = "tar.bz2"
+	TarZst    Format = "tar.zst"
+	GitBundle Format = "git-bundle"
+)
+
+// ErrUnsupportedFormat is returned for files that are not a supported archive.
+var ErrUnsupportedFormat = errors.New("unsupported archive format: expected zip, tar, tar.gz, tar.bz2, tar.zst or git bundle")
+
+// ContentType returns the MIME type used when storing the archive.
+func (f Format) ContentType() string {
+	switch f {
+	case Zip:
+		return "application/zip"
+	case Tar:
+		return "application/x-tar"
+	case TarGz:
+		return "application/gzip"
+	case TarBz2:
+		return "application/x-bzip2"
+	case TarZst:
+		return "application/zstd"
+	case GitBundle:
+		return "application/x-git-bundle"
+	}
+	return "application/octet-stream"
+}
+
+// Detect identifies the format of the archive at path from its first bytes.
+func Detect(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", ErrUnsupportedFormat
+	}
+	return DetectBytes(header[:n])
+}
+
+// DetectBytes identifies an archive format from (at least) its first 512 bytes.
+func DetectBytes(header []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return Zip, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return TarGz, nil
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return TarBz2, nil
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return TarZst, nil
+	case bytes.HasPrefix(header, []byte("# v2 git bundle\n")), bytes.HasPrefix(header, []byte("# v3 git bundle\n")):
+		return GitBundle, nil
+	case len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar")):
+		return Tar, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Extract unpacks the archive at src in the given format into dest, enforcing
+// limits. Git bundles are cloned, so dest becomes a working tree with history.
+// Symlinks, hard links and device entries are refused, and extracted files get
+// 0644 or 0755 permissions regardless of what the archive records. Archives
+// refused because of their content fail with a *RejectionError.
+func Extract(ctx context.Context, format Format, src, dest string, limits Limits) error {
+	b, err := newBudget(limits, src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	switch format {
+	case Zip:
+		return extractZip(ctx, src, dest, b)
+	case GitBundle:
+		if err := cloneBundle(ctx, src, dest, b); err != nil {
+			return err
+		}
+		return checkTree(dest, b)
+	case Tar, TarGz, TarBz2, TarZst:
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var r io.Reader = f
+		switch format {
+		case TarGz:
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				return fmt.Errorf("invalid gzip stream: %w", err)
+			}
+			defer gz.Close()
+			r = gz
+		case TarBz2:
+			r = bzip2.NewReader(f)
+		case TarZst:
+			zr, err := zstd.NewReader(f)
+			if err != nil {
+				return fmt.Errorf("invalid zstd stream: %w", err)
+			}
+			defer zr.Close()
+			r = zr
+		}
+		return extractTar(ctx, r, dest, b)
+	}
+	return ErrUnsupportedFormat
+}
+
+// entryPath returns where an archive entry is written, rejecting entries that
+// would escape dest. A directory entry naming dest itself, such as the "./"
+// that tar -C dir . starts with, is allowed.
+func entryPath(dest, name string, dir bool) (string, error) {
+	fpath := filepath.Join(dest, name)
+	if dir && fpath == filepath.Clean(dest) {
+		return fpath, nil
+	}
+	if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
+		return "", reject(ReasonIllegalPath, name, "path escapes the extraction directory")
+	}
+	return fpath, nil
+}
+
+// fileMode normalizes an archived mode to 0755 for executables and 0644 otherwise.
+func fileMode(mode os.FileMode) os.FileMode {
+	if mode&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+func extractZip(ctx context.Context, src, dest string, b *budget) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fpath, err := entryPath(dest, f.Name, f.Mode().IsDir())
+		if err != nil {
+			return err
+		}
+		mode := f.Mode()
+		switch {
+		case mode&os.ModeSymlink != 0:
+			return reject(ReasonSymlink, f.Name, "symbolic links are not allowed")
+		case mode&(os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe|os.ModeSocket|os.ModeIrregular) != 0:
+			return reject(ReasonSpecialFile, f.Name, "special files are not allowed")
+		}
+		if mode.IsDir() {
+			if err := b.entry(f.Name, 0); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(fpath, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := b.entry(f.Name, int64(min(f.UncompressedSize64, 1<<62))); err != nil {
+			return err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(fpath, f.Name, rc, fileMode(mode), b)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTar(ctx context.Context, r io.Reader, dest string, b *budget) error {
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader, tar.TypeXHeader, tar.TypeGNULongName, tar.TypeGNULongLink:
+			// Metadata, such as the pax_global_header git archive starts with
+			continue
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			return reject(ReasonSpecialFile, hdr.Name, "special files are not allowed")
+		}
+		fpath, err := entryPath(dest, hdr.Name, hdr.Typeflag == tar.TypeDir)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := b.entry(hdr.Name, 0); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(fpath, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeCont, tar.TypeGNUSparse:
+			if err := b.entry(hdr.Name, hdr.Size); err != nil {
+				return err
+			}
+			if err := writeFile(fpath, hdr.Name, tr, fileMode(hdr.FileInfo().Mode()), b); err != nil {
+				return err
+			}
+		case tar.TypeSymlink, tar.TypeLink:
+			return reject(ReasonSymlink, hdr.Name, "links are not allowed")
+		}
+		// Other entry types are vendor extensions without file content
+	}
+}
+
+func writeFile(fpath, name string, r io.Reader, mode os.FileMode, b *budget) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+	outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	err = b.copy(name, outFile, r)
+	if cerr := outFile.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// checkTree applies the extraction limits and entry rules to a working tree
+// that git wrote, such as a cloned bundle.
+func checkTree(dir string, b *budget) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		name, _ := filepath.Rel(dir, path)
+		name = filepath.ToSlash(name)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch mode := info.Mode(); {
+		case mode&os.ModeSymlink != 0:
+			return reject(ReasonSymlink, name, "symbolic links are not allowed")
+		case !mode.IsDir() && !mode.IsRegular():
+			return reject(ReasonSpecialFile, name, "special files are not allowed")
+		case mode.IsDir():
+			return b.entry(name, 0)
+		}
+		if err := b.entry(name, info.Size()); err != nil {
+			return err
+		}
+		b.total += info.Size()
+		return os.Chmod(path, fileMode(info.Mode()))
+	})
+}
+
+// cloneBundle clones a git bundle into dest, checking out the bundle's HEAD or,
+// for bundles created without one, its first branch. The bundle is verified
+// before it is cloned, and the tree to check out is held against the limits
+// before any of it is written, since a small bundle can expand to a huge tree.
+func cloneBundle(ctx context.Context, src, dest string, b *budget) error {
+	heads, err := git(ctx, "", "bundle", "list-heads", src)
+	if err != nil {
+		return fmt.Errorf("failed to read git bundle: %w", err)
+	}
+	if heads == "" {
+		return errors.New("git bundle contains no branches")
+	}
+	if err := verifyBundle(ctx, src); err != nil {
+		return err
+	}
+
+	if _, err := git(ctx, "", "clone", "--quiet", "--no-checkout", "--", src, dest); err != nil {
+		return fmt.Errorf("failed to clone git bundle: %w", err)
+	}
+	ref := "HEAD"
+	if _, err := git(ctx, dest, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		refs, err := git(ctx, dest, "for-each-ref", "--format=%(refname)", "refs/remotes/origin")
+		if err != nil || refs == "" {
+			return errors.New("git bundle contains no branches")
+		}
+		ref = strings.Fields(refs)[0]
+	}
+	// The tree is checked against a copy of the budget; checkTree accounts
+	// for what is actually written
+	planned := *b
+	if err := checkBundleTree(ctx, dest, ref, &planned); err != nil {
+		return err
+	}
+	args := []string{"checkout", "--quiet"}
+	if ref != "HEAD" {
+		args = append(args, "--detach", ref)
+	}
+	if _, err := git(ctx, dest, args...); err != nil {
+		return fmt.Errorf("failed to check out %s from git bundle: %w", ref, err)
+	}
+	return nil
+}
+
+// verifyBundle checks that a bundle is valid and complete. git only verifies
+// bundles inside a repository, so an empty one is created for it.
+func verifyBundle(ctx context.Context, src string) error {
+	scratch, err := os.MkdirTemp("", "codemap-bundle-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+	if _, err := git(ctx, "", "init", "--quiet", "--bare", scratch); err != nil {
+		return err
+	}
+	if _, err := git(ctx, scratch, "bundle", "verify", "--quiet", src); err != nil {
+		return fmt.Errorf("invalid git bundle: %w", err)
+	}
+	return nil
+}
+
+// checkBundleTree applies the extraction limits and entry rules to the tree of
+// ref in a repository that has not been checked out, from the sizes git
+// records for its blobs.
+func checkBundleTree(ctx context.Context, repo, ref string, b *budget) error {
+	out, err := git(ctx, repo, "ls-tree", "-r", "-t", "-l", "-z", "--full-tree", ref)
+	if err != nil {
+		return fmt.Errorf("failed to list git bundle tree: %w", err)
+	}
+	for _, line := range strings.Split(out, "\x00") {
+		meta, name, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 4 {
+			continue
+		}
+		mode, kind, size := fields[0], fields[1], fields[3]
+		switch {
+		case mode == "120000":
+			return reject(ReasonSymlink, name, "symbolic links are not allowed")
+		case kind != "blob":
+			if err := b.entry(name, 0); err != nil {
+				return err
+			}
+			continue
+		}
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return fmt.Errorf("unexpected size %q of %s in git bundle", size, name)
+		}
+		if err := b.entry(name, n); err != nil {
+			return err
+		}
+		b.total += n
+	}
+	return nil
+}
+
+// git runs a git command, inside dir if set, and returns its trimmed output.
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,401 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// makeRepo commits files to a new repository in dir and returns the
+// repository's path and a function running git in it.
+func makeRepo(t *testing.T, dir string, files map[string]string) (string, func(args ...string)) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := filepath.Join(dir, "repo")
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	run("init", "--quiet")
+	for name, content := range files {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("add", ".")
+	run("commit", "--quiet", "-m", "initial")
+	return repo, run
+}
+
+// makeBundle commits files to a new repository and bundles all its refs.
+func makeBundle(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	_, run := makeRepo(t, dir, files)
+	bundle := filepath.Join(dir, "repo.bundle")
+	run("bundle", "create", "--quiet", bundle, "--all")
+	return bundle
+}
+
+func TestExtractGitBundle(t *testing.T) {
+	files := map[string]string{
+		"main.go":       "package main\n",
+		"lib/util.go":   "package lib\n",
+		"lib/large.txt": strings.Repeat("x", 4096),
+	}
+	tests := []struct {
+		name   string
+		limits Limits
+		reason string
+	}{
+		{"within limits", Limits{MaxTotalBytes: 1 << 20, MaxFileBytes: 1 << 20, MaxEntries: 10}, ""},
+		{"file too large", Limits{MaxFileBytes: 1024}, ReasonFileTooLarge},
+		{"total too large", Limits{MaxTotalBytes: 2048}, ReasonTotalTooLarge},
+		{"too many entries", Limits{MaxEntries: 2}, ReasonTooManyEntries},
+	}
+	bundle := makeBundle(t, files)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "out")
+			err := Extract(context.Background(), GitBundle, bundle, dest, tt.limits)
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("Extract: %v", err)
+				}
+				for name, content := range files {
+					got, err := os.ReadFile(filepath.Join(dest, name))
+					if err != nil || string(got) != content {
+						t.Errorf("%s = %q, %v; want %q", name, got, err, content)
+					}
+				}
+				return
+			}
+			var rejection *RejectionError
+			if !errors.As(err, &rejection) || rejection.Reason != tt.reason {
+				t.Fatalf("Extract = %v, want rejection %s", err, tt.reason)
+			}
+			// Nothing is checked out of a rejected bundle
+			if _, err := os.Stat(filepath.Join(dest, "main.go")); !os.IsNotExist(err) {
+				t.Errorf("main.go was checked out: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractInvalidGitBundle(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	src := filepath.Join(t.TempDir(), "bad.bundle")
+	if err := os.WriteFile(src, []byte("# v2 git bundle\nnot a bundle\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Extract(context.Background(), GitBundle, src, filepath.Join(t.TempDir(), "out"), Limits{}); err == nil {
+		t.Error("Extract of an invalid bundle succeeded")
+	}
+}
+
+func TestExtractGitArchive(t *testing.T) {
+	files := map[string]string{
+		"main.go":     "package main\n",
+		"lib/util.go": "package lib\n",
+	}
+	for _, format := range []Format{Tar, TarGz, Zip} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+			_, run := makeRepo(t, dir, files)
+			src := filepath.Join(dir, "repo.archive")
+			// Tarballs of git archive start with a pax_global_header entry
+			run("archive", "--format="+string(format), "--prefix=project/", "-o", src, "HEAD")
+			if detected, err := Detect(src); err != nil || detected != format {
+				t.Fatalf("Detect = %s, %v; want %s", detected, err, format)
+			}
+			dest := filepath.Join(dir, "out")
+			if err := Extract(context.Background(), format, src, dest, Limits{}); err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			for name, content := range files {
+				got, err := os.ReadFile(filepath.Join(dest, "project", name))
+				if err != nil || string(got) != content {
+					t.Errorf("%s = %q, %v; want %q", name, got, err, content)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dest, "pax_global_header")); !os.IsNotExist(err) {
+				t.Errorf("pax_global_header was extracted: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractTarOfDirectory(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar is not installed")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "lib", "util.go"), []byte("package lib\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// tar -C src . names its first entry "./"
+	archive := filepath.Join(dir, "src.tar")
+	if out, err := exec.Command("tar", "-cf", archive, "-C", src, ".").CombinedOutput(); err != nil {
+		t.Fatalf("tar: %v: %s", err, out)
+	}
+	dest := filepath.Join(dir, "out")
+	if err := Extract(context.Background(), Tar, archive, dest, Limits{}); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dest, "lib", "util.go")); err != nil || string(got) != "package lib\n" {
+		t.Errorf("lib/util.go = %q, %v", got, err)
+	}
+}
+
+// testEntry is a member of an archive built by writeArchive.
+type testEntry struct {
+	name string
+	body string
+	mode os.FileMode // permissions and type; a regular 0644 file if zero
+	link string      // target of links
+}
+
+// writeArchive builds an archive of entries in format and returns its path.
+func writeArchive(t *testing.T, format Format, entries []testEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	switch format {
+	case Zip:
+		zw := zip.NewWriter(&buf)
+		for _, e := range entries {
+			hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+			hdr.SetMode(cmp.Or(e.mode, 0644))
+			w, err := zw.CreateHeader(hdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := e.body
+			if e.mode&os.ModeSymlink != 0 {
+				body = e.link
+			}
+			if _, err := io.WriteString(w, body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	case Tar, TarGz, TarZst:
+		var w io.WriteCloser = nopCloser{&buf}
+		switch format {
+		case TarGz:
+			w = gzip.NewWriter(&buf)
+		case TarZst:
+			zw, err := zstd.NewWriter(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w = zw
+		}
+		tw := tar.NewWriter(w)
+		for _, e := range entries {
+			mode := cmp.Or(e.mode, 0644)
+			hdr := &tar.Header{Name: e.name, Mode: int64(mode.Perm()), Linkname: e.link, Format: tar.FormatPAX}
+			if mode&os.ModeSetuid != 0 {
+				hdr.Mode |= 04000
+			}
+			switch {
+			case mode.IsDir():
+				hdr.Typeflag = tar.TypeDir
+			case mode&os.ModeSymlink != 0:
+				hdr.Typeflag = tar.TypeSymlink
+			case mode&os.ModeCharDevice != 0:
+				hdr.Typeflag = tar.TypeChar
+			case mode&os.ModeDevice != 0:
+				hdr.Typeflag = tar.TypeBlock
+			case mode&os.ModeNamedPipe != 0:
+				hdr.Typeflag = tar.TypeFifo
+			case e.link != "":
+				hdr.Typeflag = tar.TypeLink
+			default:
+				hdr.Typeflag = tar.TypeReg
+				hdr.Size = int64(len(e.body))
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(tw, e.body); err != nil && hdr.Typeflag == tar.TypeReg {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("cannot write %s archives", format)
+	}
+	path := filepath.Join(t.TempDir(), "test."+string(format))
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestExtractRejectsEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		formats []Format
+		entry   testEntry
+		reason  string
+	}{
+		{"parent traversal", []Format{Zip, Tar}, testEntry{name: "../evil.txt", body: "x"}, ReasonIllegalPath},
+		{"nested traversal", []Format{Zip, Tar}, testEntry{name: "a/../../evil.txt", body: "x"}, ReasonIllegalPath},
+		{"file named dest", []Format{Zip, Tar}, testEntry{name: ".", body: "x"}, ReasonIllegalPath},
+		{"symlink", []Format{Zip, Tar}, testEntry{name: "link", mode: os.ModeSymlink | 0777, link: "/etc/passwd"}, ReasonSymlink},
+		{"hard link", []Format{Tar}, testEntry{name: "link", link: "/etc/passwd"}, ReasonSymlink},
+		{"char device", []Format{Zip, Tar}, testEntry{name: "null", mode: os.ModeDevice | os.ModeCharDevice | 0666}, ReasonSpecialFile},
+		{"block device", []Format{Zip, Tar}, testEntry{name: "sda", mode: os.ModeDevice | 0660}, ReasonSpecialFile},
+		{"fifo", []Format{Zip, Tar}, testEntry{name: "pipe", mode: os.ModeNamedPipe | 0644}, ReasonSpecialFile},
+	}
+	for _, tt := range tests {
+		for _, format := range tt.formats {
+			t.Run(tt.name+"/"+string(format), func(t *testing.T) {
+				src := writeArchive(t, format, []testEntry{{name: "ok.txt", body: "ok"}, tt.entry})
+				parent := t.TempDir()
+				dest := filepath.Join(parent, "out")
+				err := Extract(context.Background(), format, src, dest, Limits{})
+				var rejection *RejectionError
+				if !errors.As(err, &rejection) || rejection.Reason != tt.reason {
+					t.Fatalf("Extract = %v, want rejection %s", err, tt.reason)
+				}
+				if _, err := os.Lstat(filepath.Join(parent, "evil.txt")); !os.IsNotExist(err) {
+					t.Errorf("evil.txt was written outside dest: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractConfinesAbsolutePaths(t *testing.T) {
+	for _, format := range []Format{Zip, Tar} {
+		t.Run(string(format), func(t *testing.T) {
+			name := filepath.ToSlash(filepath.Join(t.TempDir(), "abs.txt"))
+			src := writeArchive(t, format, []testEntry{{name: name, body: "x"}})
+			dest := t.TempDir()
+			if err := Extract(context.Background(), format, src, dest, Limits{}); err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("%s was written outside dest: %v", name, err)
+			}
+			if got, err := os.ReadFile(filepath.Join(dest, name)); err != nil || string(got) != "x" {
+				t.Errorf("%s under dest = %q, %v", name, got, err)
+			}
+		})
+	}
+}
+
+func TestExtractNormalizesModes(t *testing.T) {
+	entries := []testEntry{
+		{name: "plain.txt", body: "x", mode: 0600},
+		{name: "shared.txt", body: "x", mode: 0666},
+		{name: "run.sh", body: "x", mode: 0700},
+		{name: "setuid", body: "x", mode: os.ModeSetuid | 0777},
+		{name: "private/", mode: os.ModeDir | 0700},
+		{name: "private/file.txt", body: "x", mode: 0400},
+	}
+	want := map[string]os.FileMode{
+		"plain.txt":        0644,
+		"shared.txt":       0644,
+		"run.sh":           0755,
+		"setuid":           0755,
+		"private":          os.ModeDir | 0755,
+		"private/file.txt": 0644,
+	}
+	for _, format := range []Format{Zip, Tar, TarGz, TarZst} {
+		t.Run(string(format), func(t *testing.T) {
+			src := writeArchive(t, format, entries)
+			dest := filepath.Join(t.TempDir(), "out")
+			if err := Extract(context.Background(), format, src, dest, Limits{}); err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			for name, mode := range want {
+				info, err := os.Stat(filepath.Join(dest, name))
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					continue
+				}
+				if got := info.Mode() & (os.ModeDir | os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky); got != mode {
+					t.Errorf("%s has mode %v, want %v", name, got, mode)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectBytes(t *testing.T) {
+	ustar := make([]byte, 512)
+	copy(ustar[257:], "ustar\x0000")
+	tests := []struct {
+		name   string
+		header []byte
+		want   Format
+	}{
+		{"zip", []byte("PK\x03\x04rest"), Zip},
+		{"empty zip", []byte("PK\x05\x06rest"), Zip},
+		{"gzip", []byte{0x1f, 0x8b, 0x08, 0x00}, TarGz},
+		{"bzip2", []byte("BZh91AY&SY"), TarBz2},
+		{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, TarZst},
+		{"bundle v2", []byte("# v2 git bundle\nabc refs/heads/main\n"), GitBundle},
+		{"bundle v3", []byte("# v3 git bundle\n@object-format=sha1\n"), GitBundle},
+		{"tar", ustar, Tar},
+		{"short tar", ustar[:261], ""},
+		{"text", []byte("hello world"), ""},
+		{"bundle v1", []byte("# v1 git bundle\n"), ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		got, err := DetectBytes(tt.header)
+		if tt.want == "" {
+			if !errors.Is(err, ErrUnsupportedFormat) {
+				t.Errorf("%s: DetectBytes = %q, %v, want ErrUnsupportedFormat", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: DetectBytes = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
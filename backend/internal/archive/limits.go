@@ -0,0 +1,124 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Limits bounds what an extraction may write to disk. A zero field disables
+// that limit.
+type Limits struct {
+	MaxTotalBytes int64 // uncompressed bytes across all entries
+	MaxFileBytes  int64 // uncompressed bytes of a single entry
+	MaxEntries    int   // files and directories
+	MaxRatio      int64 // uncompressed bytes per byte of archive
+}
+
+// ratioFloor is how much may be extracted before MaxRatio is enforced, so that
+// small archives of highly compressible text are not rejected.
+const ratioFloor = 1 << 20
+
+// Rejection reasons reported by RejectionError.
+const (
+	ReasonIllegalPath      = "illegal_path"
+	ReasonSymlink          = "symlink"
+	ReasonSpecialFile      = "special_file"
+	ReasonTooManyEntries   = "too_many_entries"
+	ReasonFileTooLarge     = "file_too_large"
+	ReasonTotalTooLarge    = "total_too_large"
+	ReasonCompressionRatio = "compression_ratio"
+)
+
+// RejectionError is returned when an archive is refused because of its content
+// rather than because it could not be read.
+type RejectionError struct {
+	Reason string
+	Entry  string
+	Detail string
+}
+
+func (e *RejectionError) Error() string {
+	if e.Entry == "" {
+		return fmt.Sprintf("archive rejected (%s): %s", e.Reason, e.Detail)
+	}
+	return fmt.Sprintf("archive rejected (%s): %s: %s", e.Reason, e.Entry, e.Detail)
+}
+
+func reject(reason, entry, format string, args ...any) *RejectionError {
+	return &RejectionError{Reason: reason, Entry: entry, Detail: fmt.Sprintf(format, args...)}
+}
+
+// budget tracks what an extraction has written against its limits.
+type budget struct {
+	limits  Limits
+	srcSize int64
+	entries int
+	total   int64
+}
+
+func newBudget(limits Limits, src string) (*budget, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	return &budget{limits: limits, srcSize: max(info.Size(), 1)}, nil
+}
+
+// entry accounts for one more entry, declaring size bytes when known (-1 if not).
+func (b *budget) entry(name string, size int64) error {
+	b.entries++
+	if b.limits.MaxEntries > 0 && b.entries > b.limits.MaxEntries {
+		return reject(ReasonTooManyEntries, "", "more than %d entries", b.limits.MaxEntries)
+	}
+	if size > 0 {
+		if b.limits.MaxFileBytes > 0 && size > b.limits.MaxFileBytes {
+			return reject(ReasonFileTooLarge, name, "%d bytes exceeds the %d byte limit", size, b.limits.MaxFileBytes)
+		}
+		if err := b.check(name, b.total+size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check validates a running total of uncompressed bytes.
+func (b *budget) check(name string, total int64) error {
+	if b.limits.MaxTotalBytes > 0 && total > b.limits.MaxTotalBytes {
+		return reject(ReasonTotalTooLarge, name, "archive expands to more than %d bytes", b.limits.MaxTotalBytes)
+	}
+	if b.limits.MaxRatio > 0 && total > ratioFloor && total/b.srcSize > b.limits.MaxRatio {
+		return reject(ReasonCompressionRatio, name, "archive expands more than %dx", b.limits.MaxRatio)
+	}
+	return nil
+}
+
+// copy writes r to w, aborting as soon as a limit is crossed. Declared sizes
+// are checked up front by entry, but they can lie, so the actual bytes are
+// counted as well.
+func (b *budget) copy(name string, w io.Writer, r io.Reader) error {
+	var written int64
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			written += int64(n)
+			if b.limits.MaxFileBytes > 0 && written > b.limits.MaxFileBytes {
+				return reject(ReasonFileTooLarge, name, "more than %d bytes", b.limits.MaxFileBytes)
+			}
+			if err := b.check(name, b.total+written); err != nil {
+				return err
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			b.total += written
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractLimits(t *testing.T) {
+	files := []testEntry{
+		{name: "lib/", mode: os.ModeDir | 0755},
+		{name: "lib/a.txt", body: strings.Repeat("a", 4096)},
+		{name: "lib/b.txt", body: strings.Repeat("b", 4096)},
+		{name: "main.go", body: "package main\n"},
+	}
+	// Four megabytes of zeros compress to a few kilobytes
+	bomb := []testEntry{{name: "zeros", body: strings.Repeat("\x00", 4<<20)}}
+
+	tests := []struct {
+		name    string
+		entries []testEntry
+		limits  Limits
+		reason  string
+	}{
+		{"within limits", files, Limits{MaxTotalBytes: 1 << 20, MaxFileBytes: 4096, MaxEntries: 4, MaxRatio: 100}, ""},
+		{"too many entries", files, Limits{MaxEntries: 3}, ReasonTooManyEntries},
+		{"file too large", files, Limits{MaxFileBytes: 4095}, ReasonFileTooLarge},
+		{"total too large", files, Limits{MaxTotalBytes: 8192}, ReasonTotalTooLarge},
+		{"compression ratio", bomb, Limits{MaxRatio: 100}, ReasonCompressionRatio},
+		{"ratio below floor", []testEntry{{name: "zeros", body: strings.Repeat("\x00", ratioFloor)}}, Limits{MaxRatio: 2}, ""},
+		{"bomb within ratio", bomb, Limits{MaxRatio: 1 << 20}, ""},
+	}
+	for _, tt := range tests {
+		for _, format := range []Format{Zip, TarGz, TarZst} {
+			t.Run(tt.name+"/"+string(format), func(t *testing.T) {
+				src := writeArchive(t, format, tt.entries)
+				dest := filepath.Join(t.TempDir(), "out")
+				err := Extract(context.Background(), format, src, dest, tt.limits)
+				if tt.reason == "" {
+					if err != nil {
+						t.Fatalf("Extract: %v", err)
+					}
+					return
+				}
+				var rejection *RejectionError
+				if !errors.As(err, &rejection) || rejection.Reason != tt.reason {
+					t.Fatalf("Extract = %v, want rejection %s", err, tt.reason)
+				}
+			})
+		}
+	}
+}
+
+func TestBudgetCountsActualBytes(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.WriteFile(src, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		limits Limits
+		reason string
+	}{
+		{"file", Limits{MaxFileBytes: 10}, ReasonFileTooLarge},
+		{"total", Limits{MaxTotalBytes: 10}, ReasonTotalTooLarge},
+	}
+	for _, tt := range tests {
+		b, err := newBudget(tt.limits, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The entry declares no size, as a lying or streamed entry would
+		if err := b.entry("big", -1); err != nil {
+			t.Fatal(err)
+		}
+		var sink strings.Builder
+		err = b.copy("big", &sink, strings.NewReader(strings.Repeat("x", 20)))
+		var rejection *RejectionError
+		if !errors.As(err, &rejection) || rejection.Reason != tt.reason {
+			t.Errorf("%s: copy = %v, want rejection %s", tt.name, err, tt.reason)
+		}
+		if sink.Len() > 10 {
+			t.Errorf("%s: %d bytes were written past the limit", tt.name, sink.Len())
+		}
+	}
+}
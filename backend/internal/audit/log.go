@@ -0,0 +1,196 @@
+// Package audit keeps the audit log in JSON Lines files, one per UTC day,
+// outside the graph database, so that no Cypher can change or remove an entry.
+// The files are only ever opened for appending; operators can make that
+// binding at the filesystem level, e.g. with chattr +a, or ship them off the
+// host.
+package audit
+
+import (
+	"bytes"
+	"codemap/backend/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dayLayout names the file of each day.
+const dayLayout = "2006-01-02"
+
+// ErrInvalidCursor is returned for cursors that Scan did not hand out.
+var ErrInvalidCursor = errors.New("invalid audit cursor")
+
+// Log is an append-only audit log in a directory.
+type Log struct {
+	dir string
+
+	mu   sync.Mutex
+	day  string
+	file *os.File
+}
+
+// Open opens the audit log kept in dir, creating the directory if needed.
+func Open(dir string) (*Log, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	return &Log{dir: dir}, nil
+}
+
+// Append writes an event to the file of the day it happened and syncs it to
+// disk.
+func (l *Log) Append(e *models.AuditEvent) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if day := e.Time.UTC().Format(dayLayout); day != l.day {
+		if l.file != nil {
+			l.file.Close()
+			l.file = nil
+		}
+		f, err := os.OpenFile(l.path(day), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		l.day, l.file = day, f
+	}
+	if _, err := l.file.Write(line); err != nil {
+		return fmt.Errorf("failed to append audit event: %w", err)
+	}
+	return l.file.Sync()
+}
+
+// Close closes the file being appended to.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.day, l.file = "", nil
+	return err
+}
+
+func (l *Log) path(day string) string {
+	return filepath.Join(l.dir, "audit-"+day+".jsonl")
+}
+
+// days returns the days the log has a file for, newest first.
+func (l *Log) days() ([]string, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log: %w", err)
+	}
+	var days []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "audit-") || !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+		day := strings.TrimSuffix(strings.TrimPrefix(name, "audit-"), ".jsonl")
+		if _, err := time.Parse(dayLayout, day); err == nil {
+			days = append(days, day)
+		}
+	}
+	slices.Sort(days)
+	slices.Reverse(days)
+	return days, nil
+}
+
+// Scan calls fn with the events matching filter, newest first, until fn
+// returns false or an error. A non-empty cursor resumes after the event it was
+// handed out with. filter.Limit is ignored. fn also gets the cursor of the
+// event it is called with.
+func (l *Log) Scan(filter models.AuditFilter, cursor string, fn func(e models.AuditEvent, cursor string) (bool, error)) error {
+	fromDay, fromLine := "", 0
+	if cursor != "" {
+		var err error
+		if fromDay, fromLine, err = decodeCursor(cursor); err != nil {
+			return err
+		}
+	}
+	days, err := l.days()
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if fromDay != "" && day > fromDay {
+			continue
+		}
+		start, _ := time.Parse(dayLayout, day)
+		if !filter.Until.IsZero() && !start.Before(filter.Until) {
+			continue
+		}
+		if !filter.Since.IsZero() && !start.Add(24*time.Hour).After(filter.Since) {
+			break
+		}
+		lines, err := l.readDay(day)
+		if err != nil {
+			return err
+		}
+		last := len(lines)
+		if day == fromDay {
+			last = min(fromLine, last)
+		}
+		for i := last - 1; i >= 0; i-- {
+			var e models.AuditEvent
+			// A line being appended concurrently may be incomplete
+			if err := json.Unmarshal(lines[i], &e); err != nil || !matches(e, filter) {
+				continue
+			}
+			more, err := fn(e, encodeCursor(day, i))
+			if err != nil || !more {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readDay returns the lines of a day's file.
+func (l *Log) readDay(day string) ([][]byte, error) {
+	data, err := os.ReadFile(l.path(day))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")), nil
+}
+
+func matches(e models.AuditEvent, filter models.AuditFilter) bool {
+	return (filter.Actor == "" || e.Actor == filter.Actor) &&
+		(filter.Action == "" || e.Action == filter.Action) &&
+		(filter.ProjectID == "" || e.ProjectID == filter.ProjectID) &&
+		(filter.Since.IsZero() || !e.Time.Before(filter.Since)) &&
+		(filter.Until.IsZero() || e.Time.Before(filter.Until))
+}
+
+// A cursor names the day and line of the event it was handed out with.
+func encodeCursor(day string, line int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(day + ":" + strconv.Itoa(line)))
+}
+
+func decodeCursor(cursor string) (string, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+	day, raw, ok := strings.Cut(string(data), ":")
+	line, err := strconv.Atoi(raw)
+	if _, perr := time.Parse(dayLayout, day); !ok || err != nil || perr != nil || line < 0 {
+		return "", 0, ErrInvalidCursor
+	}
+	return day, line, nil
+}
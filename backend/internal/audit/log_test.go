@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"codemap/backend/internal/models"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	l, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	day1 := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+	events := []models.AuditEvent{
+		{ID: "a", Time: day1, Actor: "alice", Action: models.AuditUpload, ProjectID: "p1"},
+		{ID: "b", Time: day1.Add(time.Minute), Actor: "bob", Action: models.AuditQuery, ProjectID: "p2"},
+		{ID: "c", Time: day2, Actor: "alice", Action: models.AuditQuery, ProjectID: "p1"},
+		{ID: "d", Time: day2.Add(time.Minute), Actor: "bob", Action: models.AuditUpload, ProjectID: "p1"},
+	}
+	for i := range events {
+		if err := l.Append(&events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter models.AuditFilter
+		want   []string
+	}{
+		{"all, newest first", models.AuditFilter{}, []string{"d", "c", "b", "a"}},
+		{"actor", models.AuditFilter{Actor: "alice"}, []string{"c", "a"}},
+		{"action", models.AuditFilter{Action: models.AuditQuery}, []string{"c", "b"}},
+		{"project", models.AuditFilter{ProjectID: "p1"}, []string{"d", "c", "a"}},
+		{"since", models.AuditFilter{Since: day1.Add(time.Minute)}, []string{"d", "c", "b"}},
+		{"until", models.AuditFilter{Until: day2}, []string{"b", "a"}},
+		{"range", models.AuditFilter{Since: day1.Add(time.Minute), Until: day2.Add(time.Minute)}, []string{"c", "b"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := l.Scan(tt.filter, "", func(e models.AuditEvent, _ string) (bool, error) {
+			got = append(got, e.ID)
+			return true, nil
+		})
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Scan = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestScanCursor(t *testing.T) {
+	l, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	start := time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)
+	var want []string
+	for i := range 7 {
+		e := models.AuditEvent{ID: string(rune('a' + i)), Time: start.Add(time.Duration(i) * 30 * time.Minute)}
+		if err := l.Append(&e); err != nil {
+			t.Fatal(err)
+		}
+		want = append([]string{e.ID}, want...)
+	}
+
+	// Pages of two events must cover the log once, across day files
+	var got []string
+	cursor := ""
+	for page := 0; page < 10; page++ {
+		n, next := 0, ""
+		err := l.Scan(models.AuditFilter{}, cursor, func(e models.AuditEvent, c string) (bool, error) {
+			if n == 2 {
+				return false, nil
+			}
+			got = append(got, e.ID)
+			n, next = n+1, c
+			return true, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n < 2 {
+			break
+		}
+		cursor = next
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("paged Scan = %v, want %v", got, want)
+	}
+
+	if err := l.Scan(models.AuditFilter{}, "not a cursor", nil); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Scan with a bad cursor = %v, want ErrInvalidCursor", err)
+	}
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Role is what a caller may do within a project. Each role includes the
+// permissions of the roles below it.
+type Role string
+
+// Roles, from least to most privileged.
+const (
+	RoleViewer  Role = "viewer"  // read graphs, snapshots and jobs
+	RoleAnalyst Role = "analyst" // also upload and run analyses
+	RoleAdmin   Role = "admin"   // also manage schedules, options and webhooks
+)
+
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleAnalyst:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	return r.rank() > 0
+}
+
+// AllProjects is the project key of a role that applies to every project.
+const AllProjects = "*"
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Subject string `json:"subject"`
+	Method  string `json:"method"` // "api_key", "jwt" or "none" when auth is disabled
+	// Admin callers may do anything, including server-wide operations.
+	Admin bool            `json:"admin"`
+	Roles map[string]Role `json:"roles,omitempty"`
+}
+
+// Can reports whether the principal holds at least role in the project.
+func (p *Principal) Can(projectID string, role Role) bool {
+	if p == nil {
+		return false
+	}
+	if p.Admin {
+		return true
+	}
+	if granted, ok := p.Roles[projectID]; ok && granted.rank() >= role.rank() {
+		return true
+	}
+	granted, ok := p.Roles[AllProjects]
+	return ok && granted.rank() >= role.rank()
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a context carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of the request, or nil.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// ErrUnauthenticated is returned for requests without valid credentials.
+var ErrUnauthenticated = errors.New("missing or invalid credentials")
+
+// KeyStore looks up API keys by ID.
+type KeyStore interface {
+	GetAPIKey(ctx context.Context, id string) (*models.APIKey, error)
+}
+
+// Authenticator resolves the credentials of a request to a principal. API
+// keys are sent as "Authorization: Bearer cm_..." or in the X-API-Key header;
+// any other bearer token is verified as a JWT.
+type Authenticator struct {
+	keys KeyStore
+	jwt  *Verifier
+	// bootstrapHash is the SHA-256 of an admin key configured out of band, so
+	// that the first API keys can be created.
+	bootstrapHash string
+}
+
+// NewAuthenticator creates an authenticator. jwt may be nil to disable JWTs.
+func NewAuthenticator(keys KeyStore, jwt *Verifier, bootstrapHash string) *Authenticator {
+	return &Authenticator{keys: keys, jwt: jwt, bootstrapHash: strings.ToLower(bootstrapHash)}
+}
+
+// Authenticate returns the principal of r or ErrUnauthenticated.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := r.Header.Get("X-API-Key")
+	if token == "" {
+		scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return nil, ErrUnauthenticated
+		}
+		token = strings.TrimSpace(value)
+	}
+	if strings.HasPrefix(token, keyPrefix) {
+		return a.authenticateKey(r.Context(), token)
+	}
+	if a.jwt == nil {
+		return nil, ErrUnauthenticated
+	}
+	return a.jwt.Verify(token)
+}
+
+func (a *Authenticator) authenticateKey(ctx context.Context, token string) (*Principal, error) {
+	if a.bootstrapHash != "" && subtle.ConstantTimeCompare([]byte(HashSecret(token)), []byte(a.bootstrapHash)) == 1 {
+		return &Principal{Subject: "bootstrap", Method: "api_key", Admin: true}, nil
+	}
+	id, secret, ok := ParseKey(token)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	key, err := a.keys.GetAPIKey(ctx, id)
+	if err != nil || key == nil {
+		return nil, ErrUnauthenticated
+	}
+	if subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(key.SecretHash)) != 1 {
+		return nil, ErrUnauthenticated
+	}
+	p := &Principal{Subject: "key:" + key.ID, Method: "api_key", Admin: key.Admin, Roles: make(map[string]Role)}
+	for project, role := range key.Roles {
+		p.Roles[project] = Role(role)
+	}
+	return p, nil
+}
+
+// keyPrefix marks API keys, which look like cm_<id>_<secret>.
+const keyPrefix = "cm_"
+
+// GenerateKey returns a new API key ID, the token handed to the client and the
+// hash of its secret that is stored.
+func GenerateKey() (id, token, secretHash string, err error) {
+	idBytes := make([]byte, 8)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate key secret: %w", err)
+	}
+	id = hex.EncodeToString(idBytes)
+	secretHex := hex.EncodeToString(secret)
+	return id, fmt.Sprintf("%s%s_%s", keyPrefix, id, secretHex), HashSecret(secretHex), nil
+}
+
+// ParseKey splits an API key token into its ID and secret.
+func ParseKey(token string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(token, keyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(rest, "_")
+	return id, secret, ok && id != "" && secret != ""
+}
+
+// HashSecret returns the hex SHA-256 under which a key secret is stored. Keys
+// are long random strings, so a fast hash is sufficient.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
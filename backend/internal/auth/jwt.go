@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// claims are the JWT claims CodeMap reads. Roles maps project IDs, or "*",
+// to a role name.
+type claims struct {
+	jwt.RegisteredClaims
+	Admin bool            `json:"admin"`
+	Roles map[string]Role `json:"roles"`
+}
+
+// Verifier checks JWTs locally against a shared HMAC secret or an RSA, ECDSA
+// or Ed25519 public key.
+type Verifier struct {
+	hmacSecret []byte
+	publicKey  crypto.PublicKey
+	parser     *jwt.Parser
+}
+
+// NewVerifier creates a verifier. Either hmacSecret or publicKeyFile (PEM) must
+// be set; issuer and audience are checked when non-empty.
+func NewVerifier(hmacSecret, publicKeyFile, issuer, audience string) (*Verifier, error) {
+	v := &Verifier{}
+	methods := []string{}
+	if hmacSecret != "" {
+		v.hmacSecret = []byte(hmacSecret)
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+	if publicKeyFile != "" {
+		pem, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT public key: %w", err)
+		}
+		if v.publicKey, err = parsePublicKey(pem); err != nil {
+			return nil, err
+		}
+		methods = append(methods, "RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512", "EdDSA")
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("a JWT secret or public key is required")
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if issuer != "" {
+		opts = append(opts, jwt.WithIssuer(issuer))
+	}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+	return v, nil
+}
+
+// Verify validates a token and returns its principal.
+func (v *Verifier) Verify(token string) (*Principal, error) {
+	var c claims
+	_, err := v.parser.ParseWithClaims(token, &c, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+			return v.hmacSecret, nil
+		}
+		return v.publicKey, nil
+	})
+	if err != nil || c.Subject == "" {
+		return nil, ErrUnauthenticated
+	}
+	p := &Principal{Subject: c.Subject, Method: "jwt", Admin: c.Admin, Roles: make(map[string]Role)}
+	for project, role := range c.Roles {
+		if role.Valid() {
+			p.Roles[project] = role
+		}
+	}
+	return p, nil
+}
+
+func parsePublicKey(pem []byte) (crypto.PublicKey, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(pem); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseEdPublicKeyFromPEM(pem); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("JWT public key must be a PEM-encoded RSA, ECDSA or Ed25519 key")
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "test-secret"
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	keyFile := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(keyFile, pemBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	hmacOnly, err := NewVerifier(secret, "", "https://issuer.example", "codemap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyOnly, err := NewVerifier("", keyFile, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":   "alice",
+			"iss":   "https://issuer.example",
+			"aud":   "codemap",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"roles": map[string]string{"proj": "analyst", "other": "owner"},
+		}
+	}
+	hs256 := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	with := func(key string, value any) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	eddsa, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, valid()).SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Signing with the public key as an HMAC secret must not pass for EdDSA
+	confused, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString(pemBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("other-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		token    string
+		ok       bool
+	}{
+		{"hs256", hmacOnly, hs256(valid()), true},
+		{"eddsa", keyOnly, eddsa, true},
+		{"wrong secret", hmacOnly, forged, false},
+		{"alg none", hmacOnly, none, false},
+		{"eddsa to hmac verifier", hmacOnly, eddsa, false},
+		{"hmac with public key", keyOnly, confused, false},
+		{"wrong issuer", hmacOnly, hs256(with("iss", "https://evil.example")), false},
+		{"no issuer", hmacOnly, hs256(with("iss", nil)), false},
+		{"wrong audience", hmacOnly, hs256(with("aud", "other")), false},
+		{"no audience", hmacOnly, hs256(with("aud", nil)), false},
+		{"expired", hmacOnly, hs256(with("exp", time.Now().Add(-time.Minute).Unix())), false},
+		{"no expiry", hmacOnly, hs256(with("exp", nil)), false},
+		{"not yet valid", hmacOnly, hs256(with("nbf", time.Now().Add(time.Hour).Unix())), false},
+		{"no subject", hmacOnly, hs256(with("sub", nil)), false},
+		{"garbage", hmacOnly, "not.a.token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.verifier.Verify(tt.token)
+			if !tt.ok {
+				if err != ErrUnauthenticated {
+					t.Fatalf("Verify = %+v, %v, want ErrUnauthenticated", p, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if p.Subject != "alice" || p.Method != "jwt" || p.Admin {
+				t.Errorf("Verify = %+v", p)
+			}
+			// Unknown roles are dropped
+			if len(p.Roles) != 1 || p.Roles["proj"] != RoleAnalyst {
+				t.Errorf("roles = %v, want proj: analyst only", p.Roles)
+			}
+		})
+	}
+}
+
+func TestNewVerifierRequiresKey(t *testing.T) {
+	if _, err := NewVerifier("", "", "", ""); err == nil {
+		t.Error("NewVerifier without a secret or key succeeded")
+	}
+	if _, err := NewVerifier("", filepath.Join(t.TempDir(), "missing.pem"), "", ""); err == nil {
+		t.Error("NewVerifier with a missing key file succeeded")
+	}
+}
@@ -2,6 +2,10 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // AppConfig holds the application configuration.
@@ -14,8 +18,81 @@ type AppConfig struct {
 	TempUploads  string
 	S3Bucket     string
 	S3Region     string
+	S3Endpoint   string
+	S3PathStyle  bool
 	AWSAccessKey string
 	AWSSecretKey string
+
+	// LocalRoots are the directories analyze-local may read from.
+	LocalRoots []string
+
+	// TrustedProxies are the CIDRs of reverse proxies whose X-Forwarded-For
+	// and X-Real-IP headers are believed.
+	TrustedProxies []string
+
+	WebhookMaxAttempts int
+	WebhookTimeout     time.Duration
+	// WebhookKeyFile holds the key webhook secrets are encrypted with. It must
+	// be set to a path that survives restarts.
+	WebhookKeyFile      string
+	WebhookAllowPrivate bool
+
+	GitCacheDir      string
+	GitCacheMaxBytes int64
+
+	JobWorkers       int
+	JobQueueSize     int
+	SchedulerEnabled bool
+
+	ArchiveMaxBytes     int64
+	ArchiveMaxFileBytes int64
+	ArchiveMaxEntries   int
+	ArchiveMaxRatio     int
+
+	UploadDir      string
+	UploadMaxBytes int64
+	UploadExpiry   time.Duration
+	PresignExpiry  time.Duration
+
+	// AuditLogDir must be set to a durable directory for the audit log.
+	AuditLogDir string
+
+	RetentionKeepSnapshots int
+	RetentionMaxAge        time.Duration
+	RetentionMaxBytes      int64
+	GCInterval             time.Duration
+	GCGracePeriod          time.Duration
+
+	AuthEnabled          bool
+	AuthBootstrapKeyHash string
+	JWTSecret            string
+	JWTPublicKeyFile     string
+	JWTIssuer            string
+	JWTAudience          string
+
+	QueryMaxCost       int
+	QueryMaxRows       int
+	QueryMaxBytes      int64
+	QueryTimeout       time.Duration
+	QueryStreamTimeout time.Duration
+	QueryCatalogs      []string
+
+	// SearchCacheProjects is the number of projects whose search index is
+	// kept in memory.
+	SearchCacheProjects int
+
+	RateLimitEnabled           bool
+	RateLimitPerMinute         int
+	RateLimitBurst             int
+	RateLimitAnalysisPerMinute int
+	RateLimitAnalysisBurst     int
+	RateLimitQueryPerMinute    int
+	RateLimitQueryBurst        int
+	RateLimitAuthPerMinute     int
+	RateLimitAuthBurst         int
+	QuotaMaxJobs               int
+	QuotaArchiveBytesPerDay    int64
+	QuotaQueryTimePerMinute    time.Duration
 }
 
 // getEnv reads an environment variable or returns a default value.
@@ -26,6 +103,47 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvInt reads an integer environment variable or returns a default value.
+func getEnvInt(key string, fallback int) int {
+	if value, ok := os.LookupEnv(key); ok {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+// getEnvBool reads a boolean environment variable (e.g. "true", "0") or returns a default value.
+func getEnvBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+// getEnvDuration reads a duration environment variable (e.g. "10s") or returns a default value.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+// splitList splits a comma-separated list, dropping empty elements.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 // Load loads configuration from environment variables or uses defaults.
 func Load() *AppConfig {
 	return &AppConfig{
@@ -37,7 +155,72 @@ func Load() *AppConfig {
 		TempUploads:  getEnv("TEMP_UPLOADS", os.TempDir()),
 		S3Bucket:     getEnv("S3_BUCKET", "your-bucket-name"),
 		S3Region:     getEnv("S3_REGION", "your-region"),
+		S3Endpoint:   getEnv("S3_ENDPOINT", ""),
+		S3PathStyle:  getEnvBool("S3_FORCE_PATH_STYLE", false),
 		AWSAccessKey: getEnv("AWS_ACCESS_KEY", ""),
 		AWSSecretKey: getEnv("AWS_SECRET_KEY", ""),
+
+		LocalRoots: filepath.SplitList(getEnv("LOCAL_ANALYSIS_ROOTS", "")),
+
+		TrustedProxies: splitList(getEnv("TRUSTED_PROXIES", "")),
+
+		WebhookMaxAttempts:  getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookTimeout:      getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookKeyFile:      getEnv("WEBHOOK_KEY_FILE", ""),
+		WebhookAllowPrivate: getEnvBool("WEBHOOK_ALLOW_PRIVATE", false),
+
+		GitCacheDir:      getEnv("GIT_CACHE_DIR", filepath.Join(os.TempDir(), "codemap-git-cache")),
+		GitCacheMaxBytes: int64(getEnvInt("GIT_CACHE_MAX_MB", 10240)) << 20,
+
+		JobWorkers:       getEnvInt("JOB_WORKERS", 2),
+		JobQueueSize:     getEnvInt("JOB_QUEUE_SIZE", 100),
+		SchedulerEnabled: getEnvBool("SCHEDULER_ENABLED", true),
+
+		ArchiveMaxBytes:     int64(getEnvInt("ARCHIVE_MAX_MB", 2048)) << 20,
+		ArchiveMaxFileBytes: int64(getEnvInt("ARCHIVE_MAX_FILE_MB", 100)) << 20,
+		ArchiveMaxEntries:   getEnvInt("ARCHIVE_MAX_ENTRIES", 100000),
+		ArchiveMaxRatio:     getEnvInt("ARCHIVE_MAX_RATIO", 100),
+
+		UploadDir:      getEnv("UPLOAD_DIR", filepath.Join(os.TempDir(), "codemap-uploads")),
+		UploadMaxBytes: int64(getEnvInt("UPLOAD_MAX_MB", 10240)) << 20,
+		UploadExpiry:   getEnvDuration("UPLOAD_EXPIRY", 24*time.Hour),
+		PresignExpiry:  getEnvDuration("PRESIGN_EXPIRY", time.Hour),
+
+		AuditLogDir: getEnv("AUDIT_LOG_DIR", ""),
+
+		RetentionKeepSnapshots: getEnvInt("RETENTION_KEEP_SNAPSHOTS", 50),
+		RetentionMaxAge:        getEnvDuration("RETENTION_MAX_AGE", 0),
+		RetentionMaxBytes:      int64(getEnvInt("RETENTION_MAX_MB", 0)) << 20,
+		GCInterval:             getEnvDuration("GC_INTERVAL", time.Hour),
+		GCGracePeriod:          getEnvDuration("GC_GRACE_PERIOD", 24*time.Hour),
+
+		AuthEnabled:          getEnvBool("AUTH_ENABLED", true),
+		AuthBootstrapKeyHash: getEnv("AUTH_BOOTSTRAP_KEY_SHA256", ""),
+		JWTSecret:            getEnv("JWT_SECRET", ""),
+		JWTPublicKeyFile:     getEnv("JWT_PUBLIC_KEY_FILE", ""),
+		JWTIssuer:            getEnv("JWT_ISSUER", ""),
+		JWTAudience:          getEnv("JWT_AUDIENCE", ""),
+
+		QueryMaxCost:       getEnvInt("QUERY_MAX_COST", 10000000),
+		QueryMaxRows:       getEnvInt("QUERY_MAX_ROWS", 10000),
+		QueryMaxBytes:      int64(getEnvInt("QUERY_MAX_MB", 16)) << 20,
+		QueryTimeout:       getEnvDuration("QUERY_TIMEOUT", 30*time.Second),
+		QueryStreamTimeout: getEnvDuration("QUERY_STREAM_TIMEOUT", 10*time.Minute),
+		QueryCatalogs:      filepath.SplitList(getEnv("QUERY_CATALOG_FILES", "")),
+
+		SearchCacheProjects: getEnvInt("SEARCH_CACHE_PROJECTS", 32),
+
+		RateLimitEnabled:           getEnvBool("RATE_LIMIT_ENABLED", true),
+		RateLimitPerMinute:         getEnvInt("RATE_LIMIT_PER_MINUTE", 600),
+		RateLimitBurst:             getEnvInt("RATE_LIMIT_BURST", 120),
+		RateLimitAnalysisPerMinute: getEnvInt("RATE_LIMIT_ANALYSIS_PER_MINUTE", 10),
+		RateLimitAnalysisBurst:     getEnvInt("RATE_LIMIT_ANALYSIS_BURST", 5),
+		RateLimitQueryPerMinute:    getEnvInt("RATE_LIMIT_QUERY_PER_MINUTE", 60),
+		RateLimitQueryBurst:        getEnvInt("RATE_LIMIT_QUERY_BURST", 20),
+		RateLimitAuthPerMinute:     getEnvInt("RATE_LIMIT_AUTH_PER_MINUTE", 600),
+		RateLimitAuthBurst:         getEnvInt("RATE_LIMIT_AUTH_BURST", 120),
+		QuotaMaxJobs:               getEnvInt("QUOTA_MAX_JOBS", 2),
+		QuotaArchiveBytesPerDay:    int64(getEnvInt("QUOTA_ARCHIVE_MB_PER_DAY", 20480)) << 20,
+		QuotaQueryTimePerMinute:    getEnvDuration("QUOTA_QUERY_TIME_PER_MINUTE", time.Minute),
 	}
 }
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+)
+
+// CreateAPIKey stores a new API key.
+func (db *DB) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	var projects, roles []string
+	for project, role := range key.Roles {
+		projects = append(projects, project)
+		roles = append(roles, role)
+	}
+	_, err := db.write(ctx, `
+		CREATE (:APIKey {
+			id: $id, name: $name, secret_hash: $secret_hash, admin: $admin,
+			role_projects: $role_projects, role_names: $role_names,
+			created_at: $created_at
+		})
+	`, map[string]any{
+		"id":            key.ID,
+		"name":          key.Name,
+		"secret_hash":   key.SecretHash,
+		"admin":         key.Admin,
+		"role_projects": projects,
+		"role_names":    roles,
+		"created_at":    key.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKey returns an API key, including its secret hash, or ErrNotFound.
+func (db *DB) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	records, err := db.read(ctx, `MATCH (k:APIKey {id: $id}) RETURN k`, map[string]any{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key %s: %w", id, err)
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	return apiKeyFromRecord(records[0])
+}
+
+// ListAPIKeys returns every API key.
+func (db *DB) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	records, err := db.read(ctx, `MATCH (k:APIKey) RETURN k ORDER BY k.created_at`, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	keys := make([]models.APIKey, 0, len(records))
+	for _, record := range records {
+		key, err := apiKeyFromRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+// DeleteAPIKey revokes an API key. It returns ErrNotFound if there is no such key.
+func (db *DB) DeleteAPIKey(ctx context.Context, id string) error {
+	records, err := db.write(ctx, `
+		MATCH (k:APIKey {id: $id})
+		DELETE k
+		RETURN count(k) AS deleted
+	`, map[string]any{"id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete API key %s: %w", id, err)
+	}
+	if deleted, _ := records[0].AsMap()["deleted"].(int64); deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func apiKeyFromRecord(record *neo4j.Record) (*models.APIKey, error) {
+	node, _, err := neo4j.GetRecordValue[dbtype.Node](record, "k")
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string]string)
+	projects, names := propStrings(node.Props, "role_projects"), propStrings(node.Props, "role_names")
+	for i := range projects {
+		if i < len(names) {
+			roles[projects[i]] = names[i]
+		}
+	}
+	return &models.APIKey{
+		ID:         propString(node.Props, "id"),
+		Name:       propString(node.Props, "name"),
+		SecretHash: propString(node.Props, "secret_hash"),
+		Admin:      propBool(node.Props, "admin"),
+		Roles:      roles,
+		CreatedAt:  propTime(node.Props, "created_at"),
+	}, nil
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+)
+
+// The navigation queries below return one page of their result, ordered by
+// the key of the returned nodes so that pages are stable. Each reports
+// whether more records follow the page. Lists of a node's neighbours return
+// ErrNotFound if the node itself does not exist.
+
+// ListFiles returns a page of a project's files whose path starts with prefix.
+func (db *DB) ListFiles(ctx context.Context, projectID, prefix string, page QueryPage) ([]models.FileNode, bool, error) {
+	records, err := db.read(ctx, `
+		MATCH (f:File {project: $project}) WHERE f.path STARTS WITH $prefix
+		RETURN f ORDER BY f.path SKIP $skip LIMIT $limit
+	`, pageParams(page, map[string]any{"project": projectID, "prefix": prefix}))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list files of project %s: %w", projectID, err)
+	}
+	return filesFromRecords(records, page)
+}
+
+// FileImports returns a page of the files that the file at path imports.
+func (db *DB) FileImports(ctx context.Context, projectID, path string, page QueryPage) ([]models.FileNode, bool, error) {
+	return db.relatedFiles(ctx, projectID, path, `
+		MATCH (:File {project: $project, path: $path})-[:IMPORTS]->(f:File)
+		RETURN f ORDER BY f.path SKIP $skip LIMIT $limit
+	`, page)
+}
+
+// FileImporters returns a page of the files that import the file at path.
+func (db *DB) FileImporters(ctx context.Context, projectID, path string, page QueryPage) ([]models.FileNode, bool, error) {
+	return db.relatedFiles(ctx, projectID, path, `
+		MATCH (f:File)-[:IMPORTS]->(:File {project: $project, path: $path})
+		RETURN f ORDER BY f.path SKIP $skip LIMIT $limit
+	`, page)
+}
+
+func (db *DB) relatedFiles(ctx context.Context, projectID, path, cypher string, page QueryPage) ([]models.FileNode, bool, error) {
+	if err := db.requireNode(ctx, "File", "path", projectID, path); err != nil {
+		return nil, false, err
+	}
+	records, err := db.read(ctx, cypher, pageParams(page, map[string]any{"project": projectID, "path": path}))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list files related to %s: %w", path, err)
+	}
+	return filesFromRecords(records, page)
+}
+
+// GetFunction returns a function with its parameters or ErrNotFound.
+func (db *DB) GetFunction(ctx context.Context, projectID, id string) (*models.FunctionNode, error) {
+	records, err := db.read(ctx, `
+		MATCH (fn:Function {project: $project, id: $id})
+		OPTIONAL MATCH (f:File)-[:CONTAINS]->(fn)
+		RETURN fn, f.path AS file, [(fn)-[:HAS_PARAMETER]->(p) | p.name] AS params
+	`, map[string]any{"project": projectID, "id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get function %s: %w", id, err)
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	fn, err := functionFromRecord(records[0])
+	if err != nil {
+		return nil, err
+	}
+	fn.Params = propStrings(records[0].AsMap(), "params")
+	return &fn, nil
+}
+
+// FunctionCallers returns a page of the functions that call a function.
+func (db *DB) FunctionCallers(ctx context.Context, projectID, id string, page QueryPage) ([]models.FunctionNode, bool, error) {
+	return db.relatedFunctions(ctx, "Function", projectID, id, `
+		MATCH (fn:Function)-[:CALLS]->(:Function {project: $project, id: $id})
+		OPTIONAL MATCH (f:File)-[:CONTAINS]->(fn)
+		RETURN fn, f.path AS file ORDER BY fn.id SKIP $skip LIMIT $limit
+	`, page)
+}
+
+// FunctionCallees returns a page of the functions that a function calls.
+func (db *DB) FunctionCallees(ctx context.Context, projectID, id string, page QueryPage) ([]models.FunctionNode, bool, error) {
+	return db.relatedFunctions(ctx, "Function", projectID, id, `
+		MATCH (:Function {project: $project, id: $id})-[:CALLS]->(fn:Function)
+		OPTIONAL MATCH (f:File)-[:CONTAINS]->(fn)
+		RETURN fn, f.path AS file ORDER BY fn.id SKIP $skip LIMIT $limit
+	`, page)
+}
+
+// ClassMethods returns a page of the methods of a class.
+func (db *DB) ClassMethods(ctx context.Context, projectID, id string, page QueryPage) ([]models.FunctionNode, bool, error) {
+	return db.relatedFunctions(ctx, "Class", projectID, id, `
+		MATCH (:Class {project: $project, id: $id})-[:HAS_METHOD]->(fn:Function)
+		OPTIONAL MATCH (f:File)-[:CONTAINS]->(fn)
+		RETURN fn, f.path AS file ORDER BY fn.id SKIP $skip LIMIT $limit
+	`, page)
+}
+
+func (db *DB) relatedFunctions(ctx context.Context, label, projectID, id, cypher string, page QueryPage) ([]models.FunctionNode, bool, error) {
+	if err := db.requireNode(ctx, label, "id", projectID, id); err != nil {
+		return nil, false, err
+	}
+	records, err := db.read(ctx, cypher, pageParams(page, map[string]any{"project": projectID, "id": id}))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list functions related to %s: %w", id, err)
+	}
+	records, more := trimPage(records, page)
+	functions := make([]models.FunctionNode, 0, len(records))
+	for _, record := range records {
+		fn, err := functionFromRecord(record)
+		if err != nil {
+			return nil, false, err
+		}
+		functions = append(functions, fn)
+	}
+	return functions, more, nil
+}
+
+// requireNode returns ErrNotFound unless the project has a node with the
+// label whose key property has the given value. The label and key are
+// never user input.
+func (db *DB) requireNode(ctx context.Context, label, key, projectID, value string) error {
+	records, err := db.read(ctx, fmt.Sprintf(`
+		MATCH (n:%s {project: $project, %s: $value}) RETURN count(n) > 0 AS found
+	`, label, key), map[string]any{"project": projectID, "value": value})
+	if err != nil {
+		return fmt.Errorf("failed to look up %s %s: %w", label, value, err)
+	}
+	if found, _, _ := neo4j.GetRecordValue[bool](records[0], "found"); !found {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// pageParams adds the page's skip and limit to params. One record more than
+// the page holds is requested to tell whether another page follows.
+func pageParams(page QueryPage, params map[string]any) map[string]any {
+	params["skip"] = page.Offset
+	params["limit"] = page.Size + 1
+	return params
+}
+
+// trimPage drops the record fetched beyond the page and reports whether
+// there was one.
+func trimPage(records []*neo4j.Record, page QueryPage) ([]*neo4j.Record, bool) {
+	if len(records) > page.Size {
+		return records[:page.Size], true
+	}
+	return records, false
+}
+
+func filesFromRecords(records []*neo4j.Record, page QueryPage) ([]models.FileNode, bool, error) {
+	records, more := trimPage(records, page)
+	files := make([]models.FileNode, 0, len(records))
+	for _, record := range records {
+		node, _, err := neo4j.GetRecordValue[dbtype.Node](record, "f")
+		if err != nil {
+			return nil, false, err
+		}
+		files = append(files, models.FileNode{
+			Path:     propString(node.Props, "path"),
+			Language: propString(node.Props, "language"),
+		})
+	}
+	return files, more, nil
+}
+
+// functionFromRecord reads a function from the fn and file values of a record.
+func functionFromRecord(record *neo4j.Record) (models.FunctionNode, error) {
+	node, _, err := neo4j.GetRecordValue[dbtype.Node](record, "fn")
+	if err != nil {
+		return models.FunctionNode{}, err
+	}
+	// Functions outside any file would only come from a partial import
+	file, _, _ := neo4j.GetRecordValue[string](record, "file")
+	return models.FunctionNode{
+		ID:         propString(node.Props, "id"),
+		Name:       propString(node.Props, "name"),
+		File:       file,
+		IsExported: propBool(node.Props, "is_exported"),
+		IsMethodOf: propString(node.Props, "is_method_of"),
+		StartLine:  int(propInt(node.Props, "start_line")),
+		EndLine:    int(propInt(node.Props, "end_line")),
+	}, nil
+}
@@ -0,0 +1,299 @@
+package database
+
+import (
+	"codemap/backend/internal/models"
+	"codemap/backend/internal/unidiff"
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+)
+
+// DiffImpact maps changed line ranges, numbered as in the analyzed version of
+// each file, to the functions and classes that contain them and walks their
+// callers up to depth steps. A class counts as changed when a range touches
+// it outside its methods; its callers are those of its methods.
+func (db *DB) DiffImpact(ctx context.Context, projectID string, changes []unidiff.FileChange, depth int) (*models.DiffImpact, error) {
+	ranges := make(map[string][]unidiff.LineRange)
+	var changedPaths, unmapped []string
+	for _, change := range changes {
+		if change.OldPath == "" {
+			// Added files are not in the graph yet
+			unmapped = append(unmapped, change.NewPath)
+			continue
+		}
+		if _, ok := ranges[change.OldPath]; !ok {
+			changedPaths = append(changedPaths, change.OldPath)
+		}
+		ranges[change.OldPath] = append(ranges[change.OldPath], change.Ranges...)
+	}
+
+	session := db.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	out, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		impact := &models.DiffImpact{Depth: depth, Changed: []models.ChangedSymbol{}, EntryPoints: []models.ImpactNode{}}
+
+		symbols, err := collectRecords(ctx, tx, `
+			MATCH (f:File {project: $project})-[:CONTAINS]->(s)
+			WHERE f.path IN $paths AND (s:Function OR s:Class)
+			RETURN f.path AS file, s,
+			       [(s)-[:HAS_PARAMETER]->(p) | p.name] AS params,
+			       [(s)-[:HAS_METHOD]->(m) | m.id] AS methods,
+			       EXISTS { MATCH ()-[:CALLS]->(s) } AS called
+			ORDER BY file, s.start_line, s.id
+		`, map[string]any{"project": projectID, "paths": changedPaths})
+		if err != nil {
+			return nil, err
+		}
+		files, err := collectRecords(ctx, tx, `
+			MATCH (f:File {project: $project}) WHERE f.path IN $paths
+			RETURN f.path AS file
+		`, map[string]any{"project": projectID, "paths": changedPaths})
+		if err != nil {
+			return nil, err
+		}
+		inGraph := make(map[string]bool)
+		for _, record := range files {
+			inGraph[propString(record.AsMap(), "file")] = true
+		}
+		spanned := make(map[string]bool)
+
+		// Methods are matched first, so that classes only count as changed
+		// for the ranges outside them
+		type candidate struct {
+			symbol  models.ChangedSymbol
+			methods []string
+		}
+		var classes []candidate
+		spans := make(map[string][2]int)
+		changedIDs := make(map[string]bool)
+		var seeds []string
+		for _, record := range symbols {
+			values := record.AsMap()
+			node, _, err := neo4j.GetRecordValue[dbtype.Node](record, "s")
+			if err != nil {
+				return nil, err
+			}
+			symbol := models.ChangedSymbol{
+				ID:        propString(node.Props, "id"),
+				Name:      propString(node.Props, "name"),
+				File:      propString(values, "file"),
+				StartLine: int(propInt(node.Props, "start_line")),
+				EndLine:   int(propInt(node.Props, "end_line")),
+			}
+			if symbol.StartLine == 0 {
+				continue
+			}
+			spanned[symbol.File] = true
+			if slices.Contains(node.Labels, "Class") {
+				symbol.Kind = models.SymbolClass
+				classes = append(classes, candidate{symbol, propStrings(values, "methods")})
+				continue
+			}
+			spans[symbol.ID] = [2]int{symbol.StartLine, symbol.EndLine}
+			if !touches(ranges[symbol.File], symbol.StartLine, symbol.EndLine, nil) {
+				continue
+			}
+			symbol.Kind = models.SymbolFunction
+			symbol.EntryPoint = entryPoint(symbol.File, symbol.Name, propBool(node.Props, "is_exported"), propStrings(values, "params"), propBool(values, "called"))
+			impact.Changed = append(impact.Changed, symbol)
+			changedIDs[symbol.ID] = true
+			seeds = append(seeds, symbol.ID)
+		}
+		for _, class := range classes {
+			var methodSpans [][2]int
+			for _, method := range class.methods {
+				if span, ok := spans[method]; ok {
+					methodSpans = append(methodSpans, span)
+				}
+			}
+			if !touches(ranges[class.symbol.File], class.symbol.StartLine, class.symbol.EndLine, methodSpans) {
+				continue
+			}
+			impact.Changed = append(impact.Changed, class.symbol)
+			for _, method := range class.methods {
+				if !changedIDs[method] {
+					changedIDs[method] = true
+					seeds = append(seeds, method)
+				}
+			}
+		}
+		for _, file := range changedPaths {
+			if !inGraph[file] || !spanned[file] {
+				unmapped = append(unmapped, file)
+			}
+		}
+		impact.UnmappedFiles = unmapped
+		if impact.UnmappedFiles == nil {
+			impact.UnmappedFiles = []string{}
+		}
+
+		seen := make(map[string]bool)
+		for _, id := range seeds {
+			seen[id] = true
+		}
+		callers, truncated, err := walkImpact(ctx, tx, projectID, models.SymbolFunction, models.ImpactUp, seeds, depth, seen)
+		if err != nil {
+			return nil, err
+		}
+		summary := &models.Impact{Nodes: callers}
+		summarizeImpact(summary)
+		impact.Callers, impact.Files, impact.Packages = summary.Nodes, summary.Files, summary.Packages
+		impact.Truncated = truncated
+
+		for _, symbol := range impact.Changed {
+			if symbol.EntryPoint != "" {
+				impact.EntryPoints = append(impact.EntryPoints, models.ImpactNode{
+					Kind: symbol.Kind, ID: symbol.ID, Name: symbol.Name, File: symbol.File,
+					Package: path.Dir(symbol.File), EntryPoint: symbol.EntryPoint,
+				})
+			}
+		}
+		for _, caller := range impact.Callers {
+			if caller.EntryPoint != "" {
+				impact.EntryPoints = append(impact.EntryPoints, caller)
+			}
+		}
+
+		impact.Tests, err = candidateTests(ctx, tx, projectID, changes, impact, depth)
+		if err != nil {
+			return nil, err
+		}
+		return impact, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze impact of change set: %w", err)
+	}
+	return out.(*models.DiffImpact), nil
+}
+
+// touches reports whether any of ranges overlaps the span from start to end
+// outside the given inner spans.
+func touches(ranges []unidiff.LineRange, start, end int, inner [][2]int) bool {
+	for _, r := range ranges {
+		if !r.Overlaps(start, end) {
+			continue
+		}
+		within := false
+		for _, span := range inner {
+			if r.Start >= span[0] && r.End <= span[1] {
+				within = true
+				break
+			}
+		}
+		if !within {
+			return true
+		}
+	}
+	return false
+}
+
+// candidateTests returns the test files that changed, call changed functions
+// or import changed files, directly or up to depth steps away, or that are
+// named after a changed file.
+func candidateTests(ctx context.Context, tx neo4j.ManagedTransaction, projectID string, changes []unidiff.FileChange, impact *models.DiffImpact, depth int) ([]models.TestCandidate, error) {
+	reasons := make(map[string][]string)
+	add := func(file, reason string) {
+		if isTestFile(file) && !slices.Contains(reasons[file], reason) {
+			reasons[file] = append(reasons[file], reason)
+		}
+	}
+
+	var changedFiles, namedTests []string
+	for _, change := range changes {
+		for _, file := range []string{change.OldPath, change.NewPath} {
+			if file == "" {
+				continue
+			}
+			add(file, models.TestChanged)
+			if !slices.Contains(changedFiles, file) {
+				changedFiles = append(changedFiles, file)
+				namedTests = append(namedTests, testNamesFor(file)...)
+			}
+		}
+	}
+	for _, caller := range impact.Callers {
+		add(caller.File, models.TestCalls)
+	}
+
+	seen := make(map[string]bool)
+	for _, file := range changedFiles {
+		seen[file] = true
+	}
+	importers, _, err := walkImpact(ctx, tx, projectID, models.SymbolFile, models.ImpactUp, changedFiles, depth, seen)
+	if err != nil {
+		return nil, err
+	}
+	for _, importer := range importers {
+		add(importer.File, models.TestImports)
+	}
+
+	records, err := collectRecords(ctx, tx, `
+		MATCH (f:File {project: $project}) WHERE f.path IN $paths
+		RETURN f.path AS file
+	`, map[string]any{"project": projectID, "paths": namedTests})
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		add(propString(record.AsMap(), "file"), models.TestName)
+	}
+
+	tests := make([]models.TestCandidate, 0, len(reasons))
+	for file, why := range reasons {
+		tests = append(tests, models.TestCandidate{File: file, Reasons: why})
+	}
+	sort.Slice(tests, func(i, j int) bool { return tests[i].File < tests[j].File })
+	return tests, nil
+}
+
+// isTestFile reports whether a path follows a common test file convention.
+func isTestFile(file string) bool {
+	base := path.Base(file)
+	name := strings.TrimSuffix(base, path.Ext(base))
+	switch {
+	case strings.HasSuffix(name, "_test"), strings.HasPrefix(name, "test_"),
+		strings.HasSuffix(name, ".test"), strings.HasSuffix(name, ".spec"),
+		strings.HasSuffix(name, "Test"), strings.HasSuffix(name, "Tests"):
+		return true
+	}
+	for _, dir := range strings.Split(path.Dir(file), "/") {
+		switch dir {
+		case "test", "tests", "__tests__", "spec":
+			return true
+		}
+	}
+	return false
+}
+
+// testNamesFor returns the paths that tests of a file are conventionally
+// given.
+func testNamesFor(file string) []string {
+	dir, base := path.Split(file)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	return []string{
+		dir + name + "_test" + ext,
+		dir + "test_" + base,
+		dir + name + ".test" + ext,
+		dir + name + ".spec" + ext,
+		dir + name + "Test" + ext,
+		dir + "__tests__/" + name + ".test" + ext,
+		dir + "tests/test_" + base,
+	}
+}
+
+// collectRecords runs a query in tx and returns its records.
+func collectRecords(ctx context.Context, tx neo4j.ManagedTransaction, cypher string, params map[string]any) ([]*neo4j.Record, error) {
+	res, err := tx.Run(ctx, cypher, params)
+	if err != nil {
+		return nil, err
+	}
+	return res.Collect(ctx)
+}
@@ -0,0 +1,399 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+)
+
+// Result formats of gated queries.
+const (
+	// FormatRaw returns each record as the driver encodes it.
+	FormatRaw = "raw"
+	// FormatTable flattens records into rows of scalars aligned to columns.
+	FormatTable = "table"
+	// FormatGraph collects the nodes and relationships of all records.
+	FormatGraph = "graph"
+)
+
+// ValidFormat reports whether format is a known result format.
+func ValidFormat(format string) bool {
+	return format == FormatRaw || format == FormatTable || format == FormatGraph
+}
+
+// GraphNode is a node of a graph-shaped result.
+type GraphNode struct {
+	ID     string         `json:"id"`
+	Labels []string       `json:"labels"`
+	Props  map[string]any `json:"props"`
+}
+
+// GraphEdge is a relationship of a graph-shaped result.
+type GraphEdge struct {
+	ID     string         `json:"id"`
+	Type   string         `json:"type"`
+	Source string         `json:"source"`
+	Target string         `json:"target"`
+	Props  map[string]any `json:"props"`
+}
+
+// Graph is a deduplicated set of nodes and the relationships between them.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// NodeID returns a stable ID for a node. Code nodes are keyed by project and
+// their id or path, which survive re-imports; other nodes by their id
+// property. Nodes without either fall back to their element ID, which is only
+// stable while the node exists.
+func NodeID(node dbtype.Node) string {
+	label := ""
+	if len(node.Labels) > 0 {
+		label = node.Labels[0]
+	}
+	key, ok := node.Props["id"].(string)
+	if !ok {
+		key, ok = node.Props["path"].(string)
+	}
+	if !ok {
+		return node.ElementId
+	}
+	if project, ok := node.Props["project"].(string); ok {
+		return fmt.Sprintf("%s:%s:%s", label, project, key)
+	}
+	return fmt.Sprintf("%s:%s", label, key)
+}
+
+// resultBuilder accumulates the records of a query in one format. add returns
+// how many bytes of output the record added.
+type resultBuilder interface {
+	add(record *neo4j.Record) (int64, error)
+	finish(result *QueryResult)
+}
+
+func newResultBuilder(format string) resultBuilder {
+	switch format {
+	case FormatTable:
+		return &tableBuilder{index: make(map[string]int), rows: [][]any{}}
+	case FormatGraph:
+		return newGraphBuilder()
+	}
+	return &rawBuilder{rows: []any{}}
+}
+
+// newLineEncoder returns a function encoding each record as JSON lines in
+// format, for streaming. Table records are objects keyed by column, as the
+// columns of later records are not known yet.
+func newLineEncoder(format string) func(record *neo4j.Record) ([][]byte, error) {
+	switch format {
+	case FormatTable:
+		return func(record *neo4j.Record) ([][]byte, error) {
+			cells := make(map[string]any)
+			for i, key := range record.Keys {
+				flatten(cells, key, record.Values[i])
+			}
+			line, err := json.Marshal(cells)
+			return [][]byte{line}, err
+		}
+	case FormatGraph:
+		b := newGraphBuilder()
+		return func(record *neo4j.Record) ([][]byte, error) {
+			if _, err := b.add(record); err != nil {
+				return nil, err
+			}
+			// Only the IDs of emitted nodes and edges are kept
+			var lines [][]byte
+			for i := range b.graph.Nodes {
+				line, err := json.Marshal(graphLine{Node: &b.graph.Nodes[i]})
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, line)
+			}
+			for i := range b.graph.Edges {
+				line, err := json.Marshal(graphLine{Edge: &b.graph.Edges[i]})
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, line)
+			}
+			b.graph.Nodes, b.graph.Edges = b.graph.Nodes[:0], b.graph.Edges[:0]
+			return lines, nil
+		}
+	}
+	return func(record *neo4j.Record) ([][]byte, error) {
+		line, err := json.Marshal(record.AsMap())
+		return [][]byte{line}, err
+	}
+}
+
+// graphLine is a line of a streamed graph result.
+type graphLine struct {
+	Node *GraphNode `json:"node,omitempty"`
+	Edge *GraphEdge `json:"edge,omitempty"`
+}
+
+type rawBuilder struct {
+	rows []any
+}
+
+func (b *rawBuilder) add(record *neo4j.Record) (int64, error) {
+	row, err := json.Marshal(record.AsMap())
+	if err != nil {
+		return 0, err
+	}
+	b.rows = append(b.rows, json.RawMessage(row))
+	return int64(len(row)), nil
+}
+
+func (b *rawBuilder) finish(result *QueryResult) {
+	result.Rows = b.rows
+}
+
+// tableBuilder flattens each record into scalar cells. A node or relationship
+// in column c becomes the columns c.id, c.labels or c.type and c.<property>;
+// a map becomes c.<key>. Lists of scalars are kept as lists.
+type tableBuilder struct {
+	columns []string
+	index   map[string]int
+	rows    [][]any
+}
+
+func (b *tableBuilder) add(record *neo4j.Record) (int64, error) {
+	cells := make(map[string]any)
+	for i, key := range record.Keys {
+		flatten(cells, key, record.Values[i])
+	}
+	keys := make([]string, 0, len(cells))
+	for key := range cells {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if _, ok := b.index[key]; !ok {
+			b.index[key] = len(b.columns)
+			b.columns = append(b.columns, key)
+		}
+	}
+	row := make([]any, len(b.columns))
+	for key, value := range cells {
+		row[b.index[key]] = value
+	}
+	b.rows = append(b.rows, row)
+	encoded, err := json.Marshal(row)
+	return int64(len(encoded)), err
+}
+
+func (b *tableBuilder) finish(result *QueryResult) {
+	rows := make([]any, len(b.rows))
+	for i, row := range b.rows {
+		// Rows added before later columns appeared are padded
+		for len(row) < len(b.columns) {
+			row = append(row, nil)
+		}
+		rows[i] = row
+	}
+	// Without rows, the columns are the query's own
+	if len(b.columns) > 0 {
+		result.Columns = b.columns
+	}
+	result.Rows = rows
+}
+
+// flatten stores value under key in cells, expanding graph entities and maps.
+func flatten(cells map[string]any, key string, value any) {
+	switch v := value.(type) {
+	case dbtype.Node:
+		cells[key+".id"] = NodeID(v)
+		cells[key+".labels"] = v.Labels
+		for prop, pv := range v.Props {
+			flatten(cells, key+"."+prop, pv)
+		}
+	case dbtype.Relationship:
+		cells[key+".id"] = v.ElementId
+		cells[key+".type"] = v.Type
+		for prop, pv := range v.Props {
+			flatten(cells, key+"."+prop, pv)
+		}
+	case map[string]any:
+		for k, mv := range v {
+			flatten(cells, key+"."+k, mv)
+		}
+	default:
+		cells[key] = scalar(value)
+	}
+}
+
+// scalar converts driver values that don't encode as plain JSON.
+func scalar(value any) any {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case dbtype.Date:
+		return v.Time().Format("2006-01-02")
+	case dbtype.LocalDateTime:
+		return v.Time().Format("2006-01-02T15:04:05.999999999")
+	case dbtype.Duration:
+		return v.String()
+	case dbtype.Path:
+		ids := make([]string, len(v.Nodes))
+		for i, node := range v.Nodes {
+			ids[i] = NodeID(node)
+		}
+		return ids
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = scalar(item)
+		}
+		return list
+	}
+	return value
+}
+
+// graphBuilder collects nodes and relationships from anywhere in a record,
+// including paths, lists and maps, and ignores other values. Relationships
+// whose end nodes are not part of the result are left out, as they could not
+// be referred to by stable IDs.
+type graphBuilder struct {
+	graph *Graph
+	nodes map[string]bool
+	edges map[string]bool
+	// elementID maps element IDs to stable node IDs, so relationships can
+	// refer to nodes by the latter.
+	elementID map[string]string
+	// pending are relationships whose end nodes have not been seen yet.
+	pending []dbtype.Relationship
+}
+
+func newGraphBuilder() *graphBuilder {
+	return &graphBuilder{
+		graph:     &Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}},
+		nodes:     make(map[string]bool),
+		edges:     make(map[string]bool),
+		elementID: make(map[string]string),
+	}
+}
+
+func (b *graphBuilder) add(record *neo4j.Record) (int64, error) {
+	var size int64
+	for _, value := range record.Values {
+		n, err := b.collect(value)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+func (b *graphBuilder) collect(value any) (int64, error) {
+	switch v := value.(type) {
+	case dbtype.Node:
+		return b.addNode(v)
+	case dbtype.Relationship:
+		b.pending = append(b.pending, v)
+		return b.resolve()
+	case dbtype.Path:
+		var size int64
+		for _, node := range v.Nodes {
+			n, err := b.addNode(node)
+			if err != nil {
+				return 0, err
+			}
+			size += n
+		}
+		b.pending = append(b.pending, v.Relationships...)
+		n, err := b.resolve()
+		return size + n, err
+	case []any:
+		var size int64
+		for _, item := range v {
+			n, err := b.collect(item)
+			if err != nil {
+				return 0, err
+			}
+			size += n
+		}
+		return size, nil
+	case map[string]any:
+		var size int64
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			n, err := b.collect(v[key])
+			if err != nil {
+				return 0, err
+			}
+			size += n
+		}
+		return size, nil
+	}
+	return 0, nil
+}
+
+func (b *graphBuilder) addNode(node dbtype.Node) (int64, error) {
+	id := NodeID(node)
+	b.elementID[node.ElementId] = id
+	if b.nodes[id] {
+		return 0, nil
+	}
+	b.nodes[id] = true
+	gn := GraphNode{ID: id, Labels: node.Labels, Props: scalarProps(node.Props)}
+	b.graph.Nodes = append(b.graph.Nodes, gn)
+	encoded, err := json.Marshal(gn)
+	if err != nil {
+		return 0, err
+	}
+	// A node returned after a relationship to it completes that relationship
+	n, err := b.resolve()
+	return int64(len(encoded)) + n, err
+}
+
+// resolve adds the pending relationships whose end nodes are known.
+func (b *graphBuilder) resolve() (int64, error) {
+	var size int64
+	remaining := b.pending[:0]
+	for _, rel := range b.pending {
+		source, okSource := b.elementID[rel.StartElementId]
+		target, okTarget := b.elementID[rel.EndElementId]
+		if !okSource || !okTarget {
+			remaining = append(remaining, rel)
+			continue
+		}
+		id := source + "|" + rel.Type + "|" + target
+		if b.edges[id] {
+			continue
+		}
+		b.edges[id] = true
+		edge := GraphEdge{ID: id, Type: rel.Type, Source: source, Target: target, Props: scalarProps(rel.Props)}
+		b.graph.Edges = append(b.graph.Edges, edge)
+		encoded, err := json.Marshal(edge)
+		if err != nil {
+			return 0, err
+		}
+		size += int64(len(encoded))
+	}
+	b.pending = remaining
+	return size, nil
+}
+
+func (b *graphBuilder) finish(result *QueryResult) {
+	result.Graph = b.graph
+}
+
+func scalarProps(props map[string]any) map[string]any {
+	out := make(map[string]any, len(props))
+	for key, value := range props {
+		out[key] = scalar(value)
+	}
+	return out
+}
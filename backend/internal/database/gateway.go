@@ -0,0 +1,326 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// QueryLimits bound what a client query may cost and return. A zero field
+// disables that limit.
+type QueryLimits struct {
+	// MaxCost caps the sum of the planner's row estimates over all operators.
+	MaxCost float64
+	// MaxRows and MaxBytes cap the rows returned and their size as JSON.
+	MaxRows  int
+	MaxBytes int64
+	// Timeout is enforced by the server as well as by the context.
+	Timeout time.Duration
+}
+
+// QueryPage selects a window of a query's records: those after the first
+// Offset, at most Size of them. A zero Size returns every remaining record
+// the limits allow.
+type QueryPage struct {
+	Offset int
+	Size   int
+}
+
+// QueryResult is the outcome of a gated query. Depending on the format, Rows
+// holds each record as the driver encodes it or flattened to scalars, or
+// Graph holds the nodes and edges of all records.
+type QueryResult struct {
+	Format  string   `json:"format"`
+	Columns []string `json:"columns"`
+	Rows    any      `json:"rows,omitempty"`
+	*Graph
+	// Truncated is set when a limit stopped the query early; TruncatedBy
+	// names it ("rows" or "bytes").
+	Records     int    `json:"records"`
+	Truncated   bool   `json:"truncated"`
+	TruncatedBy string `json:"truncated_by,omitempty"`
+	// Offset is the position of the first record in the full result. More
+	// is set when records remain after the returned ones; NextCursor is left
+	// for the API to fill in.
+	Offset     int     `json:"offset"`
+	More       bool    `json:"has_more"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	Bytes      int64   `json:"bytes"`
+	Cost       float64 `json:"estimated_cost"`
+	PlanMS     int64   `json:"plan_ms"`
+	ExecMS     int64   `json:"exec_ms"`
+}
+
+// QueryRejectedError is returned for queries the gateway refuses to run.
+type QueryRejectedError struct {
+	Reason string
+}
+
+func (e *QueryRejectedError) Error() string {
+	return "query rejected: " + e.Reason
+}
+
+// forbiddenOperators are plan operators a client query may not use: procedure
+// calls can reach anything on the server and LOAD CSV reads files and URLs.
+var forbiddenOperators = map[string]string{
+	"ProcedureCall": "procedure calls are not allowed",
+	"LoadCSV":       "LOAD CSV is not allowed",
+}
+
+// GatedQuery validates an untrusted Cypher query with EXPLAIN and runs it in a
+// read transaction within limits, returning a page of the result in format.
+// Only read-only queries whose plan stays within the cost budget are run;
+// rows are streamed until the page is full or a limit is reached and the rest
+// of the result is discarded.
+func (db *DB) GatedQuery(ctx context.Context, cypher string, params map[string]any, format string, page QueryPage, limits QueryLimits) (*QueryResult, error) {
+	if format == "" {
+		format = FormatRaw
+	}
+	ctx, cancel, txConfig := withQueryTimeout(ctx, limits.Timeout)
+	defer cancel()
+
+	session := db.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	out, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		result := &QueryResult{Format: format, Offset: page.Offset}
+		// One record more than the page holds tells if there are more
+		fetch := page.Size
+		if limits.MaxRows > 0 && (fetch == 0 || limits.MaxRows < fetch) {
+			fetch = limits.MaxRows
+		}
+		if fetch > 0 {
+			fetch++
+		}
+		res, err := runGated(ctx, tx, cypher, params, page.Offset, fetch, limits, result)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		builder := newResultBuilder(format)
+		for res.Next(ctx) {
+			if page.Size > 0 && result.Records >= page.Size {
+				result.More = true
+				break
+			}
+			if limits.MaxRows > 0 && result.Records >= limits.MaxRows {
+				result.Truncated, result.TruncatedBy, result.More = true, "rows", true
+				break
+			}
+			size, err := builder.add(res.Record())
+			if err != nil {
+				return nil, err
+			}
+			result.Records++
+			result.Bytes += size
+			// The record that crossed the limit is kept, as it has been built
+			if limits.MaxBytes > 0 && result.Bytes > limits.MaxBytes {
+				result.Truncated, result.TruncatedBy = true, "bytes"
+				result.More = res.Peek(ctx)
+				break
+			}
+		}
+		if err := res.Err(); err != nil {
+			return nil, err
+		}
+		builder.finish(result)
+		result.ExecMS = time.Since(start).Milliseconds()
+		return result, nil
+	}, txConfig...)
+	if err != nil {
+		return nil, gatewayError(err)
+	}
+	return out.(*QueryResult), nil
+}
+
+// StreamQuery validates and runs a query like GatedQuery, but passes each
+// record to emit as JSON lines in format as it arrives instead of collecting
+// the result, which holds only the totals. Records before offset are skipped
+// by the server.
+// Graph records become {"node": ...} and {"edge": ...} lines for the nodes
+// and edges not emitted before.
+//
+// The query runs in an explicit transaction, as a managed one could be
+// retried after records were emitted. Once emit has been called, an error
+// leaves the output incomplete.
+func (db *DB) StreamQuery(ctx context.Context, cypher string, params map[string]any, format string, offset int, limits QueryLimits, emit func(line []byte) error) (*QueryResult, error) {
+	if format == "" {
+		format = FormatRaw
+	}
+	ctx, cancel, txConfig := withQueryTimeout(ctx, limits.Timeout)
+	defer cancel()
+
+	session := db.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+	tx, err := session.BeginTransaction(ctx, txConfig...)
+	if err != nil {
+		return nil, gatewayError(err)
+	}
+	defer tx.Close(ctx)
+
+	result := &QueryResult{Format: format, Offset: offset}
+	fetch := 0
+	if limits.MaxRows > 0 {
+		fetch = limits.MaxRows + 1
+	}
+	res, err := runGated(ctx, tx, cypher, params, offset, fetch, limits, result)
+	if err != nil {
+		return nil, gatewayError(err)
+	}
+	start := time.Now()
+	encode := newLineEncoder(format)
+	for res.Next(ctx) {
+		if limits.MaxRows > 0 && result.Records >= limits.MaxRows {
+			result.Truncated, result.TruncatedBy, result.More = true, "rows", true
+			break
+		}
+		lines, err := encode(res.Record())
+		if err != nil {
+			return nil, gatewayError(err)
+		}
+		for _, line := range lines {
+			if err := emit(line); err != nil {
+				return nil, err
+			}
+			result.Bytes += int64(len(line))
+		}
+		result.Records++
+		if limits.MaxBytes > 0 && result.Bytes > limits.MaxBytes {
+			result.Truncated, result.TruncatedBy = true, "bytes"
+			result.More = res.Peek(ctx)
+			break
+		}
+	}
+	if err := res.Err(); err != nil {
+		return nil, gatewayError(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, gatewayError(err)
+	}
+	result.ExecMS = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// queryRunner is a transaction a gated query can run in.
+type queryRunner interface {
+	Run(ctx context.Context, cypher string, params map[string]any) (neo4j.ResultWithContext, error)
+}
+
+// runGated explains the query to check that it may run, recording its cost
+// and planning time in result, and then starts it, skipping offset records
+// and returning at most fetch, if positive.
+func runGated(ctx context.Context, tx queryRunner, cypher string, params map[string]any, offset, fetch int, limits QueryLimits, result *QueryResult) (neo4j.ResultWithContext, error) {
+	start := time.Now()
+	explain, err := tx.Run(ctx, "EXPLAIN "+cypher, params)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := explain.Keys()
+	if err != nil {
+		return nil, err
+	}
+	summary, err := explain.Consume(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if summary.StatementType() != neo4j.StatementTypeReadOnly {
+		return nil, &QueryRejectedError{Reason: "only read-only queries are allowed"}
+	}
+	if summary.Plan() == nil {
+		return nil, &QueryRejectedError{Reason: "the query could not be planned"}
+	}
+	if result.Cost, err = checkPlan(summary.Plan()); err != nil {
+		return nil, err
+	}
+	if limits.MaxCost > 0 && result.Cost > limits.MaxCost {
+		return nil, &QueryRejectedError{Reason: fmt.Sprintf("estimated cost %.0f exceeds the budget of %.0f", result.Cost, limits.MaxCost)}
+	}
+	result.PlanMS = time.Since(start).Milliseconds()
+
+	if offset > 0 || fetch > 0 {
+		cypher, params = windowQuery(cypher, params, columns, offset, fetch)
+	}
+	res, err := tx.Run(ctx, cypher, params)
+	if err != nil {
+		return nil, err
+	}
+	if result.Columns, err = res.Keys(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Parameters of the window windowQuery adds to a query.
+const (
+	skipParam  = "codemap_skip"
+	limitParam = "codemap_limit"
+)
+
+// windowQuery wraps a query in a subquery whose records the server skips and
+// limits, so that pages deep into a result do not make the client read every
+// record before them. The columns keep their names and order. fetch is not
+// applied unless positive.
+func windowQuery(cypher string, params map[string]any, columns []string, offset, fetch int) (string, map[string]any) {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = "`" + strings.ReplaceAll(column, "`", "``") + "`"
+	}
+	windowed := make(map[string]any, len(params)+2)
+	for name, value := range params {
+		windowed[name] = value
+	}
+	windowed[skipParam] = offset
+
+	var b strings.Builder
+	b.WriteString("CALL {\n")
+	b.WriteString(cypher)
+	b.WriteString("\n}\nRETURN ")
+	b.WriteString(strings.Join(quoted, ", "))
+	b.WriteString(" SKIP $" + skipParam)
+	if fetch > 0 {
+		b.WriteString(" LIMIT $" + limitParam)
+		windowed[limitParam] = fetch
+	}
+	return b.String(), windowed
+}
+
+// withQueryTimeout bounds ctx by timeout, if set, and returns the matching
+// transaction timeout for the server.
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc, []func(*neo4j.TransactionConfig)) {
+	if timeout <= 0 {
+		return ctx, func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, []func(*neo4j.TransactionConfig){neo4j.WithTxTimeout(timeout)}
+}
+
+func gatewayError(err error) error {
+	var rejected *QueryRejectedError
+	if errors.As(err, &rejected) {
+		return rejected
+	}
+	return fmt.Errorf("failed during query execution: %w", err)
+}
+
+// checkPlan rejects plans with forbidden operators and returns the sum of the
+// planner's row estimates.
+func checkPlan(plan neo4j.Plan) (float64, error) {
+	// Operators are reported as e.g. "ProcedureCall@neo4j"
+	operator, _, _ := strings.Cut(plan.Operator(), "@")
+	if reason, ok := forbiddenOperators[operator]; ok {
+		return 0, &QueryRejectedError{Reason: reason}
+	}
+	cost, _ := plan.Arguments()["EstimatedRows"].(float64)
+	for _, child := range plan.Children() {
+		c, err := checkPlan(child)
+		if err != nil {
+			return 0, err
+		}
+		cost += c
+	}
+	return cost, nil
+}
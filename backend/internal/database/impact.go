@@ -0,0 +1,293 @@
+package database
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+)
+
+// maxImpactNodes caps the nodes an impact analysis returns.
+const maxImpactNodes = 5000
+
+// symbolKeys are the label and key property of each kind of symbol.
+var symbolKeys = map[string][2]string{
+	models.SymbolFunction: {"Function", "id"},
+	models.SymbolClass:    {"Class", "id"},
+	models.SymbolFile:     {"File", "path"},
+}
+
+// SymbolKind returns the kind of the symbol with the given function or class
+// ID or file path, or ErrNotFound. If kind is set, only that kind is looked
+// up; otherwise functions take precedence over classes with the same ID.
+func (db *DB) SymbolKind(ctx context.Context, projectID, id, kind string) (string, error) {
+	if kind != "" {
+		keys, ok := symbolKeys[kind]
+		if !ok {
+			return "", fmt.Errorf("unknown symbol kind %q", kind)
+		}
+		return kind, db.requireNode(ctx, keys[0], keys[1], projectID, id)
+	}
+	records, err := db.read(ctx, `
+		RETURN EXISTS { MATCH (:Function {project: $project, id: $id}) } AS function,
+		       EXISTS { MATCH (:Class {project: $project, id: $id}) } AS class,
+		       EXISTS { MATCH (:File {project: $project, path: $id}) } AS file
+	`, map[string]any{"project": projectID, "id": id})
+	if err != nil {
+		return "", fmt.Errorf("failed to look up symbol %s: %w", id, err)
+	}
+	values := records[0].AsMap()
+	for _, kind := range []string{models.SymbolFunction, models.SymbolClass, models.SymbolFile} {
+		if found, _ := values[kind].(bool); found {
+			return kind, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// impactSteps are the queries that take one step from a frontier of node
+// keys, by kind of node and direction. Each returns the next nodes with the
+// frontier node they were reached from, ordered so that the first record of
+// a node names the lowest such key.
+var impactSteps = map[string]map[string]string{
+	models.SymbolFunction: {
+		models.ImpactUp: `
+			UNWIND $frontier AS via
+			MATCH (next:Function)-[:CALLS]->(:Function {project: $project, id: via})
+			` + impactFunctionReturn,
+		models.ImpactDown: `
+			UNWIND $frontier AS via
+			MATCH (:Function {project: $project, id: via})-[:CALLS]->(next:Function)
+			` + impactFunctionReturn,
+	},
+	models.SymbolFile: {
+		models.ImpactUp: `
+			UNWIND $frontier AS via
+			MATCH (next:File)-[:IMPORTS]->(:File {project: $project, path: via})
+			` + impactFileReturn,
+		models.ImpactDown: `
+			UNWIND $frontier AS via
+			MATCH (:File {project: $project, path: via})-[:IMPORTS]->(next:File)
+			` + impactFileReturn,
+	},
+}
+
+const impactFunctionReturn = `
+	OPTIONAL MATCH (f:File)-[:CONTAINS]->(next)
+	RETURN DISTINCT via, next, f.path AS file,
+	       [(next)-[:HAS_PARAMETER]->(p) | p.name] AS params,
+	       EXISTS { MATCH ()-[:CALLS]->(next) } AS called
+	ORDER BY next.id, via
+`
+
+const impactFileReturn = `
+	RETURN DISTINCT via, next,
+	       EXISTS { MATCH (next)-[:CONTAINS]->(:Function {name: 'main'}) } AS has_main
+	ORDER BY next.path, via
+`
+
+// Impact walks the CALLS or IMPORTS edges from a symbol up to depth steps in
+// direction, breadth first, so every node is reported at its shortest
+// distance. The symbol must exist and be of the given kind.
+func (db *DB) Impact(ctx context.Context, projectID, kind, id, direction string, depth int) (*models.Impact, error) {
+	session := db.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	out, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		impact := &models.Impact{Kind: kind, Symbol: id, Direction: direction, Depth: depth, Nodes: []models.ImpactNode{}}
+
+		// Classes are impacted through their methods
+		frontier := []string{id}
+		nodeKind := kind
+		if kind == models.SymbolClass {
+			nodeKind = models.SymbolFunction
+			records, err := collectRecords(ctx, tx, `
+				MATCH (:Class {project: $project, id: $id})-[:HAS_METHOD]->(fn:Function)
+				RETURN fn.id AS id ORDER BY id
+			`, map[string]any{"project": projectID, "id": id})
+			if err != nil {
+				return nil, err
+			}
+			frontier = frontier[:0]
+			for _, record := range records {
+				methodID, _, _ := neo4j.GetRecordValue[string](record, "id")
+				frontier = append(frontier, methodID)
+			}
+		}
+
+		seen := make(map[string]bool)
+		for _, key := range frontier {
+			seen[key] = true
+		}
+		nodes, truncated, err := walkImpact(ctx, tx, projectID, nodeKind, direction, frontier, depth, seen)
+		if err != nil {
+			return nil, err
+		}
+		impact.Nodes, impact.Truncated = nodes, truncated
+		summarizeImpact(impact)
+		return impact, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze impact of %s: %w", id, err)
+	}
+	return out.(*models.Impact), nil
+}
+
+// walkImpact returns the nodes of a kind up to depth steps from frontier in
+// direction, with their distance, breadth first. Nodes in seen are skipped
+// and the returned ones added to it. It stops once maxImpactNodes are found
+// and reports if that left nodes out.
+func walkImpact(ctx context.Context, tx neo4j.ManagedTransaction, projectID, kind, direction string, frontier []string, depth int, seen map[string]bool) ([]models.ImpactNode, bool, error) {
+	nodes := []models.ImpactNode{}
+	step := impactSteps[kind][direction]
+	for d := 1; d <= depth && len(frontier) > 0; d++ {
+		records, err := collectRecords(ctx, tx, step, map[string]any{"project": projectID, "frontier": frontier})
+		if err != nil {
+			return nil, false, err
+		}
+		frontier = nil
+		for _, record := range records {
+			node, err := impactNodeFromRecord(record, kind)
+			if err != nil {
+				return nil, false, err
+			}
+			if seen[node.ID] {
+				continue
+			}
+			if len(nodes) >= maxImpactNodes {
+				return nodes, true, nil
+			}
+			seen[node.ID] = true
+			node.Depth = d
+			nodes = append(nodes, node)
+			frontier = append(frontier, node.ID)
+		}
+	}
+	return nodes, false, nil
+}
+
+func impactNodeFromRecord(record *neo4j.Record, kind string) (models.ImpactNode, error) {
+	next, _, err := neo4j.GetRecordValue[dbtype.Node](record, "next")
+	if err != nil {
+		return models.ImpactNode{}, err
+	}
+	values := record.AsMap()
+	node := models.ImpactNode{Kind: kind, Via: propString(values, "via")}
+	if kind == models.SymbolFile {
+		node.ID = propString(next.Props, "path")
+		node.Name = path.Base(node.ID)
+		node.File = node.ID
+		if propBool(values, "has_main") && !isTestFile(node.ID) {
+			node.EntryPoint = models.EntryMain
+		}
+	} else {
+		node.ID = propString(next.Props, "id")
+		node.Name = propString(next.Props, "name")
+		node.File = propString(values, "file")
+		node.EntryPoint = entryPoint(node.File, node.Name, propBool(next.Props, "is_exported"), propStrings(values, "params"), propBool(values, "called"))
+	}
+	node.Package = path.Dir(node.File)
+	return node, nil
+}
+
+// entryPoint returns how outside code reaches a function, if it does: as the
+// program's main function, as an HTTP handler, or as an exported function
+// that nothing in the project calls. The graph has no types, so main
+// functions and handlers are recognized by the conventions of the file's
+// language: its name for main, and the parameters of the web APIs usual for
+// it for handlers. Functions of test files are only reached by test runners,
+// so they are never entry points.
+func entryPoint(file, name string, exported bool, params []string, called bool) string {
+	if isTestFile(file) {
+		return ""
+	}
+	switch ext := path.Ext(file); {
+	case name == "main" && slices.Contains(mainLanguages, ext):
+		return models.EntryMain
+	case handlerParams(ext, name, params):
+		return models.EntryHTTPHandler
+	case exported && !called:
+		return models.EntryExported
+	}
+	return ""
+}
+
+// mainLanguages are the extensions of languages whose programs start at a
+// function named main.
+var mainLanguages = []string{".go", ".c", ".cpp", ".h", ".hpp", ".java", ".kt", ".kts", ".dart"}
+
+// handlerParams reports whether a function takes the parameters of an HTTP
+// handler in the language of ext: net/http's (w, r) in Go, Express's
+// (req, res) in JavaScript and TypeScript, Django's request in Python and a
+// servlet's doGet and the like in Java and Kotlin.
+func handlerParams(ext, name string, params []string) bool {
+	switch ext {
+	case ".go":
+		return len(params) == 2 && slices.Contains(params, "w") && slices.Contains(params, "r")
+	case ".js", ".mjs", ".jsx", ".ts", ".tsx":
+		return len(params) >= 2 && len(params) <= 3 && params[0] == "req" && params[1] == "res"
+	case ".py":
+		return slices.Contains(params, "request") && (params[0] == "request" || params[0] == "self" && params[1] == "request")
+	case ".java", ".kt", ".kts":
+		switch name {
+		case "doGet", "doPost", "doPut", "doDelete", "doPatch", "service":
+			return len(params) == 2
+		}
+	}
+	return false
+}
+
+// summarizeImpact orders the impacted nodes and groups them by file and
+// package.
+func summarizeImpact(impact *models.Impact) {
+	sort.SliceStable(impact.Nodes, func(i, j int) bool {
+		if impact.Nodes[i].Depth != impact.Nodes[j].Depth {
+			return impact.Nodes[i].Depth < impact.Nodes[j].Depth
+		}
+		return impact.Nodes[i].ID < impact.Nodes[j].ID
+	})
+	files := make(map[string]*models.ImpactGroup)
+	packages := make(map[string]*models.ImpactGroup)
+	for _, node := range impact.Nodes {
+		if node.EntryPoint != "" {
+			impact.EntryPoints++
+		}
+		addToGroup(files, node.File, node)
+		addToGroup(packages, node.Package, node)
+	}
+	impact.Files = sortedGroups(files)
+	impact.Packages = sortedGroups(packages)
+}
+
+func addToGroup(groups map[string]*models.ImpactGroup, name string, node models.ImpactNode) {
+	group, ok := groups[name]
+	if !ok {
+		group = &models.ImpactGroup{Name: name, MinDepth: node.Depth}
+		groups[name] = group
+	}
+	group.Nodes++
+	group.MinDepth = min(group.MinDepth, node.Depth)
+	if node.EntryPoint != "" {
+		group.EntryPoints++
+	}
+}
+
+// sortedGroups returns the groups closest to the symbol first.
+func sortedGroups(groups map[string]*models.ImpactGroup) []models.ImpactGroup {
+	sorted := make([]models.ImpactGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, *group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].MinDepth != sorted[j].MinDepth {
+			return sorted[i].MinDepth < sorted[j].MinDepth
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"codemap/backend/internal/models"
+	"testing"
+)
+
+func TestEntryPoint(t *testing.T) {
+	tests := []struct {
+		file     string
+		name     string
+		exported bool
+		params   []string
+		called   bool
+		want     string
+	}{
+		{"cmd/api/main.go", "main", false, nil, false, models.EntryMain},
+		{"src/main.cpp", "main", false, []string{"argc", "argv"}, false, models.EntryMain},
+		{"scripts/build.js", "main", false, nil, true, ""},
+		{"scripts/build.py", "main", false, nil, true, ""},
+		{"cmd/api/handlers.go", "uploadHandler", false, []string{"w", "r"}, true, models.EntryHTTPHandler},
+		{"cmd/api/routes.go", "errorHandler", false, []string{"err"}, true, ""},
+		{"src/routes/users.js", "list", false, []string{"req", "res", "next"}, true, models.EntryHTTPHandler},
+		{"src/routes/users.ts", "list", false, []string{"res", "req"}, true, ""},
+		{"app/views.py", "index", false, []string{"request"}, true, models.EntryHTTPHandler},
+		{"app/views.py", "get", false, []string{"self", "request", "pk"}, true, models.EntryHTTPHandler},
+		{"app/forms.py", "clean", false, []string{"self", "data"}, true, ""},
+		{"src/UserServlet.java", "doGet", false, []string{"req", "resp"}, true, models.EntryHTTPHandler},
+		{"internal/search/search.go", "Tokenize", true, []string{"s"}, false, models.EntryExported},
+		{"internal/search/search.go", "Tokenize", true, []string{"s"}, true, ""},
+		{"internal/search/search.go", "stem", false, []string{"word"}, false, ""},
+		// Tests are run by test runners, not reached by outside code
+		{"internal/search/search_test.go", "TestTokenize", true, []string{"t"}, false, ""},
+		{"internal/api/handlers_test.go", "handler", false, []string{"w", "r"}, false, ""},
+		{"src/__tests__/users.test.js", "main", false, nil, false, ""},
+		{"tests/test_views.py", "test_index", true, []string{"request"}, false, ""},
+	}
+	for _, tt := range tests {
+		if got := entryPoint(tt.file, tt.name, tt.exported, tt.params, tt.called); got != tt.want {
+			t.Errorf("entryPoint(%s, %s, %v, %v, %v) = %q, want %q", tt.file, tt.name, tt.exported, tt.params, tt.called, got, tt.want)
+		}
+	}
+}
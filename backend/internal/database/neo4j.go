@@ -5,6 +5,8 @@ import (
 	"codemap/backend/internal/models"
 	"context"
 	"fmt"
+	"path"
+	"strings"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
@@ -31,7 +33,35 @@ func NewDB(cfg *config.AppConfig) (*DB, error) {
 	}
 
 	fmt.Println("Successfully connected to Neo4j.")
-	return &DB{Driver: driver}, nil
+	db := &DB{Driver: driver}
+	if err := db.ensureIndexes(context.Background()); err != nil {
+		driver.Close(context.Background())
+		return nil, err
+	}
+	return db, nil
+}
+
+// indexes are created when the server starts, unless they exist.
+var indexes = []string{
+	// The latest snapshot of a project is looked up on every upload to skip
+	// analyzing the same archive twice
+	`CREATE INDEX snapshot_project IF NOT EXISTS FOR (s:Snapshot) ON (s.project, s.created_at)`,
+}
+
+// ensureIndexes creates the indexes the server's lookups rely on.
+func (db *DB) ensureIndexes(ctx context.Context) error {
+	session := db.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+	for _, index := range indexes {
+		res, err := session.Run(ctx, index, nil)
+		if err == nil {
+			_, err = res.Consume(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("could not create neo4j index: %w", err)
+		}
+	}
+	return nil
 }
 
 // Query executes a read-only Cypher query and returns the results as a slice of maps, which is ready to be converted to JSON.
@@ -54,7 +84,7 @@ func (db *DB) Query(ctx context.Context, cypher string, params map[string]any) (
 		for _, record := range records {
 			results = append(results, record.AsMap())
 		}
-		
+
 		return results, nil
 	})
 
@@ -65,30 +95,50 @@ func (db *DB) Query(ctx context.Context, cypher string, params map[string]any) (
 	return result.([]map[string]any), nil
 }
 
-// ImportAnalysis imports the entire analysis result into Neo4j within a single transaction.
-func (db *DB) ImportAnalysis(ctx context.Context, analysisData *models.Analysis) error {
+// codeLabels are the node labels created by ImportAnalysis. Only these are
+// cleared on re-import so that projects, snapshots and webhooks survive.
+var codeLabels = []string{"File", "Class", "Function", "Property", "Parameter", "Module"}
+
+// ImportAnalysis imports the entire analysis result of a project into Neo4j within a single transaction.
+func (db *DB) ImportAnalysis(ctx context.Context, projectID string, analysisData *models.Analysis) error {
 	session := db.Driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
 	defer session.Close(ctx)
 
 	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
-		// First, clear the existing database to ensure a fresh import
-		if _, err := tx.Run(ctx, "MATCH (n) DETACH DELETE n", nil); err != nil {
+		// First, clear the project's previous graph to ensure a fresh import
+		if _, err := tx.Run(ctx, `
+			MATCH (n {project: $project})
+			WHERE any(label IN labels(n) WHERE label IN $labels)
+			DETACH DELETE n
+		`, map[string]any{"project": projectID, "labels": codeLabels}); err != nil {
 			return nil, err
 		}
 
 		// Create all nodes
 		for _, file := range analysisData.Files {
-			if err := createNodesForFile(ctx, tx, file); err != nil {
+			if file.Skipped != "" {
+				continue
+			}
+			if err := createNodesForFile(ctx, tx, projectID, file); err != nil {
 				return nil, fmt.Errorf("failed to create nodes for file %s: %w", file.Path, err)
 			}
 		}
 
 		// Create all relationships
 		for _, file := range analysisData.Files {
-			if err := createRelationshipsForFile(ctx, tx, file); err != nil {
+			if file.Skipped != "" {
+				continue
+			}
+			if err := createRelationshipsForFile(ctx, tx, projectID, file); err != nil {
 				return nil, fmt.Errorf("failed to create relationships for file %s: %w", file.Path, err)
 			}
 		}
+
+		if len(analysisData.Modules) > 0 {
+			if err := createModules(ctx, tx, projectID, analysisData); err != nil {
+				return nil, fmt.Errorf("failed to create modules: %w", err)
+			}
+		}
 		return nil, nil
 	})
 
@@ -101,152 +151,261 @@ func (db *DB) ImportAnalysis(ctx context.Context, analysisData *models.Analysis)
 }
 
 // Helper functions for the transaction
-func createNodesForFile(ctx context.Context, tx neo4j.ManagedTransaction, file models.File) error {
-    // Create File node
-    _, err := tx.Run(ctx, `
-        MERGE (f:File {path: $path})
+func createNodesForFile(ctx context.Context, tx neo4j.ManagedTransaction, projectID string, file models.File) error {
+	// Create File node
+	_, err := tx.Run(ctx, `
+        MERGE (f:File {project: $project, path: $path})
         ON CREATE SET f.language = $language
     `, map[string]any{
-        "path":     file.Path,
-        "language": file.Language,
-    })
-    if err != nil {
-        return err
-    }
-
-    // Create Class and Property nodes
-    for _, class := range file.Classes {
-        classID := fmt.Sprintf("%s#%s", file.Path, class.Name)
-        _, err := tx.Run(ctx, `
-            MATCH (f:File {path: $filePath})
-            MERGE (c:Class {id: $classID})
+		"project":  projectID,
+		"path":     file.Path,
+		"language": file.Language,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Create Class and Property nodes. Definitions with the same ID, such as
+	// overloads, share a node whose line span covers all of them.
+	for _, class := range file.Classes {
+		classID := fmt.Sprintf("%s#%s", file.Path, class.Name)
+		_, err := tx.Run(ctx, `
+            MATCH (f:File {project: $project, path: $filePath})
+            MERGE (c:Class {project: $project, id: $classID})
             ON CREATE SET c.name = $name, c.is_exported = $is_exported
+            SET c.start_line = CASE WHEN c.start_line IS NULL OR $start_line < c.start_line THEN $start_line ELSE c.start_line END,
+                c.end_line = CASE WHEN c.end_line IS NULL OR $end_line > c.end_line THEN $end_line ELSE c.end_line END,
+                c.doc = coalesce(c.doc, $doc)
             MERGE (f)-[:CONTAINS]->(c)
         `, map[string]any{
-            "filePath":    file.Path,
-            "classID":     classID,
-            "name":        class.Name,
-            "is_exported": class.IsExported,
-        })
-        if err != nil {
-            return err
-        }
-
-        for _, propName := range class.Properties {
-            propID := fmt.Sprintf("%s::%s", classID, propName)
-            _, err := tx.Run(ctx, `
-                MATCH (c:Class {id: $classID})
-                MERGE (p:Property {id: $propID})
+			"project":     projectID,
+			"filePath":    file.Path,
+			"classID":     classID,
+			"name":        class.Name,
+			"is_exported": class.IsExported,
+			"start_line":  lineNumber(class.StartLine),
+			"end_line":    lineNumber(class.EndLine),
+			"doc":         optionalText(class.Doc),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, propName := range class.Properties {
+			propID := fmt.Sprintf("%s::%s", classID, propName)
+			_, err := tx.Run(ctx, `
+                MATCH (c:Class {project: $project, id: $classID})
+                MERGE (p:Property {project: $project, id: $propID})
                 ON CREATE SET p.name = $name
                 MERGE (c)-[:HAS_PROPERTY]->(p)
             `, map[string]any{
-                "classID": classID,
-                "propID":  propID,
-                "name":    propName,
-            })
-            if err != nil {
-                return err
-            }
-        }
-    }
-
-    // Create Function and Parameter nodes
-    for _, function := range file.Functions {
-        funcID := fmt.Sprintf("%s#%s", file.Path, function.Name)
-        _, err := tx.Run(ctx, `
-            MATCH (f:File {path: $filePath})
-            MERGE (fn:Function {id: $funcID})
+				"project": projectID,
+				"classID": classID,
+				"propID":  propID,
+				"name":    propName,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Create Function and Parameter nodes, merging definitions with the same
+	// ID like classes
+	for _, function := range file.Functions {
+		funcID := fmt.Sprintf("%s#%s", file.Path, function.Name)
+		_, err := tx.Run(ctx, `
+            MATCH (f:File {project: $project, path: $filePath})
+            MERGE (fn:Function {project: $project, id: $funcID})
             ON CREATE SET fn.name = $name, fn.is_exported = $is_exported, fn.is_method_of = $is_method_of
+            SET fn.start_line = CASE WHEN fn.start_line IS NULL OR $start_line < fn.start_line THEN $start_line ELSE fn.start_line END,
+                fn.end_line = CASE WHEN fn.end_line IS NULL OR $end_line > fn.end_line THEN $end_line ELSE fn.end_line END,
+                fn.doc = coalesce(fn.doc, $doc),
+                fn.strings = coalesce(fn.strings, []) + [s IN coalesce($strings, []) WHERE NOT s IN coalesce(fn.strings, [])]
             MERGE (f)-[:CONTAINS]->(fn)
         `, map[string]any{
-            "filePath":     file.Path,
-            "funcID":       funcID,
-            "name":         function.Name,
-            "is_exported":  function.IsExported,
-            "is_method_of": function.IsMethodOf,
-        })
-        if err != nil {
-            return err
-        }
-        
-        for _, paramName := range function.Params {
-            paramID := fmt.Sprintf("%s(%s)", funcID, paramName)
-            _, err := tx.Run(ctx, `
-                MATCH (fn:Function {id: $funcID})
-                MERGE (p:Parameter {id: $paramID})
+			"project":      projectID,
+			"filePath":     file.Path,
+			"funcID":       funcID,
+			"name":         function.Name,
+			"is_exported":  function.IsExported,
+			"is_method_of": function.IsMethodOf,
+			"start_line":   lineNumber(function.StartLine),
+			"end_line":     lineNumber(function.EndLine),
+			"doc":          optionalText(function.Doc),
+			"strings":      function.Strings,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, paramName := range function.Params {
+			paramID := fmt.Sprintf("%s(%s)", funcID, paramName)
+			_, err := tx.Run(ctx, `
+                MATCH (fn:Function {project: $project, id: $funcID})
+                MERGE (p:Parameter {project: $project, id: $paramID})
                 ON CREATE SET p.name = $name
                 MERGE (fn)-[:HAS_PARAMETER]->(p)
             `, map[string]any{
-                "funcID":  funcID,
-                "paramID": paramID,
-                "name":    paramName,
-            })
-            if err != nil {
-                return err
-            }
-        }
-    }
-    return nil
+				"project": projectID,
+				"funcID":  funcID,
+				"paramID": paramID,
+				"name":    paramName,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lineNumber returns a line number, or nil so that unknown lines from older
+// analyzers are not stored.
+func lineNumber(line int) any {
+	if line <= 0 {
+		return nil
+	}
+	return line
 }
 
-func createRelationshipsForFile(ctx context.Context, tx neo4j.ManagedTransaction, file models.File) error {
-    // Create IMPORTS relationships
-    for _, imp := range file.Imports {
-        if imp.Source != "" {
-            _, err := tx.Run(ctx, `
-                MATCH (importer:File {path: $importerPath})
-                MATCH (imported:File) WHERE imported.path ENDS WITH $importSource
+// optionalText returns text, or nil so that empty text is not stored.
+func optionalText(text string) any {
+	if text == "" {
+		return nil
+	}
+	return text
+}
+
+func createRelationshipsForFile(ctx context.Context, tx neo4j.ManagedTransaction, projectID string, file models.File) error {
+	// Create IMPORTS relationships
+	for _, imp := range file.Imports {
+		if imp.Source != "" {
+			_, err := tx.Run(ctx, `
+                MATCH (importer:File {project: $project, path: $importerPath})
+                MATCH (imported:File {project: $project}) WHERE imported.path ENDS WITH $importSource
                 MERGE (importer)-[:IMPORTS]->(imported)
             `, map[string]any{
-                "importerPath": file.Path,
-                "importSource": imp.Source,
-            })
-            if err != nil {
-                return err
-            }
-        }
-    }
-
-    // Create HAS_METHOD and CALLS relationships
-    for _, function := range file.Functions {
-        funcID := fmt.Sprintf("%s#%s", file.Path, function.Name)
-
-        if function.IsMethodOf != "" {
-            classID := fmt.Sprintf("%s#%s", file.Path, function.IsMethodOf)
-            _, err := tx.Run(ctx, `
-                MATCH (c:Class {id: $classID})
-                MATCH (fn:Function {id: $funcID})
+				"project":      projectID,
+				"importerPath": file.Path,
+				"importSource": imp.Source,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Create HAS_METHOD and CALLS relationships
+	for _, function := range file.Functions {
+		funcID := fmt.Sprintf("%s#%s", file.Path, function.Name)
+
+		if function.IsMethodOf != "" {
+			classID := fmt.Sprintf("%s#%s", file.Path, function.IsMethodOf)
+			_, err := tx.Run(ctx, `
+                MATCH (c:Class {project: $project, id: $classID})
+                MATCH (fn:Function {project: $project, id: $funcID})
                 MERGE (c)-[:HAS_METHOD]->(fn)
             `, map[string]any{
-                "classID": classID,
-                "funcID":  funcID,
-            })
-            if err != nil {
-                return err
-            }
-        }
-
-        for _, calledFuncName := range function.Calls {
-            _, err := tx.Run(ctx, `
-                MATCH (caller:Function {id: $callerID})
-                MATCH (callee:Function {name: $calleeName})
+				"project": projectID,
+				"classID": classID,
+				"funcID":  funcID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, calledFuncName := range function.Calls {
+			_, err := tx.Run(ctx, `
+                MATCH (caller:Function {project: $project, id: $callerID})
+                MATCH (callee:Function {project: $project, name: $calleeName})
                 MERGE (caller)-[:CALLS]->(callee)
             `, map[string]any{
-                "callerID":   funcID,
-                "calleeName": calledFuncName,
-            })
-            if err != nil {
-                // This can fail if a called function is not in our analysis, so we log it but don't stop the import.
-                fmt.Printf("Could not create CALLS relationship for %s to %s: %v\n", funcID, calledFuncName, err)
-            }
-        }
-    }
-    return nil
+				"project":    projectID,
+				"callerID":   funcID,
+				"calleeName": calledFuncName,
+			})
+			if err != nil {
+				// This can fail if a called function is not in our analysis, so we log it but don't stop the import.
+				fmt.Printf("Could not create CALLS relationship for %s to %s: %v\n", funcID, calledFuncName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// createModules records the repository and its git submodules as Module nodes.
+// Each submodule is linked to its parent module and contains the files below it.
+func createModules(ctx context.Context, tx neo4j.ManagedTransaction, projectID string, analysisData *models.Analysis) error {
+	// The repository itself is the root module with an empty path.
+	if _, err := tx.Run(ctx, `
+		MERGE (m:Module {project: $project, path: ""})
+		SET m.name = $project
+	`, map[string]any{"project": projectID}); err != nil {
+		return err
+	}
+
+	paths := []string{""}
+	for _, module := range analysisData.Modules {
+		paths = append(paths, module.Path)
+	}
+
+	for _, module := range analysisData.Modules {
+		_, err := tx.Run(ctx, `
+			MATCH (parent:Module {project: $project, path: $parentPath})
+			MERGE (m:Module {project: $project, path: $path})
+			SET m.name = $name, m.url = $url, m.commit = $commit
+			MERGE (parent)-[:HAS_SUBMODULE]->(m)
+		`, map[string]any{
+			"project":    projectID,
+			"parentPath": owningModule(paths, module.Path, false),
+			"path":       module.Path,
+			"name":       path.Base(module.Path),
+			"url":        module.URL,
+			"commit":     module.Commit,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, file := range analysisData.Files {
+		if file.Skipped != "" {
+			continue
+		}
+		_, err := tx.Run(ctx, `
+			MATCH (m:Module {project: $project, path: $modulePath})
+			MATCH (f:File {project: $project, path: $filePath})
+			MERGE (m)-[:CONTAINS]->(f)
+		`, map[string]any{
+			"project":    projectID,
+			"modulePath": owningModule(paths, file.Path, true),
+			"filePath":   file.Path,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// owningModule returns the deepest module path containing p. Unless self is
+// true, a module does not contain itself.
+func owningModule(modulePaths []string, p string, self bool) string {
+	best := ""
+	for _, mp := range modulePaths {
+		if mp == "" || (mp == p && !self) {
+			continue
+		}
+		if (p == mp || strings.HasPrefix(p, mp+"/")) && len(mp) > len(best) {
+			best = mp
+		}
+	}
+	return best
 }
 
 // Close gracefully closes the database driver.
 func (db *DB) Close(ctx context.Context) {
 	db.Driver.Close(ctx)
 }
-
-
@@ -0,0 +1,329 @@
+package database
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+)
+
+// PathRelationships are the relationships that paths between symbols may
+// follow, in the order they are preferred when several join two nodes.
+var PathRelationships = []string{"CALLS", "IMPORTS", "CONTAINS", "HAS_METHOD"}
+
+// Bounds of path searches.
+const (
+	// maxPathSearchNodes caps the nodes visited from each end of a search
+	maxPathSearchNodes = 20000
+	// maxPathSearchSteps caps the steps taken enumerating paths
+	maxPathSearchSteps = 1000000
+)
+
+// Paths returns up to k simple paths of at most maxLength steps along the via
+// relationships from one symbol to another, shortest first. Both symbols
+// must exist and be of the given kinds.
+//
+// A variable-length Cypher pattern expands every path before any can be
+// discarded, which rarely finishes on real call graphs. Instead the graph is
+// walked breadth first from the source and, against the relationships, from
+// the target, each to half of maxLength. Every relationship on a path that
+// fits is met by one of the two walks, so the paths are then enumerated in
+// memory over the relationships found.
+func (db *DB) Paths(ctx context.Context, projectID, fromKind, from, toKind, to string, via []string, maxLength, k int, timeout time.Duration) (*models.Paths, error) {
+	for _, rel := range via {
+		if !slices.Contains(PathRelationships, rel) {
+			return nil, fmt.Errorf("unknown relationship %q", rel)
+		}
+	}
+	types := strings.Join(via, "|")
+
+	ctx, cancel, txConfig := withQueryTimeout(ctx, timeout)
+	defer cancel()
+	session := db.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	out, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		paths := &models.Paths{From: from, To: to, Via: via, MaxLength: maxLength, Paths: []models.SymbolPath{}}
+		source, err := elementKey(ctx, tx, projectID, fromKind, from)
+		if err != nil {
+			return nil, err
+		}
+		target, err := elementKey(ctx, tx, projectID, toKind, to)
+		if err != nil {
+			return nil, err
+		}
+
+		edges := make(map[string]map[string]string)
+		forwardCut, err := expandPaths(graphStepper(ctx, tx, types, false), false, source, (maxLength+1)/2, edges)
+		if err != nil {
+			return nil, err
+		}
+		backwardCut, err := expandPaths(graphStepper(ctx, tx, types, true), true, target, maxLength/2, edges)
+		if err != nil {
+			return nil, err
+		}
+		found, cut := simplePaths(edges, source, target, maxLength, k)
+		paths.Truncated = forwardCut || backwardCut || cut
+		if len(found) == 0 {
+			return paths, nil
+		}
+
+		var keys []string
+		for _, p := range found {
+			keys = append(keys, p...)
+		}
+		nodes, err := describePathNodes(ctx, tx, keys)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range found {
+			symbolPath := models.SymbolPath{Length: len(p) - 1}
+			for i, key := range p {
+				symbolPath.Nodes = append(symbolPath.Nodes, nodes[key])
+				if i > 0 {
+					symbolPath.Relationships = append(symbolPath.Relationships, edges[p[i-1]][key])
+				}
+			}
+			paths.Paths = append(paths.Paths, symbolPath)
+		}
+		paths.Shortest = &paths.Paths[0]
+		return paths, nil
+	}, txConfig...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find paths from %s to %s: %w", from, to, err)
+	}
+	return out.(*models.Paths), nil
+}
+
+// elementKey returns the element ID of a symbol, by which the search refers
+// to nodes of any kind, or ErrNotFound.
+func elementKey(ctx context.Context, tx neo4j.ManagedTransaction, projectID, kind, id string) (string, error) {
+	keys := symbolKeys[kind]
+	records, err := collectRecords(ctx, tx, fmt.Sprintf(`
+		MATCH (n:%s {project: $project, %s: $id}) RETURN elementId(n) AS key
+	`, keys[0], keys[1]), map[string]any{"project": projectID, "id": id})
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 {
+		return "", ErrNotFound
+	}
+	key, _, err := neo4j.GetRecordValue[string](records[0], "key")
+	return key, err
+}
+
+// pathStep is a relationship crossed walking from one node to the next.
+type pathStep struct {
+	from, rel, to string
+}
+
+// pathStepper returns the steps that lead from the nodes of a frontier.
+type pathStepper func(frontier []string) ([]pathStep, error)
+
+// graphStepper steps along the relationships of the given types in the
+// graph, or against them if reverse is set.
+func graphStepper(ctx context.Context, tx neo4j.ManagedTransaction, types string, reverse bool) pathStepper {
+	pattern := "(n)-[rel:%s]->(next)"
+	if reverse {
+		pattern = "(n)<-[rel:%s]-(next)"
+	}
+	step := fmt.Sprintf(`
+		UNWIND $frontier AS key
+		MATCH `+pattern+` WHERE elementId(n) = key
+		RETURN key, type(rel) AS type, elementId(next) AS next
+	`, types)
+	return func(frontier []string) ([]pathStep, error) {
+		records, err := collectRecords(ctx, tx, step, map[string]any{"frontier": frontier})
+		if err != nil {
+			return nil, err
+		}
+		steps := make([]pathStep, len(records))
+		for i, record := range records {
+			values := record.AsMap()
+			steps[i] = pathStep{propString(values, "key"), propString(values, "type"), propString(values, "next")}
+		}
+		return steps, nil
+	}
+}
+
+// expandPaths walks breadth first from start up to radius steps, against
+// the relationships if reverse is set, and adds the relationships it crosses
+// to edges. It reports if maxPathSearchNodes cut the walk short.
+func expandPaths(step pathStepper, reverse bool, start string, radius int, edges map[string]map[string]string) (bool, error) {
+	seen := map[string]bool{start: true}
+	frontier := []string{start}
+	for d := 0; d < radius && len(frontier) > 0; d++ {
+		steps, err := step(frontier)
+		if err != nil {
+			return false, err
+		}
+		frontier = nil
+		for _, s := range steps {
+			if reverse {
+				addPathEdge(edges, s.to, s.from, s.rel)
+			} else {
+				addPathEdge(edges, s.from, s.to, s.rel)
+			}
+			if seen[s.to] {
+				continue
+			}
+			if len(seen) >= maxPathSearchNodes {
+				return true, nil
+			}
+			seen[s.to] = true
+			frontier = append(frontier, s.to)
+		}
+	}
+	return false, nil
+}
+
+// addPathEdge records a relationship, keeping the preferred type if several
+// join the same nodes.
+func addPathEdge(edges map[string]map[string]string, from, to, rel string) {
+	if edges[from] == nil {
+		edges[from] = make(map[string]string)
+	}
+	if current, ok := edges[from][to]; !ok || slices.Index(PathRelationships, rel) < slices.Index(PathRelationships, current) {
+		edges[from][to] = rel
+	}
+}
+
+// simplePaths returns up to k paths without repeated nodes from source to
+// target of at most maxLength edges, shortest first, and whether
+// maxPathSearchSteps stopped it before it found all it could.
+func simplePaths(edges map[string]map[string]string, source, target string, maxLength, k int) ([][]string, bool) {
+	// The distance of each node to the target prunes the search
+	reverse := make(map[string][]string)
+	for from, tos := range edges {
+		for to := range tos {
+			reverse[to] = append(reverse[to], from)
+		}
+	}
+	toTarget := map[string]int{target: 0}
+	queue := []string{target}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, prev := range reverse[node] {
+			if _, ok := toTarget[prev]; !ok {
+				toTarget[prev] = toTarget[node] + 1
+				queue = append(queue, prev)
+			}
+		}
+	}
+	shortest, ok := toTarget[source]
+	if !ok || shortest > maxLength {
+		return nil, false
+	}
+
+	// Neighbours are visited in a stable order
+	next := make(map[string][]string)
+	for from, tos := range edges {
+		for to := range tos {
+			if _, ok := toTarget[to]; ok {
+				next[from] = append(next[from], to)
+			}
+		}
+		sort.Strings(next[from])
+	}
+
+	var found [][]string
+	steps := 0
+	walk := []string{source}
+	onWalk := map[string]bool{source: true}
+	// extend finds the paths of exactly left more edges from node and
+	// reports whether the search should go on
+	var extend func(node string, left int) bool
+	extend = func(node string, left int) bool {
+		if node == target {
+			if left == 0 {
+				found = append(found, slices.Clone(walk))
+			}
+			return len(found) < k
+		}
+		for _, n := range next[node] {
+			if onWalk[n] || toTarget[n] > left-1 {
+				continue
+			}
+			if steps++; steps > maxPathSearchSteps {
+				return false
+			}
+			walk = append(walk, n)
+			onWalk[n] = true
+			more := extend(n, left-1)
+			walk = walk[:len(walk)-1]
+			delete(onWalk, n)
+			if !more {
+				return false
+			}
+		}
+		return true
+	}
+	for length := shortest; length <= maxLength; length++ {
+		if !extend(source, length) {
+			break
+		}
+	}
+	return found, steps > maxPathSearchSteps
+}
+
+// describePathNodes returns the nodes with the given element IDs by ID.
+func describePathNodes(ctx context.Context, tx neo4j.ManagedTransaction, keys []string) (map[string]models.PathNode, error) {
+	records, err := collectRecords(ctx, tx, `
+		UNWIND $keys AS key
+		MATCH (n) WHERE elementId(n) = key
+		OPTIONAL MATCH (f:File)-[:CONTAINS]->(n)
+		RETURN DISTINCT key, n, f.path AS file
+	`, map[string]any{"keys": keys})
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]models.PathNode, len(records))
+	for _, record := range records {
+		n, _, err := neo4j.GetRecordValue[dbtype.Node](record, "n")
+		if err != nil {
+			return nil, err
+		}
+		values := record.AsMap()
+		node := models.PathNode{
+			ID:   propString(n.Props, "id"),
+			Name: propString(n.Props, "name"),
+			File: propString(values, "file"),
+		}
+		node.Kind = pathNodeKind(n.Labels)
+		switch node.Kind {
+		case models.SymbolFile:
+			node.ID = propString(n.Props, "path")
+			node.Name = path.Base(node.ID)
+			node.File = node.ID
+		case models.SymbolModule:
+			// The root module's path is empty
+			node.ID = propString(n.Props, "path")
+			node.File = ""
+		}
+		nodes[propString(values, "key")] = node
+	}
+	return nodes, nil
+}
+
+// pathNodeKind returns the kind of a node on a path from its labels.
+func pathNodeKind(labels []string) string {
+	switch {
+	case slices.Contains(labels, "File"):
+		return models.SymbolFile
+	case slices.Contains(labels, "Class"):
+		return models.SymbolClass
+	case slices.Contains(labels, "Function"):
+		return models.SymbolFunction
+	case slices.Contains(labels, "Module"):
+		return models.SymbolModule
+	}
+	return models.SymbolUnknown
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"codemap/backend/internal/models"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// graph builds the edges of a path search from "from-rel->to" triples.
+func graph(triples ...string) map[string]map[string]string {
+	edges := make(map[string]map[string]string)
+	for _, t := range triples {
+		parts := strings.Split(t, "-")
+		from, rel, to := parts[0], parts[1], strings.TrimPrefix(parts[2], ">")
+		addPathEdge(edges, from, to, rel)
+	}
+	return edges
+}
+
+func TestSimplePaths(t *testing.T) {
+	diamond := graph("a-CALLS->b", "a-CALLS->c", "b-CALLS->d", "c-CALLS->d", "d-CALLS->e")
+	tests := []struct {
+		name      string
+		edges     map[string]map[string]string
+		maxLength int
+		k         int
+		want      [][]string
+	}{
+		{
+			name:      "shortest first in a stable order",
+			edges:     diamond,
+			maxLength: 5,
+			k:         10,
+			want:      [][]string{{"a", "b", "d", "e"}, {"a", "c", "d", "e"}},
+		},
+		{
+			name:      "k limits the paths",
+			edges:     diamond,
+			maxLength: 5,
+			k:         1,
+			want:      [][]string{{"a", "b", "d", "e"}},
+		},
+		{
+			name:      "too far",
+			edges:     diamond,
+			maxLength: 2,
+			k:         10,
+			want:      nil,
+		},
+		{
+			name:      "longer paths after shorter ones",
+			edges:     graph("a-CALLS->e", "a-CALLS->b", "b-CALLS->e"),
+			maxLength: 3,
+			k:         10,
+			want:      [][]string{{"a", "e"}, {"a", "b", "e"}},
+		},
+		{
+			name:      "cycles are not repeated",
+			edges:     graph("a-CALLS->b", "b-CALLS->a", "b-CALLS->c", "c-CALLS->b", "c-CALLS->e"),
+			maxLength: 10,
+			k:         10,
+			want:      [][]string{{"a", "b", "c", "e"}},
+		},
+		{
+			name:      "unreachable",
+			edges:     graph("a-CALLS->b", "e-CALLS->a"),
+			maxLength: 10,
+			k:         10,
+			want:      nil,
+		},
+	}
+	for _, tt := range tests {
+		got, cut := simplePaths(tt.edges, "a", "e", tt.maxLength, tt.k)
+		if cut {
+			t.Errorf("%s: search was cut short", tt.name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: simplePaths = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddPathEdgePrefersRelationships(t *testing.T) {
+	edges := graph("a-CONTAINS->b", "a-CALLS->b", "a-IMPORTS->b", "c-HAS_METHOD->d", "c-CONTAINS->d")
+	if got := edges["a"]["b"]; got != "CALLS" {
+		t.Errorf("a->b is %s, want CALLS", got)
+	}
+	if got := edges["c"]["d"]; got != "CONTAINS" {
+		t.Errorf("c->d is %s, want CONTAINS", got)
+	}
+}
+
+// stepper walks an in-memory graph like graphStepper and records the
+// frontiers it is asked for.
+func stepper(edges map[string]map[string]string, reverse bool, frontiers *[][]string) pathStepper {
+	return func(frontier []string) ([]pathStep, error) {
+		*frontiers = append(*frontiers, slices.Clone(frontier))
+		var steps []pathStep
+		for _, key := range frontier {
+			for from, tos := range edges {
+				for to, rel := range tos {
+					switch {
+					case !reverse && from == key:
+						steps = append(steps, pathStep{key, rel, to})
+					case reverse && to == key:
+						steps = append(steps, pathStep{key, rel, from})
+					}
+				}
+			}
+		}
+		slices.SortFunc(steps, func(a, b pathStep) int { return strings.Compare(a.from+a.to, b.from+b.to) })
+		return steps, nil
+	}
+}
+
+func TestExpandPaths(t *testing.T) {
+	g := graph("a-CALLS->b", "b-CALLS->c", "c-CALLS->d", "x-CALLS->c", "b-CALLS->a")
+	tests := []struct {
+		name      string
+		reverse   bool
+		start     string
+		radius    int
+		want      []string
+		frontiers [][]string
+	}{
+		{
+			name:      "forward",
+			start:     "a",
+			radius:    2,
+			want:      []string{"a-CALLS->b", "b-CALLS->a", "b-CALLS->c"},
+			frontiers: [][]string{{"a"}, {"b"}},
+		},
+		{
+			name:      "backward keeps the direction of relationships",
+			reverse:   true,
+			start:     "d",
+			radius:    2,
+			want:      []string{"b-CALLS->c", "c-CALLS->d", "x-CALLS->c"},
+			frontiers: [][]string{{"d"}, {"c"}},
+		},
+		{
+			name:      "stops when nothing is left",
+			start:     "c",
+			radius:    5,
+			want:      []string{"c-CALLS->d"},
+			frontiers: [][]string{{"c"}, {"d"}},
+		},
+		{
+			name:   "zero radius",
+			start:  "a",
+			radius: 0,
+		},
+	}
+	for _, tt := range tests {
+		var frontiers [][]string
+		edges := make(map[string]map[string]string)
+		cut, err := expandPaths(stepper(g, tt.reverse, &frontiers), tt.reverse, tt.start, tt.radius, edges)
+		if err != nil || cut {
+			t.Errorf("%s: expandPaths = %v, %v", tt.name, cut, err)
+		}
+		var got []string
+		for from, tos := range edges {
+			for to, rel := range tos {
+				got = append(got, from+"-"+rel+"->"+to)
+			}
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: edges = %v, want %v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(frontiers, tt.frontiers) {
+			t.Errorf("%s: frontiers = %v, want %v", tt.name, frontiers, tt.frontiers)
+		}
+	}
+}
+
+func TestPathNodeKind(t *testing.T) {
+	tests := []struct {
+		labels []string
+		want   string
+	}{
+		{[]string{"File"}, models.SymbolFile},
+		{[]string{"Class"}, models.SymbolClass},
+		{[]string{"Function"}, models.SymbolFunction},
+		{[]string{"Module"}, models.SymbolModule},
+		{[]string{"Property"}, models.SymbolUnknown},
+		{nil, models.SymbolUnknown},
+	}
+	for _, tt := range tests {
+		if got := pathNodeKind(tt.labels); got != tt.want {
+			t.Errorf("pathNodeKind(%v) = %s, want %s", tt.labels, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package database
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+)
+
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// EnsureProject returns the project with the given ID, creating it if needed.
+func (db *DB) EnsureProject(ctx context.Context, id string) (*models.Project, error) {
+	records, err := db.write(ctx, `
+		MERGE (p:Project {id: $id})
+		ON CREATE SET p.created_at = $now
+		RETURN p
+	`, map[string]any{"id": id, "now": time.Now().UTC()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to ensure project %s: %w", id, err)
+	}
+	return projectFromRecord(records[0])
+}
+
+// GetProject returns the project with the given ID or ErrNotFound.
+func (db *DB) GetProject(ctx context.Context, id string) (*models.Project, error) {
+	records, err := db.read(ctx, `MATCH (p:Project {id: $id}) RETURN p`, map[string]any{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project %s: %w", id, err)
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	return projectFromRecord(records[0])
+}
+
+// SetProjectSchedule stores the git remote and cron schedule used to
+// re-analyze a project periodically. An empty schedule disables it.
+func (db *DB) SetProjectSchedule(ctx context.Context, id, repoURL, schedule string) (*models.Project, error) {
+	records, err := db.write(ctx, `
+		MERGE (p:Project {id: $id})
+		ON CREATE SET p.created_at = $now
+		SET p.repo_url = $repo_url, p.schedule = $schedule
+		RETURN p
+	`, map[string]any{"id": id, "repo_url": repoURL, "schedule": schedule, "now": time.Now().UTC()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set schedule of project %s: %w", id, err)
+	}
+	return projectFromRecord(records[0])
+}
+
+// SetProjectOptions stores how a project's source is fetched.
+func (db *DB) SetProjectOptions(ctx context.Context, id string, opts models.ProjectOptions) (*models.Project, error) {
+	records, err := db.write(ctx, `
+		MERGE (p:Project {id: $id})
+		ON CREATE SET p.created_at = $now
+		SET p.fetch_submodules = $fetch_submodules
+		RETURN p
+	`, map[string]any{"id": id, "fetch_submodules": opts.FetchSubmodules, "now": time.Now().UTC()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set options of project %s: %w", id, err)
+	}
+	return projectFromRecord(records[0])
+}
+
+// ListScheduledProjects returns every project with a re-analysis schedule.
+func (db *DB) ListScheduledProjects(ctx context.Context) ([]models.Project, error) {
+	records, err := db.read(ctx, `
+		MATCH (p:Project)
+		WHERE coalesce(p.schedule, '') <> '' AND coalesce(p.repo_url, '') <> ''
+		RETURN p ORDER BY p.id
+	`, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled projects: %w", err)
+	}
+	projects := make([]models.Project, 0, len(records))
+	for _, record := range records {
+		project, err := projectFromRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, *project)
+	}
+	return projects, nil
+}
+
+// ComputeMetrics calculates the graph statistics of a project's current import.
+func (db *DB) ComputeMetrics(ctx context.Context, projectID string) (models.SnapshotMetrics, error) {
+	var metrics models.SnapshotMetrics
+	records, err := db.read(ctx, `
+		CALL { MATCH (f:File {project: $project}) RETURN count(f) AS files }
+		CALL { MATCH (c:Class {project: $project}) RETURN count(c) AS classes }
+		CALL { MATCH (fn:Function {project: $project}) RETURN count(fn) AS functions }
+		CALL {
+			MATCH (f:File {project: $project})
+			WHERE EXISTS { MATCH (f)-[:IMPORTS*1..10]->(f) }
+			RETURN count(f) AS import_cycle_files
+		}
+		CALL {
+			MATCH (fn:Function {project: $project})
+			WHERE NOT ()-[:CALLS]->(fn)
+			  AND NOT coalesce(fn.is_exported, false)
+			  AND NOT fn.name IN ['main', 'init']
+			RETURN count(fn) AS dead_functions
+		}
+		RETURN files, classes, functions, import_cycle_files, dead_functions
+	`, map[string]any{"project": projectID})
+	if err != nil {
+		return metrics, fmt.Errorf("failed to compute metrics for project %s: %w", projectID, err)
+	}
+	values := records[0].AsMap()
+	metrics.Files, _ = values["files"].(int64)
+	metrics.Classes, _ = values["classes"].(int64)
+	metrics.Functions, _ = values["functions"].(int64)
+	metrics.ImportCycleFiles, _ = values["import_cycle_files"].(int64)
+	metrics.DeadFunctions, _ = values["dead_functions"].(int64)
+	return metrics, nil
+}
+
+// CreateSnapshot stores a snapshot and links it to its project.
+func (db *DB) CreateSnapshot(ctx context.Context, snap *models.Snapshot) error {
+	var commit models.CommitInfo
+	if snap.Commit != nil {
+		commit = *snap.Commit
+	}
+	skippedPaths := make([]string, len(snap.Skipped))
+	skippedReasons := make([]string, len(snap.Skipped))
+	for i, skipped := range snap.Skipped {
+		skippedPaths[i] = skipped.Path
+		skippedReasons[i] = skipped.Reason
+	}
+
+	_, err := db.write(ctx, `
+		MATCH (p:Project {id: $project})
+		CREATE (s:Snapshot {
+			id: $id, project: $project, job_id: $job_id, source: $source,
+			s3_key: $s3_key, repo_url: $repo_url, created_at: $created_at,
+			archive_sha256: $archive_sha256, analyzer_version: $analyzer_version,
+			commit_sha: $commit_sha, commit_author: $commit_author,
+			commit_date: $commit_date, commit_subject: $commit_subject,
+			files: $files, classes: $classes, functions: $functions,
+			import_cycle_files: $import_cycle_files, dead_functions: $dead_functions,
+			skipped_paths: $skipped_paths, skipped_reasons: $skipped_reasons
+		})
+		CREATE (s)-[:SNAPSHOT_OF]->(p)
+	`, map[string]any{
+		"id":                 snap.ID,
+		"project":            snap.ProjectID,
+		"job_id":             snap.JobID,
+		"source":             snap.Source,
+		"s3_key":             snap.S3Key,
+		"repo_url":           snap.RepoURL,
+		"archive_sha256":     snap.ArchiveSHA256,
+		"analyzer_version":   snap.AnalyzerVersion,
+		"commit_sha":         commit.SHA,
+		"commit_author":      commit.Author,
+		"commit_date":        commitDate(commit),
+		"commit_subject":     commit.Subject,
+		"created_at":         snap.CreatedAt,
+		"files":              snap.Metrics.Files,
+		"classes":            snap.Metrics.Classes,
+		"functions":          snap.Metrics.Functions,
+		"import_cycle_files": snap.Metrics.ImportCycleFiles,
+		"dead_functions":     snap.Metrics.DeadFunctions,
+		"skipped_paths":      skippedPaths,
+		"skipped_reasons":    skippedReasons,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetSnapshot returns a snapshot of a project or ErrNotFound.
+func (db *DB) GetSnapshot(ctx context.Context, projectID, id string) (*models.Snapshot, error) {
+	records, err := db.read(ctx, `
+		MATCH (s:Snapshot {project: $project, id: $id}) RETURN s
+	`, map[string]any{"project": projectID, "id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot %s: %w", id, err)
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	node, _, err := neo4j.GetRecordValue[dbtype.Node](records[0], "s")
+	if err != nil {
+		return nil, err
+	}
+	snap := snapshotFromProps(node.Props)
+	return &snap, nil
+}
+
+// LatestSnapshot returns the most recent snapshot of a project or ErrNotFound.
+func (db *DB) LatestSnapshot(ctx context.Context, projectID string) (*models.Snapshot, error) {
+	snaps, err := db.listSnapshots(ctx, projectID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(snaps) == 0 {
+		return nil, ErrNotFound
+	}
+	return &snaps[0], nil
+}
+
+// ListSnapshots returns the snapshots of a project, newest first.
+func (db *DB) ListSnapshots(ctx context.Context, projectID string) ([]models.Snapshot, error) {
+	return db.listSnapshots(ctx, projectID, 1000)
+}
+
+func (db *DB) listSnapshots(ctx context.Context, projectID string, limit int) ([]models.Snapshot, error) {
+	records, err := db.read(ctx, `
+		MATCH (s:Snapshot {project: $project})
+		RETURN s ORDER BY s.created_at DESC LIMIT $limit
+	`, map[string]any{"project": projectID, "limit": limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots for project %s: %w", projectID, err)
+	}
+	snaps := make([]models.Snapshot, 0, len(records))
+	for _, record := range records {
+		node, _, err := neo4j.GetRecordValue[dbtype.Node](record, "s")
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snapshotFromProps(node.Props))
+	}
+	return snaps, nil
+}
+
+// ListAllSnapshots returns the snapshots of every project.
+func (db *DB) ListAllSnapshots(ctx context.Context) ([]models.Snapshot, error) {
+	records, err := db.read(ctx, `MATCH (s:Snapshot) RETURN s ORDER BY s.project, s.created_at DESC`, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	snaps := make([]models.Snapshot, 0, len(records))
+	for _, record := range records {
+		node, _, err := neo4j.GetRecordValue[dbtype.Node](record, "s")
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snapshotFromProps(node.Props))
+	}
+	return snaps, nil
+}
+
+// DeleteSnapshots removes snapshots by ID.
+func (db *DB) DeleteSnapshots(ctx context.Context, ids []string) error {
+	_, err := db.write(ctx, `
+		MATCH (s:Snapshot) WHERE s.id IN $ids
+		DETACH DELETE s
+	`, map[string]any{"ids": ids})
+	if err != nil {
+		return fmt.Errorf("failed to delete snapshots: %w", err)
+	}
+	return nil
+}
+
+// read runs a query in a read transaction and returns its records.
+func (db *DB) read(ctx context.Context, cypher string, params map[string]any) ([]*neo4j.Record, error) {
+	session := db.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		res, err := tx.Run(ctx, cypher, params)
+		if err != nil {
+			return nil, err
+		}
+		return res.Collect(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*neo4j.Record), nil
+}
+
+// write runs a query in a write transaction and returns its records.
+func (db *DB) write(ctx context.Context, cypher string, params map[string]any) ([]*neo4j.Record, error) {
+	session := db.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		res, err := tx.Run(ctx, cypher, params)
+		if err != nil {
+			return nil, err
+		}
+		return res.Collect(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*neo4j.Record), nil
+}
+
+func projectFromRecord(record *neo4j.Record) (*models.Project, error) {
+	node, _, err := neo4j.GetRecordValue[dbtype.Node](record, "p")
+	if err != nil {
+		return nil, err
+	}
+	return &models.Project{
+		ID:       propString(node.Props, "id"),
+		RepoURL:  propString(node.Props, "repo_url"),
+		Schedule: propString(node.Props, "schedule"),
+		Options: models.ProjectOptions{
+			FetchSubmodules: propBool(node.Props, "fetch_submodules"),
+		},
+		CreatedAt: propTime(node.Props, "created_at"),
+	}, nil
+}
+
+func snapshotFromProps(props map[string]any) models.Snapshot {
+	var skipped []models.SkippedFile
+	paths, reasons := propStrings(props, "skipped_paths"), propStrings(props, "skipped_reasons")
+	for i := range paths {
+		if i < len(reasons) {
+			skipped = append(skipped, models.SkippedFile{Path: paths[i], Reason: reasons[i]})
+		}
+	}
+
+	return models.Snapshot{
+		ID:        propString(props, "id"),
+		ProjectID: propString(props, "project"),
+		JobID:     propString(props, "job_id"),
+		Source:    propString(props, "source"),
+		S3Key:     propString(props, "s3_key"),
+		RepoURL:   propString(props, "repo_url"),
+		CreatedAt: propTime(props, "created_at"),
+		// Content address of the uploaded archive and the analyzer that read it
+		ArchiveSHA256:   propString(props, "archive_sha256"),
+		AnalyzerVersion: propString(props, "analyzer_version"),
+		Metrics: models.SnapshotMetrics{
+			Files:            propInt(props, "files"),
+			Classes:          propInt(props, "classes"),
+			Functions:        propInt(props, "functions"),
+			ImportCycleFiles: propInt(props, "import_cycle_files"),
+			DeadFunctions:    propInt(props, "dead_functions"),
+		},
+		Commit:  commitFromProps(props),
+		Skipped: skipped,
+	}
+}
+
+func commitFromProps(props map[string]any) *models.CommitInfo {
+	sha := propString(props, "commit_sha")
+	if sha == "" {
+		return nil
+	}
+	return &models.CommitInfo{
+		SHA:     sha,
+		Author:  propString(props, "commit_author"),
+		Date:    propTime(props, "commit_date"),
+		Subject: propString(props, "commit_subject"),
+	}
+}
+
+// commitDate returns the commit date, or nil so that unknown dates are not stored.
+func commitDate(commit models.CommitInfo) any {
+	if commit.Date.IsZero() {
+		return nil
+	}
+	return commit.Date
+}
+
+func propString(props map[string]any, key string) string {
+	v, _ := props[key].(string)
+	return v
+}
+
+func propInt(props map[string]any, key string) int64 {
+	v, _ := props[key].(int64)
+	return v
+}
+
+func propBool(props map[string]any, key string) bool {
+	v, _ := props[key].(bool)
+	return v
+}
+
+func propTime(props map[string]any, key string) time.Time {
+	v, _ := props[key].(time.Time)
+	return v
+}
+
+func propStrings(props map[string]any, key string) []string {
+	raw, _ := props[key].([]any)
+	values := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"fmt"
+	"path"
+)
+
+// SearchSymbols returns a project's functions, classes, properties and files
+// for its search index, with the doc comments and string literals recorded
+// by the analyzer.
+func (db *DB) SearchSymbols(ctx context.Context, projectID string) ([]models.Symbol, error) {
+	records, err := db.read(ctx, `
+		MATCH (f:File {project: $project})
+		RETURN 'file' AS kind, f.path AS id, f.path AS file, f.language AS language,
+		       '' AS name, false AS exported, COUNT { (:File)-[:IMPORTS]->(f) } AS degree,
+		       null AS doc, null AS strings
+		UNION ALL
+		MATCH (f:File {project: $project})-[:CONTAINS]->(fn:Function)
+		RETURN 'function' AS kind, fn.id AS id, f.path AS file, f.language AS language,
+		       fn.name AS name, fn.is_exported AS exported, COUNT { ()-[:CALLS]->(fn) } AS degree,
+		       fn.doc AS doc, fn.strings AS strings
+		UNION ALL
+		MATCH (f:File {project: $project})-[:CONTAINS]->(c:Class)
+		RETURN 'class' AS kind, c.id AS id, f.path AS file, f.language AS language,
+		       c.name AS name, c.is_exported AS exported,
+		       COUNT { (c)-[:HAS_METHOD]->(:Function)<-[:CALLS]-() } AS degree,
+		       c.doc AS doc, null AS strings
+		UNION ALL
+		MATCH (f:File {project: $project})-[:CONTAINS]->(c:Class)-[:HAS_PROPERTY]->(p:Property)
+		RETURN 'property' AS kind, p.id AS id, f.path AS file, f.language AS language,
+		       p.name AS name, c.is_exported AS exported, 0 AS degree,
+		       null AS doc, null AS strings
+	`, map[string]any{"project": projectID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load symbols of project %s: %w", projectID, err)
+	}
+	symbols := make([]models.Symbol, 0, len(records))
+	for _, record := range records {
+		values := record.AsMap()
+		symbol := models.Symbol{
+			Kind:       propString(values, "kind"),
+			ID:         propString(values, "id"),
+			Name:       propString(values, "name"),
+			File:       propString(values, "file"),
+			Language:   propString(values, "language"),
+			IsExported: propBool(values, "exported"),
+			Degree:     int(propInt(values, "degree")),
+			Doc:        propString(values, "doc"),
+			Strings:    propStrings(values, "strings"),
+		}
+		if symbol.Kind == models.SymbolFile {
+			symbol.Name = path.Base(symbol.ID)
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, nil
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+)
+
+// CreateWebhook stores a new webhook subscription for its project. The secret
+// is stored as given, so callers seal it first.
+func (db *DB) CreateWebhook(ctx context.Context, hook *models.Webhook) error {
+	_, err := db.write(ctx, `
+		MATCH (p:Project {id: $project})
+		CREATE (w:Webhook {
+			id: $id, project: $project, url: $url, secret: $secret, events: $events,
+			threshold_import_cycle_files: $import_cycle_files,
+			threshold_dead_functions: $dead_functions,
+			created_at: $created_at
+		})
+		CREATE (p)-[:HAS_WEBHOOK]->(w)
+	`, map[string]any{
+		"id":                 hook.ID,
+		"project":            hook.ProjectID,
+		"url":                hook.URL,
+		"secret":             hook.Secret,
+		"events":             hook.Events,
+		"import_cycle_files": hook.Thresholds.ImportCycleFiles,
+		"dead_functions":     hook.Thresholds.DeadFunctions,
+		"created_at":         hook.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+// ListWebhooks returns every webhook of a project without their secrets.
+func (db *DB) ListWebhooks(ctx context.Context, projectID string) ([]models.Webhook, error) {
+	records, err := db.read(ctx, `
+		MATCH (w:Webhook {project: $project})
+		RETURN w ORDER BY w.created_at
+	`, map[string]any{"project": projectID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks for project %s: %w", projectID, err)
+	}
+	hooks := make([]models.Webhook, 0, len(records))
+	for _, record := range records {
+		node, _, err := neo4j.GetRecordValue[dbtype.Node](record, "w")
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, models.Webhook{
+			ID:        propString(node.Props, "id"),
+			ProjectID: propString(node.Props, "project"),
+			URL:       propString(node.Props, "url"),
+			Events:    propStrings(node.Props, "events"),
+			Thresholds: models.Thresholds{
+				ImportCycleFiles: propInt(node.Props, "threshold_import_cycle_files"),
+				DeadFunctions:    propInt(node.Props, "threshold_dead_functions"),
+			},
+			CreatedAt: propTime(node.Props, "created_at"),
+		})
+	}
+	return hooks, nil
+}
+
+// WebhookSecret returns the stored secret of a webhook, or ErrNotFound if the
+// project has no such webhook.
+func (db *DB) WebhookSecret(ctx context.Context, projectID, id string) (string, error) {
+	records, err := db.read(ctx, `
+		MATCH (w:Webhook {project: $project, id: $id})
+		RETURN w.secret AS secret
+	`, map[string]any{"project": projectID, "id": id})
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret of webhook %s: %w", id, err)
+	}
+	if len(records) == 0 {
+		return "", ErrNotFound
+	}
+	secret, _ := records[0].AsMap()["secret"].(string)
+	return secret, nil
+}
+
+// HasWebhookSecrets reports whether any webhook has a stored secret, which
+// can only be opened with the key it was sealed with.
+func (db *DB) HasWebhookSecrets(ctx context.Context) (bool, error) {
+	records, err := db.read(ctx, `
+		MATCH (w:Webhook) WHERE w.secret IS NOT NULL AND w.secret <> ''
+		RETURN count(w) > 0 AS found
+	`, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up webhook secrets: %w", err)
+	}
+	found, _ := records[0].AsMap()["found"].(bool)
+	return found, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log. It returns ErrNotFound
+// if the project has no such webhook.
+func (db *DB) DeleteWebhook(ctx context.Context, projectID, id string) error {
+	records, err := db.write(ctx, `
+		MATCH (w:Webhook {project: $project, id: $id})
+		OPTIONAL MATCH (d:WebhookDelivery {webhook_id: $id})
+		DETACH DELETE w, d
+		RETURN count(DISTINCT w) AS deleted
+	`, map[string]any{"project": projectID, "id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook %s: %w", id, err)
+	}
+	if deleted, _ := records[0].AsMap()["deleted"].(int64); deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveDelivery creates or updates a webhook delivery log entry.
+func (db *DB) SaveDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	_, err := db.write(ctx, `
+		MERGE (d:WebhookDelivery {id: $id})
+		ON CREATE SET d.webhook_id = $webhook_id, d.event = $event, d.created_at = $created_at
+		SET d.status = $status, d.attempts = $attempts, d.response_code = $response_code,
+		    d.error = $error, d.updated_at = $updated_at
+	`, map[string]any{
+		"id":            d.ID,
+		"webhook_id":    d.WebhookID,
+		"event":         d.Event,
+		"status":        d.Status,
+		"attempts":      d.Attempts,
+		"response_code": d.ResponseCode,
+		"error":         d.Error,
+		"created_at":    d.CreatedAt,
+		"updated_at":    d.UpdatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save webhook delivery %s: %w", d.ID, err)
+	}
+	return nil
+}
+
+// ListDeliveries returns the most recent deliveries of a webhook, newest first.
+func (db *DB) ListDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	records, err := db.read(ctx, `
+		MATCH (d:WebhookDelivery {webhook_id: $webhook_id})
+		RETURN d ORDER BY d.created_at DESC LIMIT $limit
+	`, map[string]any{"webhook_id": webhookID, "limit": limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries for webhook %s: %w", webhookID, err)
+	}
+	deliveries := make([]models.WebhookDelivery, 0, len(records))
+	for _, record := range records {
+		node, _, err := neo4j.GetRecordValue[dbtype.Node](record, "d")
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			ID:           propString(node.Props, "id"),
+			WebhookID:    propString(node.Props, "webhook_id"),
+			Event:        propString(node.Props, "event"),
+			Status:       propString(node.Props, "status"),
+			Attempts:     propInt(node.Props, "attempts"),
+			ResponseCode: propInt(node.Props, "response_code"),
+			Error:        propString(node.Props, "error"),
+			CreatedAt:    propTime(node.Props, "created_at"),
+			UpdatedAt:    propTime(node.Props, "updated_at"),
+		})
+	}
+	return deliveries, nil
+}
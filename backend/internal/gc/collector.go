@@ -0,0 +1,322 @@
+package gc
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store is the persistence holding snapshots.
+type Store interface {
+	ListAllSnapshots(ctx context.Context) ([]models.Snapshot, error)
+	DeleteSnapshots(ctx context.Context, ids []string) error
+}
+
+// Object is a stored blob.
+type Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Blobs is the blob storage archives are kept in.
+type Blobs interface {
+	List(prefix string) ([]Object, error)
+	Delete(keys []string) error
+}
+
+// Policy is what the collector retains. A zero field disables that rule.
+type Policy struct {
+	// KeepSnapshots is how many of each project's newest snapshots are
+	// always kept. Older ones expire, once past MaxAge if that is set.
+	KeepSnapshots int
+	// MaxAge expires snapshots older than this, except a project's newest
+	// KeepSnapshots.
+	MaxAge time.Duration
+	// MaxBytes caps the archives referenced by retained snapshots; the oldest
+	// snapshots across all projects are expired until they fit.
+	MaxBytes int64
+	// Grace protects recent blobs no snapshot references yet (uploads being
+	// analyzed) and recent temp directories from collection.
+	Grace time.Duration
+}
+
+// Prefixes are the blob storage prefixes archives are stored under, including
+// the staging area of direct uploads.
+var Prefixes = []string{"projects/", "archives/", "uploads/"}
+
+// tempPatterns match the temp directories the server creates for uploads,
+// extraction and checkouts; they are only left behind by a crash.
+var tempPatterns = []string{"codemap-upload-*", "codemap-extract-*", "codemap-reanalyze-*", "codemap-worktree-*", "codemap-zip-*"}
+
+// Report lists what a collection removed or, in a dry run, would remove.
+type Report struct {
+	DryRun     bool              `json:"dry_run"`
+	StartedAt  time.Time         `json:"started_at"`
+	Policy     Policy            `json:"policy"`
+	Snapshots  []models.Snapshot `json:"snapshots"`
+	Objects    []Object          `json:"objects"`
+	FreedBytes int64             `json:"freed_bytes"`
+	TempDirs   []string          `json:"temp_dirs"`
+	Errors     []string          `json:"errors,omitempty"`
+}
+
+// Collector enforces the retention policy on snapshots in the graph, archives
+// in blob storage and temp directories on local disk. The latest snapshot of
+// a project is always kept, and an archive is only deleted once no retained
+// snapshot references it.
+type Collector struct {
+	store    Store
+	blobs    Blobs
+	policy   Policy
+	tempDirs []string
+	logger   *log.Logger
+
+	mu     sync.Mutex // one collection at a time
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a collector that cleans up temp directories under tempDirs.
+func New(store Store, blobs Blobs, policy Policy, tempDirs []string, logger *log.Logger) *Collector {
+	return &Collector{store: store, blobs: blobs, policy: policy, tempDirs: tempDirs, logger: logger}
+}
+
+// Start runs a collection every interval in the background, passing the
+// outcome of each to done.
+func (c *Collector) Start(interval time.Duration, done func(*Report, error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := c.Run(ctx, false)
+				done(report, err)
+				if err != nil {
+					c.logger.Printf("gc: %v", err)
+					continue
+				}
+				if len(report.Snapshots)+len(report.Objects)+len(report.TempDirs) > 0 {
+					c.logger.Printf("gc: removed %d snapshots, %d archives (%d bytes) and %d temp directories",
+						len(report.Snapshots), len(report.Objects), report.FreedBytes, len(report.TempDirs))
+				}
+				for _, msg := range report.Errors {
+					c.logger.Printf("gc: %s", msg)
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the background collection and waits for a running one to finish.
+func (c *Collector) Close() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+}
+
+// Run performs a collection. With dryRun set nothing is deleted and the report
+// lists what would be. Once deleting has started, failures are listed in the
+// report's Errors rather than returned.
+func (c *Collector) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	report := &Report{
+		DryRun:    dryRun,
+		StartedAt: now.UTC(),
+		Policy:    c.policy,
+		Snapshots: []models.Snapshot{},
+	}
+
+	snapshots, err := c.store.ListAllSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var objects []Object
+	for _, prefix := range Prefixes {
+		listed, err := c.blobs.List(prefix)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, listed...)
+	}
+
+	expired, retained := c.expire(snapshots, objects, now)
+	report.Snapshots = append(report.Snapshots, expired...)
+	report.Objects = c.unreferenced(objects, retained, now)
+	for _, obj := range report.Objects {
+		report.FreedBytes += obj.Size
+	}
+	report.TempDirs = c.staleTempDirs(now)
+
+	if dryRun {
+		return report, nil
+	}
+
+	// Snapshots go first so a failure never leaves one pointing at a deleted archive.
+	if len(expired) > 0 {
+		ids := make([]string, len(expired))
+		for i, snap := range expired {
+			ids[i] = snap.ID
+		}
+		if err := c.store.DeleteSnapshots(ctx, ids); err != nil {
+			// The archives of the snapshots are still referenced, so keep them
+			report.Errors = append(report.Errors, err.Error())
+			report.Snapshots, report.Objects, report.FreedBytes = []models.Snapshot{}, []Object{}, 0
+		}
+	}
+	if len(report.Objects) > 0 {
+		keys := make([]string, len(report.Objects))
+		for i, obj := range report.Objects {
+			keys[i] = obj.Key
+		}
+		if err := c.blobs.Delete(keys); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+	for _, dir := range report.TempDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+	return report, nil
+}
+
+// expire splits snapshots into those the policy expires and those it retains.
+func (c *Collector) expire(snapshots []models.Snapshot, objects []Object, now time.Time) (expired, retained []models.Snapshot) {
+	byProject := make(map[string][]models.Snapshot)
+	for _, snap := range snapshots {
+		byProject[snap.ProjectID] = append(byProject[snap.ProjectID], snap)
+	}
+
+	// candidates may still be expired to satisfy MaxBytes.
+	var candidates []models.Snapshot
+	for _, snaps := range byProject {
+		sort.Slice(snaps, func(i, j int) bool { return snaps[i].CreatedAt.After(snaps[j].CreatedAt) })
+		for i, snap := range snaps {
+			switch {
+			case i == 0:
+				retained = append(retained, snap)
+			case c.policy.expires(i, now.Sub(snap.CreatedAt)):
+				expired = append(expired, snap)
+			default:
+				candidates = append(candidates, snap)
+			}
+		}
+	}
+	if c.policy.MaxBytes <= 0 {
+		return expired, append(retained, candidates...)
+	}
+
+	sizes := make(map[string]int64, len(objects))
+	for _, obj := range objects {
+		sizes[obj.Key] = obj.Size
+	}
+	refs := make(map[string]int)
+	var total int64
+	for _, snap := range append(retained, candidates...) {
+		if snap.S3Key == "" {
+			continue
+		}
+		if refs[snap.S3Key] == 0 {
+			total += sizes[snap.S3Key]
+		}
+		refs[snap.S3Key]++
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].CreatedAt.Before(candidates[j].CreatedAt) })
+	for len(candidates) > 0 && total > c.policy.MaxBytes {
+		snap := candidates[0]
+		candidates = candidates[1:]
+		expired = append(expired, snap)
+		if snap.S3Key != "" {
+			if refs[snap.S3Key]--; refs[snap.S3Key] == 0 {
+				total -= sizes[snap.S3Key]
+			}
+		}
+	}
+	return expired, append(retained, candidates...)
+}
+
+// expires reports whether the count and age rules expire a project's snapshot
+// of the given age that has i newer ones.
+func (p Policy) expires(i int, age time.Duration) bool {
+	if p.KeepSnapshots > 0 && i < p.KeepSnapshots {
+		return false
+	}
+	if p.MaxAge > 0 {
+		return age > p.MaxAge
+	}
+	return p.KeepSnapshots > 0
+}
+
+// unreferenced returns the objects no retained snapshot points at, leaving
+// out recent ones that may belong to an analysis still in progress.
+func (c *Collector) unreferenced(objects []Object, retained []models.Snapshot, now time.Time) []Object {
+	referenced := make(map[string]bool, len(retained))
+	for _, snap := range retained {
+		referenced[snap.S3Key] = true
+	}
+	unused := []Object{}
+	for _, obj := range objects {
+		if !referenced[obj.Key] && now.Sub(obj.LastModified) > c.policy.Grace {
+			unused = append(unused, obj)
+		}
+	}
+	return unused
+}
+
+// staleTempDirs returns server temp directories older than the grace period.
+func (c *Collector) staleTempDirs(now time.Time) []string {
+	seen := make(map[string]bool)
+	stale := []string{}
+	for _, root := range c.tempDirs {
+		for _, pattern := range tempPatterns {
+			matches, _ := filepath.Glob(filepath.Join(root, pattern))
+			for _, dir := range matches {
+				if seen[dir] {
+					continue
+				}
+				seen[dir] = true
+				info, err := os.Stat(dir)
+				if err != nil || !info.IsDir() || now.Sub(info.ModTime()) <= c.policy.Grace {
+					continue
+				}
+				stale = append(stale, dir)
+			}
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// TempRoots returns dirs without duplicates or empty entries.
+func TempRoots(dirs ...string) []string {
+	var roots []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if !seen[dir] {
+			seen[dir] = true
+			roots = append(roots, dir)
+		}
+	}
+	return roots
+}
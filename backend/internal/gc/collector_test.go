@@ -0,0 +1,89 @@
+package gc
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// failingStore is a Store whose deletions fail.
+type failingStore struct{ snapshots []models.Snapshot }
+
+func (s failingStore) ListAllSnapshots(ctx context.Context) ([]models.Snapshot, error) {
+	return s.snapshots, nil
+}
+
+func (s failingStore) DeleteSnapshots(ctx context.Context, ids []string) error {
+	return errors.New("neo4j is unavailable")
+}
+
+// blobs is an in-memory Blobs recording deletions.
+type blobs struct {
+	objects []Object
+	deleted []string
+}
+
+func (b *blobs) List(prefix string) ([]Object, error) {
+	if prefix != Prefixes[0] {
+		return nil, nil
+	}
+	return b.objects, nil
+}
+
+func (b *blobs) Delete(keys []string) error {
+	b.deleted = append(b.deleted, keys...)
+	return nil
+}
+
+func TestPolicyExpires(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name   string
+		policy Policy
+		i      int
+		age    time.Duration
+		want   bool
+	}{
+		{"no rules", Policy{}, 100, 1000 * day, false},
+		{"within count", Policy{KeepSnapshots: 3}, 2, 1000 * day, false},
+		{"beyond count", Policy{KeepSnapshots: 3}, 3, 0, true},
+		{"young", Policy{MaxAge: 30 * day}, 100, 29 * day, false},
+		{"old", Policy{MaxAge: 30 * day}, 1, 31 * day, true},
+		{"old but within count", Policy{KeepSnapshots: 3, MaxAge: 30 * day}, 2, 31 * day, false},
+		{"old and beyond count", Policy{KeepSnapshots: 3, MaxAge: 30 * day}, 3, 31 * day, true},
+		{"young and beyond count", Policy{KeepSnapshots: 3, MaxAge: 30 * day}, 3, 29 * day, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.expires(tt.i, tt.age); got != tt.want {
+			t.Errorf("%s: expires(%d, %v) = %v, want %v", tt.name, tt.i, tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestRunKeepsArchivesWhenSnapshotsCannotBeDeleted(t *testing.T) {
+	now := time.Now()
+	store := failingStore{snapshots: []models.Snapshot{
+		{ID: "new", ProjectID: "p", S3Key: "projects/p/new.zip", CreatedAt: now},
+		{ID: "old", ProjectID: "p", S3Key: "projects/p/old.zip", CreatedAt: now.Add(-time.Hour)},
+	}}
+	b := &blobs{objects: []Object{
+		{Key: "projects/p/new.zip", LastModified: now.Add(-time.Hour)},
+		{Key: "projects/p/old.zip", Size: 10, LastModified: now.Add(-time.Hour)},
+	}}
+	c := New(store, b, Policy{KeepSnapshots: 1}, nil, log.New(io.Discard, "", 0))
+
+	report, err := c.Run(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(b.deleted) != 0 {
+		t.Errorf("deleted %v, though the snapshot referencing it was kept", b.deleted)
+	}
+	if len(report.Errors) != 1 || len(report.Snapshots) != 0 || len(report.Objects) != 0 || report.FreedBytes != 0 {
+		t.Errorf("report = %+v, want one error and nothing deleted", report)
+	}
+}
@@ -0,0 +1,412 @@
+package gitcache
+
+import (
+	"bytes"
+	"codemap/backend/internal/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache keeps one bare mirror per git remote on disk. Mirrors are updated with
+// "git fetch" and checked out into disposable worktrees, so re-analyzing a
+// repository only downloads what changed. When the cache grows beyond its size
+// limit the least recently used mirrors that are not checked out are evicted.
+type Cache struct {
+	root     string
+	workRoot string
+	maxBytes int64
+	logger   *log.Logger
+
+	mu      sync.Mutex
+	mirrors map[string]*mirror
+}
+
+// mirror serializes git operations on one mirror and counts its live worktrees.
+type mirror struct {
+	mu   sync.Mutex
+	dir  string
+	refs int
+}
+
+// Worktree is a checkout of a single commit. Close must be called to remove it.
+type Worktree struct {
+	Dir    string
+	Commit string
+
+	cache  *Cache
+	mirror *mirror
+}
+
+// New creates a cache that stores mirrors under root and worktrees under
+// workRoot. A maxBytes of zero disables eviction.
+func New(root, workRoot string, maxBytes int64, logger *log.Logger) (*Cache, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create git cache directory: %w", err)
+	}
+	return &Cache{
+		root:     root,
+		workRoot: workRoot,
+		maxBytes: maxBytes,
+		logger:   logger,
+		mirrors:  make(map[string]*mirror),
+	}, nil
+}
+
+// ErrInvalidRemote is returned for remotes other than https URLs of
+// repositories on github.com.
+var ErrInvalidRemote = errors.New("repository URL must be an https://github.com/ URL")
+
+// ValidateRemote checks that remote is an https URL of a repository on
+// github.com, the only host analyses are cloned from. Anything else, notably
+// a value starting with "-", could be taken by git for an option.
+func ValidateRemote(remote string) error {
+	u, err := url.Parse(remote)
+	if err != nil || u.Scheme != "https" || !strings.EqualFold(u.Host, "github.com") ||
+		u.User != nil || u.RawQuery != "" || u.Fragment != "" || strings.Trim(u.Path, "/") == "" {
+		return ErrInvalidRemote
+	}
+	return nil
+}
+
+// Checkout brings the mirror of remote up to date and checks out rev (or the
+// remote's HEAD when rev is empty) into a new worktree. The remote must pass
+// ValidateRemote.
+func (c *Cache) Checkout(ctx context.Context, remote, rev string) (*Worktree, error) {
+	if err := ValidateRemote(remote); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(rev, "-") {
+		return nil, fmt.Errorf("invalid revision %q", rev)
+	}
+	m := c.acquire(remote)
+
+	wt, err := c.checkout(ctx, m, remote, rev)
+	if err != nil {
+		c.release(m)
+		return nil, err
+	}
+	c.evict()
+	return wt, nil
+}
+
+func (c *Cache) checkout(ctx context.Context, m *mirror, remote, rev string) (*Worktree, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := os.Stat(m.dir); err == nil {
+		if _, err := git(ctx, m.dir, "fetch", "--prune", "--quiet", "--", "origin"); err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", remote, err)
+		}
+	} else {
+		// Clone next to the final location so a failed clone never looks like a mirror.
+		tmp := m.dir + ".tmp"
+		os.RemoveAll(tmp)
+		if _, err := git(ctx, "", "clone", "--mirror", "--quiet", "--", remote, tmp); err != nil {
+			os.RemoveAll(tmp)
+			return nil, fmt.Errorf("failed to clone repository: %w", err)
+		}
+		if err := os.Rename(tmp, m.dir); err != nil {
+			os.RemoveAll(tmp)
+			return nil, err
+		}
+	}
+	now := time.Now()
+	os.Chtimes(m.dir, now, now)
+
+	if rev == "" {
+		rev = "HEAD"
+	}
+	commit, err := git(ctx, m.dir, "rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("revision %s not found in %s: %w", rev, remote, err)
+	}
+
+	dir, err := os.MkdirTemp(c.workRoot, "codemap-worktree-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+	if _, err := git(ctx, m.dir, "worktree", "add", "--detach", "--force", dir, commit); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to check out %s: %w", commit, err)
+	}
+	return &Worktree{Dir: dir, Commit: commit, cache: c, mirror: m}, nil
+}
+
+// Close removes the worktree and releases the mirror for eviction.
+func (w *Worktree) Close() error {
+	w.mirror.mu.Lock()
+	defer w.cache.release(w.mirror)
+	defer w.mirror.mu.Unlock()
+
+	// git refuses to remove worktrees with initialized submodules, so fall
+	// back to deleting the directory and pruning the stale worktree entry.
+	if _, err := git(context.Background(), w.mirror.dir, "worktree", "remove", "--force", w.Dir); err == nil {
+		return nil
+	}
+	if err := os.RemoveAll(w.Dir); err != nil {
+		return err
+	}
+	_, err := git(context.Background(), w.mirror.dir, "worktree", "prune")
+	return err
+}
+
+// Submodule is a git submodule checked out inside a worktree.
+type Submodule struct {
+	Path   string // relative to the worktree root, with forward slashes
+	URL    string
+	Commit string
+}
+
+// InitSubmodules recursively fetches and checks out the worktree's submodules
+// and returns them, parents before their children. Every submodule URL must
+// pass ValidateRemote, and git may only fetch over https.
+func (w *Worktree) InitSubmodules(ctx context.Context) ([]Submodule, error) {
+	if _, err := os.Stat(filepath.Join(w.Dir, ".gitmodules")); os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err := updateSubmodules(ctx, w.Dir); err != nil {
+		return nil, err
+	}
+
+	out, err := gitIn(ctx, w.Dir, "submodule", "foreach", "--quiet", "--recursive",
+		`echo "$displaypath|$sha1|$(git config --get remote.origin.url)"`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list submodules: %w", err)
+	}
+	var submodules []Submodule
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "|", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		submodules = append(submodules, Submodule{Path: parts[0], Commit: parts[1], URL: parts[2]})
+	}
+	return submodules, nil
+}
+
+// submoduleProtocols restricts the transports git may use to fetch submodules
+// to https, in case a URL gets past ValidateRemote.
+var submoduleProtocols = []string{"-c", "protocol.allow=never", "-c", "protocol.https.allow=always"}
+
+// updateSubmodules checks out the submodules of the working tree at dir, one
+// level at a time so that the URLs in each nested .gitmodules are validated
+// before git fetches them.
+func updateSubmodules(ctx context.Context, dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".gitmodules")); os.IsNotExist(err) {
+		return nil
+	}
+	if err := checkSubmoduleURLs(ctx, dir); err != nil {
+		return err
+	}
+	args := append([]string{"-C", dir}, submoduleProtocols...)
+	if _, err := run(ctx, "submodule", append(args, "submodule", "update", "--init", "--jobs", "4")); err != nil {
+		return fmt.Errorf("failed to fetch submodules: %w", err)
+	}
+	out, err := gitIn(ctx, dir, "submodule", "foreach", "--quiet", `echo "$sm_path"`)
+	if err != nil {
+		return fmt.Errorf("failed to list submodules: %w", err)
+	}
+	for _, path := range strings.Split(out, "\n") {
+		if path == "" {
+			continue
+		}
+		if err := updateSubmodules(ctx, filepath.Join(dir, path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSubmoduleURLs validates every submodule URL in the .gitmodules of the
+// working tree at dir.
+func checkSubmoduleURLs(ctx context.Context, dir string) error {
+	out, err := gitIn(ctx, dir, "config", "--file", ".gitmodules", "--get-regexp", `^submodule\..*\.url$`)
+	if err != nil {
+		// git config exits with 1 when nothing matches
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil
+		}
+		return fmt.Errorf("failed to read .gitmodules: %w", err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		key, remote, _ := strings.Cut(line, " ")
+		if err := ValidateRemote(remote); err != nil {
+			return fmt.Errorf("submodule %s: %w", strings.TrimSuffix(strings.TrimPrefix(key, "submodule."), ".url"), err)
+		}
+	}
+	return nil
+}
+
+// acquire returns the mirror of remote, pinning it against eviction.
+func (c *Cache) acquire(remote string) *mirror {
+	sum := sha256.Sum256([]byte(remote))
+	key := hex.EncodeToString(sum[:12])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.mirrors[key]
+	if !ok {
+		m = &mirror{dir: filepath.Join(c.root, key+".git")}
+		c.mirrors[key] = m
+	}
+	m.refs++
+	return m
+}
+
+func (c *Cache) release(m *mirror) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m.refs--
+}
+
+// evict removes least recently used mirrors until the cache fits its size limit.
+// Mirrors with live worktrees are never evicted.
+func (c *Cache) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(c.root)
+	if err != nil {
+		c.logger.Printf("gitcache: %v", err)
+		return
+	}
+	type candidate struct {
+		key   string
+		dir   string
+		size  int64
+		mtime time.Time
+	}
+	var candidates []candidate
+	var total int64
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".git") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(c.root, entry.Name())
+		size := dirSize(dir)
+		total += size
+		candidates = append(candidates, candidate{
+			key:   strings.TrimSuffix(entry.Name(), ".git"),
+			dir:   dir,
+			size:  size,
+			mtime: info.ModTime(),
+		})
+	}
+	if total <= c.maxBytes {
+		return
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].mtime.Before(candidates[j].mtime) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cand := range candidates {
+		if total <= c.maxBytes {
+			break
+		}
+		if m, ok := c.mirrors[cand.key]; ok {
+			if m.refs > 0 {
+				continue
+			}
+			delete(c.mirrors, cand.key)
+		}
+		if err := os.RemoveAll(cand.dir); err != nil {
+			c.logger.Printf("gitcache: failed to evict %s: %v", cand.dir, err)
+			continue
+		}
+		total -= cand.size
+		c.logger.Printf("gitcache: evicted %s (%d bytes)", cand.dir, cand.size)
+	}
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// RemoteHead returns the commit SHA that the HEAD of remote points to. The
+// remote must pass ValidateRemote.
+func RemoteHead(ctx context.Context, remote string) (string, error) {
+	if err := ValidateRemote(remote); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	out, err := git(ctx, "", "ls-remote", "--", remote, "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to read remote HEAD of %s: %w", remote, err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("remote %s has no HEAD", remote)
+	}
+	return fields[0], nil
+}
+
+// ReadCommit returns the commit checked out in the working tree at dir.
+func ReadCommit(ctx context.Context, dir string) (*models.CommitInfo, error) {
+	out, err := gitIn(ctx, dir, "log", "-1", "--format=%H%x00%an <%ae>%x00%aI%x00%s")
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(out, "\x00", 4)
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("unexpected git log output %q", out)
+	}
+	date, _ := time.Parse(time.RFC3339, parts[2])
+	return &models.CommitInfo{SHA: parts[0], Author: parts[1], Date: date.UTC(), Subject: parts[3]}, nil
+}
+
+// git runs a git command, against the repository at gitDir if set, and
+// returns its trimmed standard output.
+func git(ctx context.Context, gitDir string, args ...string) (string, error) {
+	if gitDir != "" {
+		return run(ctx, args[0], append([]string{"--git-dir", gitDir}, args...))
+	}
+	return run(ctx, args[0], args)
+}
+
+// gitIn runs a git command inside the working tree at dir.
+func gitIn(ctx context.Context, dir string, args ...string) (string, error) {
+	return run(ctx, args[0], append([]string{"-C", dir}, args...))
+}
+
+func run(ctx context.Context, subcommand string, args []string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	// Never prompt for credentials on the server.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", subcommand, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,205 @@
+package jobs
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job statuses.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+var (
+	// ErrProjectBusy is returned when the project already has a queued or running job.
+	ErrProjectBusy = errors.New("project already has an analysis job in progress")
+	// ErrQueueFull is returned when the queue cannot accept more jobs.
+	ErrQueueFull = errors.New("analysis queue is full")
+)
+
+// Job is the status of an analysis job.
+type Job struct {
+	ID         string    `json:"id"`
+	ProjectID  string    `json:"project_id"`
+	Trigger    string    `json:"trigger"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	SnapshotID string    `json:"snapshot_id,omitempty"`
+	QueuedAt   time.Time `json:"queued_at"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// Func runs a job and returns the ID of the snapshot it produced.
+type Func func(ctx context.Context, jobID string) (snapshotID string, err error)
+
+type task struct {
+	job *Job
+	fn  Func
+}
+
+// maxFinished is how many finished jobs are kept for status lookups.
+const maxFinished = 1000
+
+// Queue runs analysis jobs on a fixed pool of workers. A project never has
+// more than one job queued or running at a time.
+type Queue struct {
+	logger *log.Logger
+	tasks  chan task
+
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	active   map[string]string // project ID -> job ID
+	finished []string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewQueue starts a queue with the given number of workers and capacity.
+func NewQueue(workers, capacity int, logger *log.Logger) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		logger: logger,
+		tasks:  make(chan task, capacity),
+		jobs:   make(map[string]*Job),
+		active: make(map[string]string),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Submit queues fn as a new job of the project.
+func (q *Queue) Submit(projectID, trigger string, fn Func) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, busy := q.active[projectID]; busy {
+		return Job{}, ErrProjectBusy
+	}
+	job := newJob(projectID, trigger)
+	select {
+	case q.tasks <- task{job: job, fn: fn}:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	q.jobs[job.ID] = job
+	q.active[projectID] = job.ID
+	return *job, nil
+}
+
+// Run executes fn as a job of the project in the calling goroutine, so that
+// synchronous analyses are tracked and never overlap queued ones. It returns
+// the finished job and the error returned by fn.
+func (q *Queue) Run(ctx context.Context, projectID, trigger string, fn Func) (Job, error) {
+	q.mu.Lock()
+	if _, busy := q.active[projectID]; busy {
+		q.mu.Unlock()
+		return Job{}, ErrProjectBusy
+	}
+	job := newJob(projectID, trigger)
+	q.jobs[job.ID] = job
+	q.active[projectID] = job.ID
+	q.mu.Unlock()
+
+	err := q.run(ctx, task{job: job, fn: fn})
+	finished, _ := q.Get(job.ID)
+	return finished, err
+}
+
+func newJob(projectID, trigger string) *Job {
+	return &Job{
+		ID:        models.NewID("job"),
+		ProjectID: projectID,
+		Trigger:   trigger,
+		Status:    StatusQueued,
+		QueuedAt:  time.Now().UTC(),
+	}
+}
+
+// Busy reports whether the project has a queued or running job.
+func (q *Queue) Busy(projectID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, busy := q.active[projectID]
+	return busy
+}
+
+// Get returns the status of a job.
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Close stops accepting work, cancels running jobs and waits for the workers to exit.
+func (q *Queue) Close() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case t := <-q.tasks:
+			q.run(q.ctx, t)
+		}
+	}
+}
+
+func (q *Queue) run(ctx context.Context, t task) error {
+	q.update(t.job, func(j *Job) {
+		j.Status = StatusRunning
+		j.StartedAt = time.Now().UTC()
+	})
+
+	snapshotID, err := t.fn(ctx, t.job.ID)
+	if err != nil {
+		q.logger.Printf("job %s for project %s failed: %v", t.job.ID, t.job.ProjectID, err)
+	}
+
+	q.update(t.job, func(j *Job) {
+		j.FinishedAt = time.Now().UTC()
+		j.SnapshotID = snapshotID
+		if err != nil {
+			j.Status = StatusFailed
+			j.Error = err.Error()
+		} else {
+			j.Status = StatusSucceeded
+		}
+		delete(q.active, j.ProjectID)
+
+		q.finished = append(q.finished, j.ID)
+		if len(q.finished) > maxFinished {
+			delete(q.jobs, q.finished[0])
+			q.finished = q.finished[1:]
+		}
+	})
+	return err
+}
+
+func (q *Queue) update(job *Job, fn func(j *Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fn(job)
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// APIKey is a credential for the API. Only the hash of its secret is stored.
+type APIKey struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	SecretHash string `json:"-"`
+	// Admin keys may do anything, including server-wide operations.
+	Admin bool `json:"admin"`
+	// Roles maps project IDs, or "*" for every project, to a role name.
+	Roles     map[string]string `json:"roles,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Audited actions.
+const (
+	AuditUpload         = "archive.upload"
+	AuditClone          = "repo.clone"
+	AuditAnalyzeLocal   = "local.analyze"
+	AuditReanalyze      = "snapshot.reanalyze"
+	AuditQuery          = "query.run"
+	AuditProjectOptions = "project.options"
+	AuditScheduleSet    = "schedule.set"
+	AuditScheduleDelete = "schedule.delete"
+	AuditWebhookCreate  = "webhook.create"
+	AuditWebhookDelete  = "webhook.delete"
+	AuditAPIKeyCreate   = "apikey.create"
+	AuditAPIKeyDelete   = "apikey.delete"
+	AuditGarbageCollect = "gc.run"
+)
+
+// AuditEvent is an entry of the audit log. Entries are never modified or
+// deleted once written.
+type AuditEvent struct {
+	ID         string         `json:"id"`
+	Time       time.Time      `json:"time"`
+	Actor      string         `json:"actor"`       // subject of the caller's credentials, or "system"
+	AuthMethod string         `json:"auth_method"` // "api_key", "jwt", "none" or empty for "system"
+	IP         string         `json:"ip"`
+	Action     string         `json:"action"`
+	ProjectID  string         `json:"project_id,omitempty"`
+	Target     string         `json:"target,omitempty"` // e.g. file name, repository URL or key ID
+	Details    map[string]any `json:"details,omitempty"`
+	DurationMS int64          `json:"duration_ms,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// AuditFilter selects audit events. Zero fields match everything.
+type AuditFilter struct {
+	Actor     string
+	Action    string
+	ProjectID string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
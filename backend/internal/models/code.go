@@ -0,0 +1,199 @@
+package models
+
+// FileNode is a source file in a project's code graph.
+type FileNode struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+}
+
+// FunctionNode is a function or method in a project's code graph. Its ID is
+// the path of its file and its name, joined by "#".
+type FunctionNode struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	File       string `json:"file"`
+	IsExported bool   `json:"is_exported"`
+	IsMethodOf string `json:"is_method_of,omitempty"`
+	// StartLine and EndLine are zero for analyses without line spans.
+	StartLine int `json:"start_line,omitempty"`
+	EndLine   int `json:"end_line,omitempty"`
+	// Params are only set when a single function is requested.
+	Params []string `json:"params,omitempty"`
+}
+
+// Kinds of symbols in a project's code graph.
+const (
+	SymbolFunction = "function"
+	SymbolClass    = "class"
+	SymbolProperty = "property"
+	SymbolFile     = "file"
+	// SymbolModule is the repository or one of its submodules and
+	// SymbolUnknown any other node, which are only met on paths.
+	SymbolModule  = "module"
+	SymbolUnknown = "unknown"
+)
+
+// Directions of impact analysis: up follows callers and importers, down
+// callees and imported files.
+const (
+	ImpactUp   = "up"
+	ImpactDown = "down"
+)
+
+// Kinds of entry points.
+const (
+	EntryMain        = "main"
+	EntryHTTPHandler = "http_handler"
+	EntryExported    = "exported"
+)
+
+// Impact is the transitive closure of a symbol's callers or importers, or of
+// what it calls or imports. Functions and classes reach functions through
+// CALLS edges, the latter through their methods; files reach files through
+// IMPORTS edges.
+type Impact struct {
+	Kind      string `json:"kind"`
+	Symbol    string `json:"symbol"`
+	Direction string `json:"direction"`
+	Depth     int    `json:"depth"`
+	// Nodes are ordered by depth, then ID. Truncated is set if the closure
+	// had more nodes than could be returned.
+	Nodes       []ImpactNode  `json:"nodes"`
+	Files       []ImpactGroup `json:"files"`
+	Packages    []ImpactGroup `json:"packages"`
+	EntryPoints int           `json:"entry_points"`
+	Truncated   bool          `json:"truncated"`
+}
+
+// ImpactNode is a function or file reached from the symbol. Depth is the
+// length of the shortest path to it and Via the previous node on that path.
+type ImpactNode struct {
+	Kind    string `json:"kind"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	File    string `json:"file"`
+	Package string `json:"package"`
+	Depth   int    `json:"depth"`
+	Via     string `json:"via"`
+	// EntryPoint is "main", "http_handler" or "exported" for the nodes
+	// through which outside code reaches the project.
+	EntryPoint string `json:"entry_point,omitempty"`
+}
+
+// ImpactGroup summarizes the impacted nodes of one file or package.
+type ImpactGroup struct {
+	Name        string `json:"name"`
+	Nodes       int    `json:"nodes"`
+	MinDepth    int    `json:"min_depth"`
+	EntryPoints int    `json:"entry_points"`
+}
+
+// ChangedSymbol is a function or class whose lines a change touches.
+type ChangedSymbol struct {
+	Kind       string `json:"kind"`
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	File       string `json:"file"`
+	StartLine  int    `json:"start_line"`
+	EndLine    int    `json:"end_line"`
+	EntryPoint string `json:"entry_point,omitempty"`
+}
+
+// Reasons a test file is a candidate to run for a change.
+const (
+	TestChanged = "changed"
+	TestCalls   = "calls"
+	TestImports = "imports"
+	TestName    = "name"
+)
+
+// TestCandidate is a test file that may exercise changed code: it was
+// changed itself, calls changed functions, imports changed files or is named
+// after one.
+type TestCandidate struct {
+	File    string   `json:"file"`
+	Reasons []string `json:"reasons"`
+}
+
+// DiffImpact is the impact of a change set: the symbols it touches, their
+// transitive callers up to Depth steps away, the entry points among both and
+// the tests that may cover them.
+type DiffImpact struct {
+	Depth   int             `json:"depth"`
+	Changed []ChangedSymbol `json:"changed"`
+	// UnmappedFiles are changed files whose lines could not be mapped to
+	// symbols: files not in the graph, such as new ones, and files analyzed
+	// without line spans.
+	UnmappedFiles []string        `json:"unmapped_files"`
+	Callers       []ImpactNode    `json:"callers"`
+	Files         []ImpactGroup   `json:"files"`
+	Packages      []ImpactGroup   `json:"packages"`
+	EntryPoints   []ImpactNode    `json:"entry_points"`
+	Tests         []TestCandidate `json:"tests"`
+	Truncated     bool            `json:"truncated"`
+}
+
+// Paths are the simple paths from one symbol to another along the Via
+// relationships, at most MaxLength steps long. Paths holds up to the
+// requested number of them, shortest first, and Shortest is the first, or
+// nil if To cannot be reached. Truncated is set if the search was cut short,
+// so that paths may be missing.
+type Paths struct {
+	From      string       `json:"from"`
+	To        string       `json:"to"`
+	Via       []string     `json:"via"`
+	MaxLength int          `json:"max_length"`
+	Shortest  *SymbolPath  `json:"shortest"`
+	Paths     []SymbolPath `json:"paths"`
+	Truncated bool         `json:"truncated"`
+}
+
+// SymbolPath is a path between two symbols. Relationships[i] is the type of
+// the relationship from Nodes[i] to Nodes[i+1].
+type SymbolPath struct {
+	Length        int        `json:"length"`
+	Nodes         []PathNode `json:"nodes"`
+	Relationships []string   `json:"relationships"`
+}
+
+// PathNode is a function, class, file or module on a path.
+type PathNode struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	File string `json:"file"`
+}
+
+// Symbol is a function, class, property or file as indexed for search. A
+// property's export flag is its class's. Degree counts the callers of a
+// function, those of a class's methods and the importers of a file.
+type Symbol struct {
+	Kind       string `json:"kind"`
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	File       string `json:"file"`
+	Language   string `json:"language"`
+	IsExported bool   `json:"is_exported"`
+	Degree     int    `json:"degree"`
+	// Doc is the doc comment of a function or class and Strings the string
+	// literals of a function, which full-text search indexes.
+	Doc     string   `json:"doc,omitempty"`
+	Strings []string `json:"-"`
+}
+
+// Qualities of name search matches, from best to worst, and the match of
+// full-text search.
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchFuzzy  = "fuzzy"
+	MatchText   = "text"
+)
+
+// SearchHit is a symbol found by a search. For name searches, Match is the
+// worst quality with which a word of the query matched the symbol's name.
+type SearchHit struct {
+	Symbol
+	Score float64 `json:"score"`
+	Match string  `json:"match"`
+}
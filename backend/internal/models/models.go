@@ -2,7 +2,8 @@ package models
 
 // Analysis represents the top-level structure of our analysis-output.json.
 type Analysis struct {
-	Files []File `json:"files"`
+	Files   []File   `json:"files"`
+	Modules []Module `json:"modules,omitempty"`
 }
 
 // File represents a single source code file.
@@ -13,6 +14,7 @@ type File struct {
 	Functions []Function `json:"functions,omitempty"`
 	Imports   []Import   `json:"imports,omitempty"`
 	Error     string     `json:"error,omitempty"`
+	Skipped   string     `json:"skipped,omitempty"`
 }
 
 // Class represents a class definition.
@@ -21,6 +23,9 @@ type Class struct {
 	IsExported  bool     `json:"is_exported"`
 	Properties  []string `json:"properties,omitempty"`
 	Methods     []string `json:"methods,omitempty"`
+	StartLine   int      `json:"start_line,omitempty"`
+	EndLine     int      `json:"end_line,omitempty"`
+	Doc         string   `json:"doc,omitempty"`
 }
 
 // Function represents a function or method.
@@ -31,9 +36,21 @@ type Function struct {
 	ReturnTypes []string `json:"return_types,omitempty"`
 	Calls       []string `json:"calls,omitempty"`
 	IsMethodOf  string   `json:"is_method_of,omitempty"`
+	StartLine   int      `json:"start_line,omitempty"`
+	EndLine     int      `json:"end_line,omitempty"`
+	// Doc is the function's doc comment and Strings its string literals.
+	Doc         string   `json:"doc,omitempty"`
+	Strings     []string `json:"strings,omitempty"`
 }
 
 // Import represents an import statement.
 type Import struct {
 	Source string `json:"source"`
 }
+
+// Module represents a git submodule checked out inside the analyzed repository.
+type Module struct {
+	Path   string `json:"path"`
+	URL    string `json:"url"`
+	Commit string `json:"commit"`
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Project groups every analysis of the same codebase.
+type Project struct {
+	ID        string         `json:"id"`
+	RepoURL   string         `json:"repo_url,omitempty"`
+	Schedule  string         `json:"schedule,omitempty"`
+	Options   ProjectOptions `json:"options"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// ProjectOptions control how a project's source is fetched.
+type ProjectOptions struct {
+	// FetchSubmodules recursively checks out git submodules and records them as Module nodes.
+	FetchSubmodules bool `json:"fetch_submodules"`
+}
+
+// Snapshot records the outcome of a single analysis run of a project.
+type Snapshot struct {
+	ID              string          `json:"id"`
+	ProjectID       string          `json:"project_id"`
+	JobID           string          `json:"job_id"`
+	Source          string          `json:"source"`
+	S3Key           string          `json:"s3_key,omitempty"`
+	RepoURL         string          `json:"repo_url,omitempty"`
+	Commit          *CommitInfo     `json:"commit,omitempty"`
+	ArchiveSHA256   string          `json:"archive_sha256,omitempty"`
+	AnalyzerVersion string          `json:"analyzer_version,omitempty"`
+	Metrics         SnapshotMetrics `json:"metrics"`
+	Skipped         []SkippedFile   `json:"skipped_files,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+// CommitInfo identifies the git commit a snapshot was analyzed from.
+type CommitInfo struct {
+	SHA     string    `json:"sha"`
+	Author  string    `json:"author,omitempty"`
+	Date    time.Time `json:"date,omitzero"`
+	Subject string    `json:"subject,omitempty"`
+}
+
+// SkippedFile is a file left out of the graph, with the reason why.
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// SnapshotMetrics holds the graph statistics computed after an import.
+type SnapshotMetrics struct {
+	Files            int64 `json:"files"`
+	Classes          int64 `json:"classes"`
+	Functions        int64 `json:"functions"`
+	ImportCycleFiles int64 `json:"import_cycle_files"`
+	DeadFunctions    int64 `json:"dead_functions"`
+}
+
+// SnapshotDiff is the change in metrics between two consecutive snapshots.
+type SnapshotDiff struct {
+	Previous         string `json:"previous_snapshot,omitempty"`
+	Files            int64  `json:"files"`
+	Classes          int64  `json:"classes"`
+	Functions        int64  `json:"functions"`
+	ImportCycleFiles int64  `json:"import_cycle_files"`
+	DeadFunctions    int64  `json:"dead_functions"`
+}
+
+// Diff returns the metric changes from prev to m.
+func (m SnapshotMetrics) Diff(prev SnapshotMetrics) SnapshotDiff {
+	return SnapshotDiff{
+		Files:            m.Files - prev.Files,
+		Classes:          m.Classes - prev.Classes,
+		Functions:        m.Functions - prev.Functions,
+		ImportCycleFiles: m.ImportCycleFiles - prev.ImportCycleFiles,
+		DeadFunctions:    m.DeadFunctions - prev.DeadFunctions,
+	}
+}
+
+// NewID returns a random identifier with the given prefix, e.g. "snap_3f9a...".
+func NewID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + "_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// Webhook lifecycle events.
+const (
+	EventJobStarted        = "job.started"
+	EventJobCompleted      = "job.completed"
+	EventJobFailed         = "job.failed"
+	EventThresholdExceeded = "snapshot.threshold_exceeded"
+)
+
+// WebhookEvents lists every event a webhook may subscribe to.
+var WebhookEvents = []string{EventJobStarted, EventJobCompleted, EventJobFailed, EventThresholdExceeded}
+
+// Webhook is a per-project subscription to analysis lifecycle events.
+type Webhook struct {
+	ID         string     `json:"id"`
+	ProjectID  string     `json:"project_id"`
+	URL        string     `json:"url"`
+	Secret     string     `json:"secret,omitempty"`
+	Events     []string   `json:"events"`
+	Thresholds Thresholds `json:"thresholds"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Thresholds are the increases between two consecutive snapshots that trigger
+// a snapshot.threshold_exceeded event. Zero disables a threshold.
+type Thresholds struct {
+	ImportCycleFiles int64 `json:"import_cycle_files,omitempty"`
+	DeadFunctions    int64 `json:"dead_functions,omitempty"`
+}
+
+// Exceeded returns the names of the thresholds crossed by diff.
+func (t Thresholds) Exceeded(diff SnapshotDiff) []string {
+	var crossed []string
+	if t.ImportCycleFiles > 0 && diff.ImportCycleFiles >= t.ImportCycleFiles {
+		crossed = append(crossed, "import_cycle_files")
+	}
+	if t.DeadFunctions > 0 && diff.DeadFunctions >= t.DeadFunctions {
+		crossed = append(crossed, "dead_functions")
+	}
+	return crossed
+}
+
+// Subscribes reports whether the webhook wants the given event.
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is the log entry for a single event sent to a webhook.
+type WebhookDelivery struct {
+	ID           string    `json:"id"`
+	WebhookID    string    `json:"webhook_id"`
+	Event        string    `json:"event"`
+	Status       string    `json:"status"`
+	Attempts     int64     `json:"attempts"`
+	ResponseCode int64     `json:"response_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
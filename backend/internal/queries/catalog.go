@@ -0,0 +1,307 @@
+// Package queries is the catalog of named, parameterized Cypher queries that
+// clients can run against a project without writing Cypher themselves.
+package queries
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed catalog.yaml
+var builtin []byte
+
+// Parameter types.
+const (
+	TypeString  = "string"
+	TypeInt     = "int"
+	TypeFloat   = "float"
+	TypeBool    = "bool"
+	TypeStrings = "string_list"
+)
+
+// Result shapes.
+const (
+	ResultTable = "table"
+	ResultGraph = "graph"
+)
+
+// ProjectParam is passed to every query and may not be declared by entries.
+const ProjectParam = "project"
+
+// Param describes a parameter of a query.
+type Param struct {
+	Name        string   `yaml:"name" json:"name"`
+	Type        string   `yaml:"type" json:"type"`
+	Description string   `yaml:"description" json:"description,omitempty"`
+	Required    bool     `yaml:"required" json:"required"`
+	Default     any      `yaml:"default" json:"default,omitempty"`
+	Min         *float64 `yaml:"min" json:"min,omitempty"`
+	Max         *float64 `yaml:"max" json:"max,omitempty"`
+	Enum        []string `yaml:"enum" json:"enum,omitempty"`
+}
+
+// Limits override the server's query limits for an entry. They can only make
+// them stricter.
+type Limits struct {
+	MaxRows int           `yaml:"max_rows" json:"max_rows,omitempty"`
+	Timeout time.Duration `yaml:"timeout" json:"timeout,omitempty"`
+}
+
+// Entry is a named query.
+type Entry struct {
+	Name        string  `yaml:"name" json:"name"`
+	Description string  `yaml:"description" json:"description"`
+	Category    string  `yaml:"category" json:"category,omitempty"`
+	Cypher      string  `yaml:"cypher" json:"cypher"`
+	Params      []Param `yaml:"params" json:"params"`
+	Limits      Limits  `yaml:"limits" json:"limits"`
+	Result      string  `yaml:"result" json:"result"`
+	// Source is "builtin" or the file a user-defined entry was loaded from.
+	Source string `yaml:"-" json:"source"`
+}
+
+// Catalog holds the named queries by name.
+type Catalog struct {
+	entries map[string]*Entry
+}
+
+// Load returns the built-in catalog extended with the entries of the YAML
+// files in paths. A user-defined entry replaces a built-in one of the same
+// name.
+func Load(paths ...string) (*Catalog, error) {
+	c := &Catalog{entries: make(map[string]*Entry)}
+	if err := c.add(builtin, "builtin"); err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read query catalog: %w", err)
+		}
+		if err := c.add(data, path); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Catalog) add(data []byte, source string) error {
+	var entries []*Entry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("invalid query catalog %s: %w", source, err)
+	}
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if seen[e.Name] {
+			return fmt.Errorf("query catalog %s: duplicate query %q", source, e.Name)
+		}
+		seen[e.Name] = true
+		if err := e.validate(); err != nil {
+			return fmt.Errorf("query catalog %s: %w", source, err)
+		}
+		e.Source = source
+		c.entries[e.Name] = e
+	}
+	return nil
+}
+
+// namePattern restricts query and parameter names to identifiers.
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+func (e *Entry) validate() error {
+	if !namePattern.MatchString(e.Name) {
+		return fmt.Errorf("invalid query name %q", e.Name)
+	}
+	if e.Cypher == "" {
+		return fmt.Errorf("query %s has no cypher", e.Name)
+	}
+	if err := checkScope(e.Cypher); err != nil {
+		return fmt.Errorf("query %s: %w", e.Name, err)
+	}
+	if e.Result == "" {
+		e.Result = ResultTable
+	}
+	if e.Result != ResultTable && e.Result != ResultGraph {
+		return fmt.Errorf("query %s: result must be %q or %q", e.Name, ResultTable, ResultGraph)
+	}
+	if e.Params == nil {
+		e.Params = []Param{}
+	}
+	names := map[string]bool{ProjectParam: true}
+	for i := range e.Params {
+		p := &e.Params[i]
+		if !namePattern.MatchString(p.Name) || names[p.Name] {
+			return fmt.Errorf("query %s: invalid or duplicate parameter %q", e.Name, p.Name)
+		}
+		names[p.Name] = true
+		switch p.Type {
+		case TypeString, TypeInt, TypeFloat, TypeBool, TypeStrings:
+		default:
+			return fmt.Errorf("query %s: parameter %s has unknown type %q", e.Name, p.Name, p.Type)
+		}
+		if p.Default != nil {
+			value, err := p.coerce(p.Default)
+			if err != nil {
+				return fmt.Errorf("query %s: default of %w", e.Name, err)
+			}
+			p.Default = value
+		}
+	}
+	return nil
+}
+
+// Get returns the named entry.
+func (c *Catalog) Get(name string) (*Entry, bool) {
+	e, ok := c.entries[name]
+	return e, ok
+}
+
+// List returns every entry ordered by category and name.
+func (c *Catalog) List() []*Entry {
+	entries := make([]*Entry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Category != entries[j].Category {
+			return entries[i].Category < entries[j].Category
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// ParamError reports an invalid parameter value.
+type ParamError struct {
+	Param  string
+	Reason string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("parameter %s %s", e.Param, e.Reason)
+}
+
+// Bind validates the caller's parameter values and returns the complete
+// parameter map for the query, with defaults filled in and the project set.
+// Optional parameters without a value or default are passed as null.
+func (e *Entry) Bind(projectID string, values map[string]any) (map[string]any, error) {
+	params := map[string]any{ProjectParam: projectID}
+	for name := range values {
+		if !slices.ContainsFunc(e.Params, func(p Param) bool { return p.Name == name }) {
+			return nil, &ParamError{Param: name, Reason: "is not accepted by this query"}
+		}
+	}
+	for _, p := range e.Params {
+		raw, ok := values[p.Name]
+		if !ok || raw == nil {
+			if p.Required {
+				return nil, &ParamError{Param: p.Name, Reason: "is required"}
+			}
+			params[p.Name] = p.Default
+			continue
+		}
+		value, err := p.coerce(raw)
+		if err != nil {
+			return nil, err
+		}
+		params[p.Name] = value
+	}
+	return params, nil
+}
+
+// coerce converts a decoded JSON or YAML value to the parameter's type and
+// checks its constraints.
+func (p *Param) coerce(raw any) (any, error) {
+	invalid := func(reason string) error {
+		return &ParamError{Param: p.Name, Reason: reason}
+	}
+	var value any
+	switch p.Type {
+	case TypeString:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, invalid("must be a string")
+		}
+		if len(p.Enum) > 0 && !slices.Contains(p.Enum, s) {
+			return nil, invalid(fmt.Sprintf("must be one of %v", p.Enum))
+		}
+		value = s
+	case TypeInt:
+		n, ok := number(raw)
+		if !ok || n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+			return nil, invalid("must be an integer")
+		}
+		if err := p.checkRange(n); err != nil {
+			return nil, err
+		}
+		value = int64(n)
+	case TypeFloat:
+		n, ok := number(raw)
+		if !ok {
+			return nil, invalid("must be a number")
+		}
+		if err := p.checkRange(n); err != nil {
+			return nil, err
+		}
+		value = n
+	case TypeBool:
+		b, ok := raw.(bool)
+		if !ok {
+			return nil, invalid("must be a boolean")
+		}
+		value = b
+	case TypeStrings:
+		list, ok := raw.([]any)
+		if !ok {
+			return nil, invalid("must be a list of strings")
+		}
+		strs := make([]string, len(list))
+		for i, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, invalid("must be a list of strings")
+			}
+			if len(p.Enum) > 0 && !slices.Contains(p.Enum, s) {
+				return nil, invalid(fmt.Sprintf("may only contain %v", p.Enum))
+			}
+			strs[i] = s
+		}
+		value = strs
+	default:
+		return nil, errors.New("unknown parameter type " + p.Type)
+	}
+	return value, nil
+}
+
+func (p *Param) checkRange(n float64) error {
+	if p.Min != nil && n < *p.Min {
+		return &ParamError{Param: p.Name, Reason: fmt.Sprintf("must be at least %g", *p.Min)}
+	}
+	if p.Max != nil && n > *p.Max {
+		return &ParamError{Param: p.Name, Reason: fmt.Sprintf("must be at most %g", *p.Max)}
+	}
+	return nil
+}
+
+// number returns raw as a float64 if it is numeric. JSON numbers decode as
+// float64 and YAML integers as int.
+func number(raw any) (float64, bool) {
+	switch n := raw.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,137 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// GraphLabels are the labels of the nodes of a project's code graph, the only
+// ones catalog queries may match. Other nodes carry a project too, such as
+// webhooks with their signing secrets, and must stay out of reach.
+var GraphLabels = []string{"File", "Class", "Function", "Property", "Parameter", "Module"}
+
+var (
+	// literalOrComment matches string literals and comments, which are blanked
+	// out before the query is inspected
+	literalOrComment = regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"|//[^\n]*|/\*(?s:.*?)\*/`)
+	// nodePattern matches a node pattern with its variable, label expression
+	// and property map
+	nodePattern = regexp.MustCompile(`\(\s*(?:[A-Za-z_]\w*)?\s*(:[^(){}\[\]]*?)?\s*(\{[^{}]*\})?\s*\)`)
+	// projectProperty matches the property that scopes a node to the project
+	projectProperty = regexp.MustCompile(`[{,]\s*project\s*:\s*\$project\s*[,}]`)
+	// matchClause matches the start of a MATCH or OPTIONAL MATCH clause
+	matchClause = regexp.MustCompile(`(?i)\bMATCH\b`)
+	// clauseEnd matches the keywords that end the pattern of a MATCH clause
+	clauseEnd = regexp.MustCompile(`(?i)\b(?:WHERE|WITH|RETURN|MATCH|OPTIONAL|UNWIND|CALL|ORDER|UNION|SKIP|LIMIT|USING|CREATE|MERGE|DELETE|DETACH|SET|REMOVE|FOREACH)\b`)
+	// procedureCall matches calls of procedures, which are not subqueries
+	procedureCall = regexp.MustCompile(`(?i)\bCALL\s+[A-Za-z_]|\bLOAD\s+CSV\b`)
+)
+
+// checkScope verifies that a query can only read the code graph of the project
+// passed as $project. Each pattern of each MATCH must hold a node of one of
+// the GraphLabels with {project: $project}, every labeled node must be of
+// GraphLabels, and procedures may not be called. Code graph nodes are only
+// related to each other, so what such patterns reach stays in the project.
+func checkScope(cypher string) error {
+	cypher = literalOrComment.ReplaceAllStringFunc(cypher, func(s string) string {
+		if strings.HasPrefix(s, "/") {
+			return " "
+		}
+		return "''"
+	})
+	if strings.Contains(cypher, "`") {
+		return errors.New("quoted identifiers are not allowed")
+	}
+	if procedureCall.MatchString(cypher) {
+		return errors.New("procedure calls are not allowed")
+	}
+	for _, m := range nodePattern.FindAllStringSubmatch(cypher, -1) {
+		if m[1] == "" {
+			if projectProperty.MatchString(m[2]) {
+				return fmt.Errorf("node pattern %s must have a label", m[0])
+			}
+			continue
+		}
+		if _, err := graphLabels(m[1]); err != nil {
+			return fmt.Errorf("node pattern %s: %w", m[0], err)
+		}
+	}
+
+	matches := matchClause.FindAllStringIndex(cypher, -1)
+	if len(matches) == 0 {
+		return errors.New("query must MATCH the project's nodes")
+	}
+	for _, loc := range matches {
+		for _, part := range matchPatterns(cypher[loc[1]:]) {
+			if !anchored(part) {
+				return fmt.Errorf("pattern %s must include a %s node with {project: $project}", strings.TrimSpace(part), strings.Join(GraphLabels, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// graphLabels returns the labels of a label expression such as ":File" or
+// ":Function|Class", failing for any outside GraphLabels or negated ones.
+func graphLabels(expr string) ([]string, error) {
+	if strings.ContainsAny(expr, "!%") {
+		return nil, errors.New("negated and wildcard labels are not allowed")
+	}
+	labels := strings.FieldsFunc(expr, func(r rune) bool {
+		return r == ':' || r == '|' || r == '&' || r == ' ' || r == '\t' || r == '\n' || r == '(' || r == ')'
+	})
+	if len(labels) == 0 {
+		return nil, errors.New("empty label expression")
+	}
+	for _, label := range labels {
+		if !slices.Contains(GraphLabels, label) {
+			return nil, fmt.Errorf("label %s is not part of the code graph", label)
+		}
+	}
+	return labels, nil
+}
+
+// matchPatterns returns the comma-separated patterns at the start of the text
+// following a MATCH keyword.
+func matchPatterns(rest string) []string {
+	end := len(rest)
+	if loc := clauseEnd.FindStringIndex(rest); loc != nil {
+		end = loc[0]
+	}
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < end; i++ {
+		switch rest[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']':
+			depth--
+		case '}':
+			if depth == 0 {
+				// The end of a subquery
+				return append(parts, rest[start:i])
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, rest[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, rest[start:end])
+}
+
+// anchored reports whether a pattern holds a labeled node scoped to the
+// project.
+func anchored(pattern string) bool {
+	for _, m := range nodePattern.FindAllStringSubmatch(pattern, -1) {
+		if m[1] != "" && projectProperty.MatchString(m[2]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package queries
+
+import "testing"
+
+func TestCheckScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		cypher string
+		ok     bool
+	}{
+		{"labeled anchor", `MATCH (f:File {project: $project}) RETURN f.path`, true},
+		{"label expression", `MATCH (n:Function|Class {project: $project}) RETURN n`, true},
+		{"anchored path", `MATCH (f:File {project: $project})-[:CONTAINS]->(item) RETURN item`, true},
+		{"anchor at the end", `MATCH (caller)-[:CALLS]->(fn:Function {project: $project, name: $name}) RETURN caller`, true},
+		{"optional match", `MATCH (f:File {project: $project}) OPTIONAL MATCH (f)-[:IMPORTS]->(g:File {project: $project}) RETURN f, g`, true},
+		{"pattern predicate", `MATCH (n:Function {project: $project}) WHERE NOT (n)--() RETURN n`, true},
+		{"subquery", `MATCH (f:File {project: $project}) CALL { WITH f MATCH (f)-[:CONTAINS]->(c:Class {project: $project}) RETURN count(c) AS classes } RETURN f, classes`, true},
+		{"string mentions a label", `MATCH (f:File {project: $project}) WHERE f.path <> '(w:Webhook)' RETURN f`, true},
+
+		{"no project", `MATCH (f:File) RETURN f`, false},
+		{"unlabeled node", `MATCH (n {project: $project}) RETURN n`, false},
+		{"project in WHERE only", `MATCH (f:File) WHERE f.project = $project RETURN f`, false},
+		{"other project", `MATCH (f:File {project: 'other'}) RETURN f`, false},
+		{"webhook", `MATCH (w:Webhook {project: $project}) RETURN w.secret`, false},
+		{"webhook in a later pattern", `MATCH (f:File {project: $project})-[:IMPORTS]->(:Webhook) RETURN f`, false},
+		{"unanchored second pattern", `MATCH (f:File {project: $project}), (g:File) RETURN g`, false},
+		{"unanchored second match", `MATCH (f:File {project: $project}) MATCH (g:Function) RETURN g`, false},
+		{"negated label", `MATCH (n:!File {project: $project}) RETURN n`, false},
+		{"wildcard label", `MATCH (n:% {project: $project}) RETURN n`, false},
+		{"quoted label", "MATCH (n:`Webhook` {project: $project}) RETURN n", false},
+		{"procedure", `MATCH (f:File {project: $project}) CALL db.labels() YIELD label RETURN label`, false},
+		{"no match", `RETURN 1`, false},
+		{"commented anchor", `MATCH (f:File) // {project: $project}
+RETURN f`, false},
+	}
+	for _, tt := range tests {
+		err := checkScope(tt.cypher)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: checkScope = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestLoadBuiltin(t *testing.T) {
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(c.List()) == 0 {
+		t.Fatal("the built-in catalog is empty")
+	}
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Rate is the refill rate and capacity of a token bucket. A zero PerMinute
+// disables the limit.
+type Rate struct {
+	PerMinute int `json:"per_minute"`
+	Burst     int `json:"burst"`
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket per key, e.g. per API key or client IP.
+type Limiter struct {
+	rate Rate
+	now  func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter creates a limiter whose buckets refill at rate.
+func NewLimiter(rate Rate) *Limiter {
+	if rate.Burst < 1 {
+		rate.Burst = 1
+	}
+	return &Limiter{rate: rate, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// Rate returns the limiter's rate.
+func (l *Limiter) Rate() Rate {
+	return l.rate
+}
+
+// Allow takes a token from the key's bucket. If the bucket is empty it returns
+// false and how long until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l.rate.PerMinute <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(key, l.now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.perSecond() * float64(time.Second))
+	return false, wait
+}
+
+// Remaining returns how many requests the key may make right now.
+func (l *Limiter) Remaining(key string) int {
+	if l.rate.PerMinute <= 0 {
+		return -1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(math.Floor(l.refill(key, l.now()).tokens))
+}
+
+// refill returns the key's bucket topped up for the time since it was last
+// used. Buckets that have refilled completely are dropped now and then, as
+// they are indistinguishable from new ones.
+func (l *Limiter) refill(key string, now time.Time) *bucket {
+	if now.Sub(l.lastSweep) > time.Minute {
+		l.lastSweep = now
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.perSecond() >= float64(l.rate.Burst) {
+				delete(l.buckets, k)
+			}
+		}
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rate.Burst), last: now}
+		l.buckets[key] = b
+		return b
+	}
+	b.tokens = math.Min(float64(l.rate.Burst), b.tokens+now.Sub(b.last).Seconds()*l.perSecond())
+	b.last = now
+	return b
+}
+
+func (l *Limiter) perSecond() float64 {
+	return float64(l.rate.PerMinute) / 60
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for tests.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func TestLimiterAllow(t *testing.T) {
+	type step struct {
+		advance time.Duration
+		allowed bool
+		wait    time.Duration
+	}
+	tests := []struct {
+		name  string
+		rate  Rate
+		steps []step
+	}{
+		{
+			name:  "unlimited",
+			rate:  Rate{},
+			steps: []step{{0, true, 0}, {0, true, 0}, {0, true, 0}},
+		},
+		{
+			name:  "burst then empty",
+			rate:  Rate{PerMinute: 60, Burst: 2},
+			steps: []step{{0, true, 0}, {0, true, 0}, {0, false, time.Second}},
+		},
+		{
+			name: "refills over time",
+			rate: Rate{PerMinute: 60, Burst: 1},
+			steps: []step{
+				{0, true, 0},
+				{500 * time.Millisecond, false, 500 * time.Millisecond},
+				{500 * time.Millisecond, true, 0},
+			},
+		},
+		{
+			name:  "refill is capped at the burst",
+			rate:  Rate{PerMinute: 60, Burst: 2},
+			steps: []step{{time.Hour, true, 0}, {0, true, 0}, {0, false, time.Second}},
+		},
+		{
+			name:  "zero burst allows one",
+			rate:  Rate{PerMinute: 30},
+			steps: []step{{0, true, 0}, {0, false, 2 * time.Second}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &clock{time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+			l := NewLimiter(tt.rate)
+			l.now = c.now
+			for i, s := range tt.steps {
+				c.t = c.t.Add(s.advance)
+				allowed, wait := l.Allow("k")
+				if allowed != s.allowed || wait != s.wait {
+					t.Errorf("step %d: Allow = %v, %v; want %v, %v", i, allowed, wait, s.allowed, s.wait)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterKeysAreSeparate(t *testing.T) {
+	l := NewLimiter(Rate{PerMinute: 1, Burst: 1})
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first request of a was refused")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("second request of a was allowed")
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("first request of b was refused")
+	}
+}
+
+func TestLimiterRemaining(t *testing.T) {
+	tests := []struct {
+		rate     Rate
+		requests int
+		want     int
+	}{
+		{Rate{}, 3, -1},
+		{Rate{PerMinute: 60, Burst: 5}, 0, 5},
+		{Rate{PerMinute: 60, Burst: 5}, 3, 2},
+		{Rate{PerMinute: 60, Burst: 5}, 7, 0},
+	}
+	for _, tt := range tests {
+		c := &clock{time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+		l := NewLimiter(tt.rate)
+		l.now = c.now
+		for range tt.requests {
+			l.Allow("k")
+		}
+		if got := l.Remaining("k"); got != tt.want {
+			t.Errorf("%+v after %d requests: Remaining = %d, want %d", tt.rate, tt.requests, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Quota limits what a single client may consume. A zero field disables that
+// limit.
+type Quota struct {
+	// MaxJobs is how many analyses a client may have queued or running at once.
+	MaxJobs int `json:"max_jobs"`
+	// ArchiveBytesPerDay caps the archive bytes a client may upload per UTC day.
+	ArchiveBytesPerDay int64 `json:"archive_bytes_per_day"`
+	// QueryTimePerMinute caps the database time a client's queries may take
+	// per minute.
+	QueryTimePerMinute time.Duration `json:"query_time_per_minute"`
+}
+
+// jobRetryAfter is suggested to clients at their job limit; when one of their
+// jobs finishes is unknown.
+const jobRetryAfter = 30 * time.Second
+
+// ExceededError is returned when a client is over a quota.
+type ExceededError struct {
+	Quota      string // "jobs", "archive_bytes" or "query_time"
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	switch e.Quota {
+	case "jobs":
+		return "too many analyses in progress"
+	case "archive_bytes":
+		return "daily archive upload quota exceeded"
+	case "query_time":
+		return "query time quota exceeded"
+	}
+	return fmt.Sprintf("%s quota exceeded", e.Quota)
+}
+
+// usage is a client's consumption in the current windows.
+type usage struct {
+	jobs         int
+	day          time.Time // start of the UTC day archiveBytes counts
+	archiveBytes int64
+	minute       time.Time // start of the minute queryTime counts
+	queryTime    time.Duration
+}
+
+// roll resets the counters of windows that have ended.
+func (u *usage) roll(now time.Time) {
+	if day := now.UTC().Truncate(24 * time.Hour); !day.Equal(u.day) {
+		u.day, u.archiveBytes = day, 0
+	}
+	if minute := now.Truncate(time.Minute); !minute.Equal(u.minute) {
+		u.minute, u.queryTime = minute, 0
+	}
+}
+
+func (u *usage) idle() bool {
+	return u.jobs == 0 && u.archiveBytes == 0 && u.queryTime == 0
+}
+
+// Quotas tracks each client's consumption against a quota. Clients are
+// identified by an opaque string, such as the subject of their credentials.
+type Quotas struct {
+	quota Quota
+	now   func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*usage
+}
+
+// NewQuotas creates a tracker enforcing quota.
+func NewQuotas(quota Quota) *Quotas {
+	return &Quotas{quota: quota, now: time.Now, clients: make(map[string]*usage)}
+}
+
+// get returns the client's usage with expired windows reset. Callers must hold
+// q.mu.
+func (q *Quotas) get(client string, now time.Time) *usage {
+	u, ok := q.clients[client]
+	if !ok {
+		u = &usage{}
+		q.clients[client] = u
+	}
+	u.roll(now)
+	return u
+}
+
+// forget drops the client's usage once there is nothing to remember. Callers
+// must hold q.mu.
+func (q *Quotas) forget(client string) {
+	if u, ok := q.clients[client]; ok && u.idle() {
+		delete(q.clients, client)
+	}
+}
+
+// AcquireJob counts a new analysis of the client. The returned function must
+// be called when the analysis finishes.
+func (q *Quotas) AcquireJob(client string) (release func(), err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.get(client, q.now())
+	if q.quota.MaxJobs > 0 && u.jobs >= q.quota.MaxJobs {
+		q.forget(client)
+		return nil, &ExceededError{Quota: "jobs", RetryAfter: jobRetryAfter}
+	}
+	u.jobs++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.get(client, q.now()).jobs--
+			q.forget(client)
+		})
+	}, nil
+}
+
+// ReserveArchive charges n archive bytes to the client, failing if that would
+// exceed the daily quota or the quota is already used up.
+func (q *Quotas) ReserveArchive(client string, n int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	u := q.get(client, now)
+	if limit := q.quota.ArchiveBytesPerDay; limit > 0 && (u.archiveBytes >= limit || u.archiveBytes+n > limit) {
+		q.forget(client)
+		return &ExceededError{Quota: "archive_bytes", RetryAfter: u.day.Add(24 * time.Hour).Sub(now)}
+	}
+	u.archiveBytes += n
+	q.forget(client)
+	return nil
+}
+
+// RemainingArchive returns the archive bytes the client may still upload
+// today, or math.MaxInt64 if there is no daily quota.
+func (q *Quotas) RemainingArchive(client string) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	limit := q.quota.ArchiveBytesPerDay
+	if limit <= 0 {
+		return math.MaxInt64
+	}
+	u := q.get(client, q.now())
+	defer q.forget(client)
+	return max(limit-u.archiveBytes, 0)
+}
+
+// RefundArchive returns n reserved archive bytes to the client, for uploads
+// that were rejected or turned out smaller than reserved. Reservations of an
+// earlier day are not refunded.
+func (q *Quotas) RefundArchive(client string, n int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	u := q.get(client, q.now())
+	u.archiveBytes = max(u.archiveBytes-n, 0)
+	q.forget(client)
+}
+
+// AllowQuery reports whether the client has query time left this minute.
+func (q *Quotas) AllowQuery(client string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	u := q.get(client, now)
+	defer q.forget(client)
+	if limit := q.quota.QueryTimePerMinute; limit > 0 && u.queryTime >= limit {
+		return &ExceededError{Quota: "query_time", RetryAfter: u.minute.Add(time.Minute).Sub(now)}
+	}
+	return nil
+}
+
+// ChargeQuery adds the time a query of the client took.
+func (q *Quotas) ChargeQuery(client string, d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.get(client, q.now()).queryTime += d
+	q.forget(client)
+}
+
+// Usage is a client's consumption against its quota.
+type Usage struct {
+	Jobs              int       `json:"jobs"`
+	MaxJobs           int       `json:"max_jobs"`
+	ArchiveBytes      int64     `json:"archive_bytes"`
+	MaxArchiveBytes   int64     `json:"max_archive_bytes"`
+	ArchiveBytesReset time.Time `json:"archive_bytes_reset"`
+	QueryTimeMS       int64     `json:"query_time_ms"`
+	MaxQueryTimeMS    int64     `json:"max_query_time_ms"`
+	QueryTimeReset    time.Time `json:"query_time_reset"`
+}
+
+// Usage returns the client's current consumption. Zero maximums are unlimited.
+func (q *Quotas) Usage(client string) Usage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.get(client, q.now())
+	defer q.forget(client)
+	return Usage{
+		Jobs:              u.jobs,
+		MaxJobs:           q.quota.MaxJobs,
+		ArchiveBytes:      u.archiveBytes,
+		MaxArchiveBytes:   q.quota.ArchiveBytesPerDay,
+		ArchiveBytesReset: u.day.Add(24 * time.Hour),
+		QueryTimeMS:       u.queryTime.Milliseconds(),
+		MaxQueryTimeMS:    q.quota.QueryTimePerMinute.Milliseconds(),
+		QueryTimeReset:    u.minute.Add(time.Minute).UTC(),
+	}
+}
@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func newTestQuotas(quota Quota, c *clock) *Quotas {
+	q := NewQuotas(quota)
+	q.now = c.now
+	return q
+}
+
+func TestReserveArchive(t *testing.T) {
+	type step struct {
+		advance time.Duration
+		n       int64
+		ok      bool
+	}
+	tests := []struct {
+		name  string
+		limit int64
+		steps []step
+	}{
+		{"unlimited", 0, []step{{0, 1 << 40, true}, {0, 1 << 40, true}}},
+		{"within the limit", 100, []step{{0, 60, true}, {0, 40, true}}},
+		{"over the limit", 100, []step{{0, 60, true}, {0, 41, false}, {0, 40, true}}},
+		{"used up", 100, []step{{0, 100, true}, {0, 0, false}}},
+		{"next day", 100, []step{{0, 100, true}, {12 * time.Hour, 1, true}}},
+		{"same day", 100, []step{{0, 100, true}, {11 * time.Hour, 1, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &clock{time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+			q := newTestQuotas(Quota{ArchiveBytesPerDay: tt.limit}, c)
+			for i, s := range tt.steps {
+				c.t = c.t.Add(s.advance)
+				err := q.ReserveArchive("c", s.n)
+				if (err == nil) != s.ok {
+					t.Fatalf("step %d: ReserveArchive(%d) = %v, want ok %v", i, s.n, err, s.ok)
+				}
+			}
+		})
+	}
+}
+
+func TestReserveArchiveRetryAfter(t *testing.T) {
+	c := &clock{time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)}
+	q := newTestQuotas(Quota{ArchiveBytesPerDay: 10}, c)
+	var exceeded *ExceededError
+	if err := q.ReserveArchive("c", 11); !errors.As(err, &exceeded) {
+		t.Fatalf("ReserveArchive = %v, want an ExceededError", err)
+	}
+	if exceeded.Quota != "archive_bytes" || exceeded.RetryAfter != 6*time.Hour {
+		t.Errorf("got %+v, want archive_bytes retrying after 6h", exceeded)
+	}
+}
+
+func TestRemainingAndRefundArchive(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int64
+		reserved int64
+		refunded int64
+		want     int64
+	}{
+		{"unlimited", 0, 50, 0, math.MaxInt64},
+		{"nothing used", 100, 0, 0, 100},
+		{"partly used", 100, 70, 0, 30},
+		{"partly refunded", 100, 70, 20, 50},
+		{"fully refunded", 100, 70, 70, 100},
+		{"refund beyond usage", 100, 70, 500, 100},
+	}
+	for _, tt := range tests {
+		c := &clock{time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+		q := newTestQuotas(Quota{ArchiveBytesPerDay: tt.limit}, c)
+		if err := q.ReserveArchive("c", tt.reserved); err != nil {
+			t.Fatalf("%s: ReserveArchive: %v", tt.name, err)
+		}
+		q.RefundArchive("c", tt.refunded)
+		if got := q.RemainingArchive("c"); got != tt.want {
+			t.Errorf("%s: RemainingArchive = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAcquireJob(t *testing.T) {
+	q := NewQuotas(Quota{MaxJobs: 2})
+	first, err := q.AcquireJob("c")
+	if err != nil {
+		t.Fatalf("first job: %v", err)
+	}
+	if _, err := q.AcquireJob("c"); err != nil {
+		t.Fatalf("second job: %v", err)
+	}
+	if _, err := q.AcquireJob("c"); err == nil {
+		t.Fatal("third job was allowed")
+	}
+	if _, err := q.AcquireJob("other"); err != nil {
+		t.Errorf("job of another client: %v", err)
+	}
+	first()
+	first()
+	if _, err := q.AcquireJob("c"); err != nil {
+		t.Errorf("job after a release: %v", err)
+	}
+	if _, err := q.AcquireJob("c"); err == nil {
+		t.Error("a release counted twice")
+	}
+}
+
+func TestQueryTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		charged []time.Duration
+		advance time.Duration
+		ok      bool
+	}{
+		{"none used", nil, 0, true},
+		{"some left", []time.Duration{20 * time.Second}, 0, true},
+		{"used up", []time.Duration{20 * time.Second, 40 * time.Second}, 0, false},
+		{"next minute", []time.Duration{time.Minute}, 30 * time.Second, true},
+		{"same minute", []time.Duration{time.Minute}, 29 * time.Second, false},
+	}
+	for _, tt := range tests {
+		c := &clock{time.Date(2024, 5, 1, 12, 0, 30, 0, time.UTC)}
+		q := newTestQuotas(Quota{QueryTimePerMinute: time.Minute}, c)
+		for _, d := range tt.charged {
+			q.ChargeQuery("c", d)
+		}
+		c.t = c.t.Add(tt.advance)
+		if err := q.AllowQuery("c"); (err == nil) != tt.ok {
+			t.Errorf("%s: AllowQuery = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
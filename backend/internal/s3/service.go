@@ -2,114 +2,307 @@ package s3
 
 import (
 	"archive/zip"
-	"bytes"
+	"codemap/backend/internal/gc"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 type Service struct {
-	uploader *s3manager.Uploader
-	bucket   string
+	uploader   *s3manager.Uploader
+	downloader *s3manager.Downloader
+	bucket     string
 }
 
-func NewS3Service(region, accessKey, secretKey, bucket string) (*Service, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String(region),
-		Credentials: credentials.NewStaticCredentials(accessKey, secretKey, ""),
-	})
+// NewS3Service connects to S3. A non-empty endpoint selects an S3-compatible
+// service such as MinIO, which usually also needs path-style addressing.
+func NewS3Service(region, accessKey, secretKey, bucket, endpoint string, forcePathStyle bool) (*Service, error) {
+	cfg := &aws.Config{
+		Region:           aws.String(region),
+		Credentials:      credentials.NewStaticCredentials(accessKey, secretKey, ""),
+		S3ForcePathStyle: aws.Bool(forcePathStyle),
+	}
+	if endpoint != "" {
+		cfg.Endpoint = aws.String(endpoint)
+	}
+	sess, err := session.NewSession(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AWS session: %w", err)
 	}
 
 	uploader := s3manager.NewUploader(sess)
+	downloader := s3manager.NewDownloader(sess)
 
 	return &Service{
-		uploader: uploader,
-		bucket:   bucket,
+		uploader:   uploader,
+		downloader: downloader,
+		bucket:     bucket,
 	}, nil
 }
 
-// UploadZipFile uploads a zip file to S3 and returns the S3 key
-func (s *Service) UploadZipFile(zipData []byte, filename string) (string, error) {
-	// Generate unique key with timestamp
-	timestamp := time.Now().Format("20060102-150405")
-	key := fmt.Sprintf("projects/%s-%s", timestamp, filename)
+// ArchiveKey returns the content address an archive with the given SHA-256 is stored under
+func ArchiveKey(digest string) string {
+	return "archives/sha256/" + digest
+}
+
+// UploadArchive streams an archive to S3 under its content address and returns
+// the S3 key. Archives that are already stored are not uploaded again.
+func (s *Service) UploadArchive(body io.Reader, digest, contentType string) (string, error) {
+	key := ArchiveKey(digest)
+
+	reused, err := s.reuse(key, contentType)
+	if err != nil {
+		return "", err
+	}
+	if reused {
+		return key, nil
+	}
 
-	_, err := s.uploader.Upload(&s3manager.UploadInput{
+	_, err = s.uploader.Upload(&s3manager.UploadInput{
 		Bucket:      aws.String(s.bucket),
 		Key:         aws.String(key),
-		Body:        bytes.NewReader(zipData),
-		ContentType: aws.String("application/zip"),
+		Body:        body,
+		ContentType: aws.String(contentType),
 	})
 
 	if err != nil {
-		return "", fmt.Errorf("failed to upload zip to S3: %w", err)
+		return "", fmt.Errorf("failed to upload archive to S3: %w", err)
 	}
 
 	return key, nil
 }
 
-// UploadGitRepo clones a GitHub repo and uploads it as a zip to S3
-func (s *Service) UploadGitRepo(repoURL string) (string, error) {
-	// Create temp directory for cloning
-	tempDir, err := os.MkdirTemp("", "git-clone-*")
+// Download writes the object stored under key to w and returns its size
+func (s *Service) Download(key string, w io.WriterAt) (int64, error) {
+	n, err := s.downloader.Download(w, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp dir: %w", err)
+		return 0, fmt.Errorf("failed to download %s from S3: %w", key, err)
 	}
-	defer os.RemoveAll(tempDir)
+	return n, nil
+}
+
+// List returns the objects stored under prefix
+func (s *Service) List(prefix string) ([]gc.Object, error) {
+	var objects []gc.Object
+	err := s.uploader.S3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			objects = append(objects, gc.Object{
+				Key:          aws.StringValue(obj.Key),
+				Size:         aws.Int64Value(obj.Size),
+				LastModified: aws.TimeValue(obj.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s in S3: %w", prefix, err)
+	}
+	return objects, nil
+}
 
-	// Extract repo name from URL
-	repoName := extractRepoName(repoURL)
-	cloneDir := filepath.Join(tempDir, repoName)
+// Delete removes the objects stored under keys
+func (s *Service) Delete(keys []string) error {
+	// DeleteObjects accepts at most 1000 keys per request
+	for start := 0; start < len(keys); start += 1000 {
+		batch := keys[start:min(start+1000, len(keys))]
+		ids := make([]*s3.ObjectIdentifier, len(batch))
+		for i, key := range batch {
+			ids[i] = &s3.ObjectIdentifier{Key: aws.String(key)}
+		}
+		out, err := s.uploader.S3.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &s3.Delete{Objects: ids, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete objects from S3: %w", err)
+		}
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("failed to delete %s from S3: %s", aws.StringValue(out.Errors[0].Key), aws.StringValue(out.Errors[0].Message))
+		}
+	}
+	return nil
+}
 
-	// Clone the repository
-	cmd := exec.Command("git", "clone", repoURL, cloneDir)
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to clone repository: %w", err)
+// PresignPut returns a URL that lets a client PUT an object under key until it
+// expires, and the headers the request must carry. The signature covers the
+// object's size and SHA-256 digest (hex), so S3 refuses any other content.
+func (s *Service) PresignPut(key string, size int64, digest string, expiry time.Duration) (string, http.Header, error) {
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid SHA-256 digest %q: %w", digest, err)
+	}
+	req, _ := s.uploader.S3.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:         aws.String(s.bucket),
+		Key:            aws.String(key),
+		ContentLength:  aws.Int64(size),
+		ChecksumSHA256: aws.String(base64.StdEncoding.EncodeToString(sum)),
+	})
+	// Keep the checksum a signed header rather than a query parameter
+	req.NotHoist = true
+	url, headers, err := req.PresignRequest(expiry)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to presign upload of %s: %w", key, err)
 	}
+	return url, headers, nil
+}
+
+// Stat returns the size of the object stored under key and the hex SHA-256
+// checksum S3 verified when it was stored, or "" if it has none. ok is false
+// if there is no such object.
+func (s *Service) Stat(key string) (size int64, digest string, ok bool, err error) {
+	out, err := s.uploader.S3.HeadObject(&s3.HeadObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(key),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	})
+	if isNotFound(err) {
+		return 0, "", false, nil
+	}
+	if err != nil {
+		return 0, "", false, fmt.Errorf("failed to look up %s in S3: %w", key, err)
+	}
+	if sum, err := base64.StdEncoding.DecodeString(aws.StringValue(out.ChecksumSHA256)); err == nil && len(sum) > 0 {
+		digest = hex.EncodeToString(sum)
+	}
+	return aws.Int64Value(out.ContentLength), digest, true, nil
+}
+
+// Open streams the object stored under key
+func (s *Service) Open(key string) (io.ReadCloser, error) {
+	out, err := s.uploader.S3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s from S3: %w", key, err)
+	}
+	return out.Body, nil
+}
+
+// maxCopySize is the largest object a single CopyObject request can copy.
+const maxCopySize = 5 << 30
+
+// PromoteArchive moves a verified archive of size bytes from key to its content
+// address and returns the new key. If the archive is already stored, the copy
+// is skipped. Archives too large to copy inside S3 are uploaded from body.
+func (s *Service) PromoteArchive(key, digest, contentType string, size int64, body io.Reader) (string, error) {
+	target := ArchiveKey(digest)
+	reused, err := s.reuse(target, contentType)
+	if err != nil {
+		return "", err
+	}
+	if !reused && size > maxCopySize {
+		if _, err := s.UploadArchive(body, digest, contentType); err != nil {
+			return "", err
+		}
+	} else if !reused {
+		_, err := s.uploader.S3.CopyObject(&s3.CopyObjectInput{
+			Bucket:            aws.String(s.bucket),
+			Key:               aws.String(target),
+			CopySource:        aws.String(s.bucket + "/" + key),
+			ContentType:       aws.String(contentType),
+			MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to copy %s to %s in S3: %w", key, target, err)
+		}
+	}
+	if err := s.Delete([]string{key}); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// reuse reports whether an archive is already stored under key and, if so,
+// copies it onto itself. That renews its LastModified, so that garbage
+// collection's grace period protects it until the snapshot about to reference
+// it is recorded. Archives too large to copy within S3 are reported missing,
+// to be uploaded again.
+func (s *Service) reuse(key, contentType string) (bool, error) {
+	size, _, ok, err := s.Stat(key)
+	if err != nil || !ok || size > maxCopySize {
+		return false, err
+	}
+	_, err = s.uploader.S3.CopyObject(&s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(s.bucket + "/" + key),
+		ContentType:       aws.String(contentType),
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to refresh %s in S3: %w", key, err)
+	}
+	return true, nil
+}
+
+func isNotFound(err error) bool {
+	var aerr awserr.RequestFailure
+	return errors.As(err, &aerr) && aerr.StatusCode() == http.StatusNotFound
+}
+
+// UploadDir zips a directory (skipping git metadata) and uploads it to S3 under
+// the given name. It returns the S3 key.
+func (s *Service) UploadDir(dir, name string) (string, error) {
+	tempDir, err := os.MkdirTemp("", "codemap-zip-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
 
 	// Create zip file
-	zipPath := filepath.Join(tempDir, repoName+".zip")
-	if err := createZipFromDir(cloneDir, zipPath); err != nil {
+	zipPath := filepath.Join(tempDir, name+".zip")
+	if err := createZipFromDir(dir, zipPath); err != nil {
 		return "", fmt.Errorf("failed to create zip: %w", err)
 	}
 
-	// Read zip file
-	zipData, err := os.ReadFile(zipPath)
+	// Open zip file
+	zipFile, err := os.Open(zipPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read zip file: %w", err)
+		return "", fmt.Errorf("failed to open zip file: %w", err)
 	}
+	defer zipFile.Close()
 
 	// Upload to S3
 	timestamp := time.Now().Format("20060102-150405")
-	key := fmt.Sprintf("projects/%s-%s.zip", timestamp, repoName)
+	key := fmt.Sprintf("projects/%s-%s.zip", timestamp, name)
 
 	_, err = s.uploader.Upload(&s3manager.UploadInput{
 		Bucket:      aws.String(s.bucket),
 		Key:         aws.String(key),
-		Body:        bytes.NewReader(zipData),
+		Body:        zipFile,
 		ContentType: aws.String("application/zip"),
 	})
 
 	if err != nil {
-		return "", fmt.Errorf("failed to upload git repo to S3: %w", err)
+		return "", fmt.Errorf("failed to upload %s to S3: %w", name, err)
 	}
 
 	return key, nil
 }
 
-// extractRepoName extracts repository name from GitHub URL
-func extractRepoName(repoURL string) string {
+// RepoName extracts repository name from GitHub URL
+func RepoName(repoURL string) string {
 	// Remove .git suffix if present
 	repoURL = strings.TrimSuffix(repoURL, ".git")
 
@@ -121,7 +314,9 @@ func extractRepoName(repoURL string) string {
 	return "unknown-repo"
 }
 
-// createZipFromDir creates a zip file from a directory
+// createZipFromDir creates a zip file from a directory. The .git directories
+// (or files, in worktrees and submodules) are left out, and so are symlinks and
+// other special files, which archive.Extract refuses.
 func createZipFromDir(sourceDir, zipPath string) error {
 	zipFile, err := os.Create(zipPath)
 	if err != nil {
@@ -137,13 +332,16 @@ func createZipFromDir(sourceDir, zipPath string) error {
 			return err
 		}
 
-		// Skip .git directory
-		if strings.Contains(path, ".git") {
+		// Skip .git, but not .github or .gitignore
+		if info.Name() == ".git" {
 			if info.IsDir() {
 				return filepath.SkipDir
 			}
 			return nil
 		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
 
 		// Get relative path
 		relPath, err := filepath.Rel(sourceDir, path)
@@ -0,0 +1,74 @@
+package s3
+
+import (
+	"codemap/backend/internal/archive"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateZipFromDir(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"main.go":                   "package main\n",
+		".gitignore":                "bin/\n",
+		".github/workflows/ci.yml":  "on: push\n",
+		".git/config":               "[core]\n",
+		"vendor/lib/.git":           "gitdir: ../../.git/modules/lib\n",
+		"vendor/lib/lib.go":         "package lib\n",
+		"docs/.gitkeep":             "",
+		"scripts/build.sh":          "#!/bin/sh\n",
+		"scripts/.git/hooks/pre-ok": "skipped\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("main.go", filepath.Join(src, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc", filepath.Join(src, "etc")); err != nil {
+		t.Fatal(err)
+	}
+
+	zipPath := filepath.Join(t.TempDir(), "src.zip")
+	if err := createZipFromDir(src, zipPath); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err := archive.Extract(context.Background(), archive.Zip, zipPath, dest, archive.Limits{}); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		included bool
+	}{
+		{"main.go", true},
+		{".gitignore", true},
+		{".github/workflows/ci.yml", true},
+		{"vendor/lib/lib.go", true},
+		{"docs/.gitkeep", true},
+		{"scripts/build.sh", true},
+		{".git/config", false},
+		{"vendor/lib/.git", false},
+		{"scripts/.git/hooks/pre-ok", false},
+		{"link.go", false},
+		{"etc", false},
+	}
+	for _, tt := range tests {
+		got, err := os.ReadFile(filepath.Join(dest, tt.name))
+		if tt.included && (err != nil || string(got) != files[tt.name]) {
+			t.Errorf("%s = %q, %v; want %q", tt.name, got, err, files[tt.name])
+		}
+		if _, err := os.Lstat(filepath.Join(dest, tt.name)); !tt.included && !os.IsNotExist(err) {
+			t.Errorf("%s was zipped", tt.name)
+		}
+	}
+}
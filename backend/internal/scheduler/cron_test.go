@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@yearly",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"1,,2 * * * *",
+		"-1 * * * *",
+	}
+	for _, expr := range tests {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2025, time.January, 15, 10, 30, 45, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2025, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"@hourly", from, time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", from, time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"@nightly", from, time.Date(2025, 1, 16, 2, 0, 0, 0, time.UTC)},
+		{"@weekly", from, time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", from, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{" @daily ", from, time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2025, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"30 10 * * *", from, time.Date(2025, 1, 16, 10, 30, 0, 0, time.UTC)},
+		{"5,50 * * * *", from, time.Date(2025, 1, 15, 10, 50, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", from, time.Date(2025, 1, 15, 13, 0, 0, 0, time.UTC)},
+		{"10/20 * * * *", from, time.Date(2025, 1, 15, 10, 50, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", from, time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", from, time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", from, time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", from, time.Time{}},
+		// With both day fields restricted either may match
+		{"0 0 1 * 6", from, time.Date(2025, 1, 18, 0, 0, 0, 0, time.UTC)},
+		// A day field starting with "*" does not restrict it, as in cron
+		{"0 0 */2 * 6", from, time.Date(2025, 1, 25, 0, 0, 0, 0, time.UTC)},
+		// Times are evaluated in UTC
+		{"0 12 * * *", time.Date(2025, 1, 15, 12, 30, 0, 0, time.FixedZone("CET", 3600)), time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)},
+		// The end of a year
+		{"0 0 1 1 *", time.Date(2025, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleMatches(t *testing.T) {
+	s, err := ParseSchedule("0 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{time.Date(2025, 1, 15, 2, 0, 0, 0, time.UTC), true},
+		{time.Date(2025, 1, 15, 2, 0, 59, 0, time.UTC), true},
+		{time.Date(2025, 1, 15, 2, 1, 0, 0, time.UTC), false},
+		{time.Date(2025, 1, 15, 3, 0, 0, 0, time.FixedZone("CET", 3600)), true},
+	}
+	for _, tt := range tests {
+		if got := s.Matches(tt.t); got != tt.want {
+			t.Errorf("Matches(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
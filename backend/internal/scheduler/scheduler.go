@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"codemap/backend/internal/database"
+	"codemap/backend/internal/gitcache"
+	"codemap/backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Store is the persistence the scheduler reads projects and snapshots from.
+type Store interface {
+	ListScheduledProjects(ctx context.Context) ([]models.Project, error)
+	LatestSnapshot(ctx context.Context, projectID string) (*models.Snapshot, error)
+}
+
+// Enqueuer queues an analysis of project at the given remote commit.
+type Enqueuer func(project models.Project, commit string) error
+
+// Scheduler periodically re-analyzes projects that have a cron schedule and
+// a git remote. A run is skipped when the project already has a job in
+// progress or when the remote HEAD has not moved since the last snapshot.
+type Scheduler struct {
+	store   Store
+	enqueue Enqueuer
+	busy    func(projectID string) bool
+	logger  *log.Logger
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a scheduler. busy reports whether a project has a job in progress.
+func New(store Store, enqueue Enqueuer, busy func(projectID string) bool, logger *log.Logger) *Scheduler {
+	return &Scheduler{store: store, enqueue: enqueue, busy: busy, logger: logger}
+}
+
+// Start runs the scheduler in the background, checking schedules once a minute.
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			now := time.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(next.Sub(now)):
+				s.tick(ctx, next)
+			}
+		}
+	}()
+}
+
+// Close stops the scheduler and waits for the current tick to finish.
+func (s *Scheduler) Close() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *Scheduler) tick(ctx context.Context, t time.Time) {
+	projects, err := s.store.ListScheduledProjects(ctx)
+	if err != nil {
+		s.logger.Printf("scheduler: %v", err)
+		return
+	}
+	for _, project := range projects {
+		schedule, err := ParseSchedule(project.Schedule)
+		if err != nil {
+			s.logger.Printf("scheduler: project %s: %v", project.ID, err)
+			continue
+		}
+		if !schedule.Matches(t) {
+			continue
+		}
+		if err := s.check(ctx, project); err != nil {
+			s.logger.Printf("scheduler: project %s: %v", project.ID, err)
+		}
+	}
+}
+
+// check enqueues a run of project unless it would overlap or be redundant.
+func (s *Scheduler) check(ctx context.Context, project models.Project) error {
+	if s.busy(project.ID) {
+		s.logger.Printf("scheduler: skipping %s, previous run still in progress", project.ID)
+		return nil
+	}
+
+	head, err := gitcache.RemoteHead(ctx, project.RepoURL)
+	if err != nil {
+		return err
+	}
+	latest, err := s.store.LatestSnapshot(ctx, project.ID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+	if latest != nil && latest.Commit != nil && latest.Commit.SHA == head {
+		s.logger.Printf("scheduler: skipping %s, remote HEAD %s already analyzed", project.ID, head)
+		return nil
+	}
+
+	if err := s.enqueue(project, head); err != nil {
+		return fmt.Errorf("could not enqueue analysis: %w", err)
+	}
+	s.logger.Printf("scheduler: enqueued analysis of %s at %s", project.ID, head)
+	return nil
+}
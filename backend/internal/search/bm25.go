@@ -0,0 +1,145 @@
+package search
+
+import (
+	"codemap/backend/internal/models"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BM25 parameters: k1 is how quickly repeated terms stop adding to a score
+// and b how much long documents are penalized.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Weights of the fields of a symbol's document, as the number of times their
+// terms are counted. Names say the most about a symbol.
+const (
+	nameWeight   = 3
+	docWeight    = 1
+	stringWeight = 1
+	pathWeight   = 1
+)
+
+// stopWords are left out of documents and queries.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "with": true,
+}
+
+// textIndex is an inverted index of the symbols' documents: the words of
+// their names, doc comments, string literals and file paths.
+type textIndex struct {
+	postings  map[string][]posting
+	lengths   []int
+	avgLength float64
+}
+
+type posting struct {
+	symbol int
+	freq   int
+}
+
+func newTextIndex(symbols []models.Symbol) *textIndex {
+	ix := &textIndex{postings: make(map[string][]posting), lengths: make([]int, len(symbols))}
+	total := 0
+	for i, symbol := range symbols {
+		freqs := make(map[string]int)
+		add := func(text string, weight int) {
+			for _, term := range textTerms(text) {
+				freqs[term] += weight
+				ix.lengths[i] += weight
+			}
+		}
+		add(symbol.Name, nameWeight)
+		add(symbol.Doc, docWeight)
+		for _, s := range symbol.Strings {
+			add(s, stringWeight)
+		}
+		// A file's name is already counted as its symbol's
+		dir := symbol.File
+		if symbol.Kind == models.SymbolFile {
+			dir = dir[:strings.LastIndex(dir, "/")+1]
+		}
+		add(dir, pathWeight)
+
+		for term, freq := range freqs {
+			ix.postings[term] = append(ix.postings[term], posting{i, freq})
+		}
+		total += ix.lengths[i]
+	}
+	if len(symbols) > 0 {
+		ix.avgLength = float64(total) / float64(len(symbols))
+	}
+	return ix
+}
+
+// SearchText returns the best hits of a full-text query, ranked by the BM25
+// score of their documents. Any of the query's words may match.
+func (ix *Index) SearchText(q Query) ([]models.SearchHit, error) {
+	var glob *regexp.Regexp
+	if q.PathGlob != "" {
+		var err error
+		if glob, err = compileGlob(q.PathGlob); err != nil {
+			return nil, err
+		}
+	}
+	hits := []models.SearchHit{}
+	text := ix.text
+	n := float64(len(ix.symbols))
+
+	scores := make(map[int]float64)
+	seen := make(map[string]bool)
+	for _, term := range textTerms(q.Text) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		postings := text.postings[term]
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			freq := float64(p.freq)
+			norm := 1 - bm25B + bm25B*float64(text.lengths[p.symbol])/text.avgLength
+			scores[p.symbol] += idf * freq * (bm25K1 + 1) / (freq + bm25K1*norm)
+		}
+	}
+
+	for i, score := range scores {
+		symbol := ix.symbols[i]
+		if !passes(symbol, q, glob) {
+			continue
+		}
+		hits = append(hits, models.SearchHit{Symbol: symbol, Score: math.Round(score*1000) / 1000, Match: models.MatchText})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Degree != hits[j].Degree {
+			return hits[i].Degree > hits[j].Degree
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	return hits, nil
+}
+
+// textTerms splits text into words as Tokenize does and reduces them to
+// their stems, leaving out stop words.
+func textTerms(text string) []string {
+	var terms []string
+	for _, word := range Tokenize(text) {
+		if !stopWords[word] {
+			terms = append(terms, stem(word))
+		}
+	}
+	return terms
+}
@@ -0,0 +1,121 @@
+package search
+
+import (
+	"codemap/backend/internal/models"
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Loader returns the symbols of a project to index and the snapshot they
+// belong to.
+type Loader func(ctx context.Context, projectID string) ([]models.Symbol, string, error)
+
+// Cache holds the search index of each project's latest snapshot. Indexes
+// are built from the graph on first use and dropped when a new snapshot is
+// imported, or when more than the cache's capacity of projects were searched
+// since they were last used. Concurrent searches of a project share one
+// build.
+type Cache struct {
+	load     Loader
+	capacity int
+
+	mu      sync.Mutex
+	indexes map[string]*list.Element
+	// recent orders the cached indexes by use, most recent first
+	recent *list.List
+	// builds are the indexes being built, by project
+	builds map[string]*build
+	// generations counts the invalidations of each project, so that an
+	// index built from a graph that was replaced meanwhile is not kept
+	generations map[string]int
+}
+
+// entry is a cached index.
+type entry struct {
+	projectID string
+	index     *Index
+}
+
+// build is an index being built, which callers wait for to finish.
+type build struct {
+	generation int
+	done       chan struct{}
+	index      *Index
+	err        error
+}
+
+// NewCache creates a cache that builds indexes from the symbols load returns
+// and holds those of up to capacity projects, or of all if capacity is 0.
+func NewCache(load Loader, capacity int) *Cache {
+	return &Cache{
+		load:        load,
+		capacity:    capacity,
+		indexes:     make(map[string]*list.Element),
+		recent:      list.New(),
+		builds:      make(map[string]*build),
+		generations: make(map[string]int),
+	}
+}
+
+// Get returns the index of a project, building it if needed.
+func (c *Cache) Get(ctx context.Context, projectID string) (*Index, error) {
+	c.mu.Lock()
+	if el, ok := c.indexes[projectID]; ok {
+		c.recent.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*entry).index, nil
+	}
+	generation := c.generations[projectID]
+	b, ok := c.builds[projectID]
+	if !ok || b.generation != generation {
+		b = &build{generation: generation, done: make(chan struct{})}
+		c.builds[projectID] = b
+		// The build outlives the request that started it, as others wait for it
+		go c.build(context.WithoutCancel(ctx), projectID, b)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.index, b.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// build loads and indexes the symbols of a project and caches the index
+// unless the project's graph changed meanwhile.
+func (c *Cache) build(ctx context.Context, projectID string, b *build) {
+	defer close(b.done)
+	symbols, snapshot, err := c.load(ctx, projectID)
+	if err == nil {
+		b.index = NewIndex(snapshot, symbols)
+	}
+	b.err = err
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.builds[projectID] == b {
+		delete(c.builds, projectID)
+	}
+	if err != nil || c.generations[projectID] != b.generation {
+		return
+	}
+	c.indexes[projectID] = c.recent.PushFront(&entry{projectID: projectID, index: b.index})
+	if c.capacity > 0 && c.recent.Len() > c.capacity {
+		oldest := c.recent.Remove(c.recent.Back()).(*entry)
+		delete(c.indexes, oldest.projectID)
+	}
+}
+
+// Invalidate drops the index of a project after its graph changed.
+func (c *Cache) Invalidate(projectID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.indexes[projectID]; ok {
+		c.recent.Remove(el)
+		delete(c.indexes, projectID)
+	}
+	c.generations[projectID]++
+}
@@ -0,0 +1,127 @@
+package search
+
+import (
+	"codemap/backend/internal/models"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingLoader counts the loads of each project and blocks them until
+// release is closed, if set.
+type countingLoader struct {
+	mu      sync.Mutex
+	loads   map[string]int
+	release chan struct{}
+	started chan struct{}
+}
+
+func (l *countingLoader) load(ctx context.Context, projectID string) ([]models.Symbol, string, error) {
+	l.mu.Lock()
+	l.loads[projectID]++
+	l.mu.Unlock()
+	if l.started != nil {
+		l.started <- struct{}{}
+	}
+	if l.release != nil {
+		<-l.release
+	}
+	return nil, "snap-" + projectID, nil
+}
+
+func (l *countingLoader) count(projectID string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.loads[projectID]
+}
+
+func TestCacheSharesBuilds(t *testing.T) {
+	loader := &countingLoader{loads: map[string]int{}, release: make(chan struct{})}
+	cache := NewCache(loader.load, 0)
+
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ix, err := cache.Get(context.Background(), "p"); err != nil || ix.Snapshot() != "snap-p" {
+				failed.Store(true)
+			}
+		}()
+	}
+	close(loader.release)
+	wg.Wait()
+	if failed.Load() {
+		t.Fatal("Get failed")
+	}
+	if n := loader.count("p"); n != 1 {
+		t.Errorf("project loaded %d times, want 1", n)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	loader := &countingLoader{loads: map[string]int{}}
+	cache := NewCache(loader.load, 2)
+	ctx := context.Background()
+
+	tests := []struct {
+		get       string
+		wantLoads int
+	}{
+		{"a", 1},
+		{"b", 1},
+		{"a", 1},
+		{"c", 1}, // evicts b
+		{"a", 1},
+		{"b", 2}, // evicts c
+		{"c", 2},
+	}
+	for i, tt := range tests {
+		if _, err := cache.Get(ctx, tt.get); err != nil {
+			t.Fatal(err)
+		}
+		if n := loader.count(tt.get); n != tt.wantLoads {
+			t.Errorf("step %d: %s loaded %d times, want %d", i, tt.get, n, tt.wantLoads)
+		}
+	}
+}
+
+func TestCacheDropsBuildsOfReplacedGraphs(t *testing.T) {
+	loader := &countingLoader{loads: map[string]int{}, release: make(chan struct{}), started: make(chan struct{}, 1)}
+	cache := NewCache(loader.load, 0)
+	ctx := context.Background()
+
+	done := make(chan error)
+	go func() {
+		_, err := cache.Get(ctx, "p")
+		done <- err
+	}()
+	<-loader.started
+	cache.Invalidate("p")
+	close(loader.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	loader.started = nil
+	if _, err := cache.Get(ctx, "p"); err != nil {
+		t.Fatal(err)
+	}
+	if n := loader.count("p"); n != 2 {
+		t.Errorf("project loaded %d times, want 2 as the first index was stale", n)
+	}
+}
+
+func TestCacheGetCanceled(t *testing.T) {
+	loader := &countingLoader{loads: map[string]int{}, release: make(chan struct{})}
+	defer close(loader.release)
+	cache := NewCache(loader.load, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.Get(ctx, "p"); err != context.Canceled {
+		t.Errorf("Get = %v, want context.Canceled", err)
+	}
+}
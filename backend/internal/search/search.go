@@ -0,0 +1,381 @@
+// Package search finds the symbols of a project's code graph by name. Names
+// are split into words at case changes, letters following digits and
+// punctuation, so that "uploadFile", "UploadFile" and "upload_file" all hold
+// the words "upload" and "file". A query matches a symbol when each of its
+// words matches one of the symbol's exactly, as a prefix or with a typo or
+// two.
+//
+// Only a project's latest snapshot can be searched: the graph holds the code
+// of that snapshot alone, and indexes are built from the graph.
+package search
+
+import (
+	"codemap/backend/internal/models"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Scores of a query word matching a word of a name. Prefixes score more the
+// more of the word they cover.
+const (
+	exactScore       = 1.0
+	prefixScore      = 0.6
+	prefixCoverScore = 0.3
+	fuzzyScore       = 0.5
+	fuzzyPrefixScore = 0.4
+	// fullNameBonus is added when the query spells out the whole name
+	fullNameBonus = 0.5
+	// centralityWeight scales the log of a symbol's degree
+	centralityWeight = 0.1
+)
+
+// Index is an immutable search index of the symbols of a project's snapshot.
+// It answers name searches and, through its text index, full-text searches.
+type Index struct {
+	snapshot string
+	symbols  []models.Symbol
+	text     *textIndex
+	// words holds the IDs of each symbol's words: those of its name and,
+	// for names of several words, the whole name
+	words [][]int
+	// names holds each symbol's name as one word
+	names []string
+	// dict maps each word to its ID and postings lists the symbols with
+	// each word
+	dict     map[string]int
+	vocab    []string
+	postings [][]int
+}
+
+// NewIndex indexes the symbols of a snapshot.
+func NewIndex(snapshot string, symbols []models.Symbol) *Index {
+	ix := &Index{
+		snapshot: snapshot,
+		symbols:  symbols,
+		text:     newTextIndex(symbols),
+		words:    make([][]int, len(symbols)),
+		names:    make([]string, len(symbols)),
+		dict:     make(map[string]int),
+	}
+	for i, symbol := range symbols {
+		words := Tokenize(symbol.Name)
+		ix.names[i] = strings.Join(words, "")
+		if len(words) > 1 {
+			words = append(words, ix.names[i])
+		}
+		for _, word := range words {
+			id, ok := ix.dict[word]
+			if !ok {
+				id = len(ix.vocab)
+				ix.dict[word] = id
+				ix.vocab = append(ix.vocab, word)
+				ix.postings = append(ix.postings, nil)
+			}
+			if n := len(ix.postings[id]); n > 0 && ix.postings[id][n-1] == i {
+				continue
+			}
+			ix.postings[id] = append(ix.postings[id], i)
+			ix.words[i] = append(ix.words[i], id)
+		}
+	}
+	return ix
+}
+
+// Snapshot returns the ID of the snapshot whose symbols are indexed, or ""
+// if the project had none when they were loaded.
+func (ix *Index) Snapshot() string {
+	return ix.snapshot
+}
+
+// Len returns the number of indexed symbols.
+func (ix *Index) Len() int {
+	return len(ix.symbols)
+}
+
+// Query is a search and the filters its hits must pass.
+type Query struct {
+	Text string
+	// Kinds, if set, lists the kinds of symbols to return
+	Kinds []string
+	// Language, if set, is the language of the symbols' files
+	Language string
+	// Exported, if set, is the required export flag; files have none and
+	// are left out
+	Exported *bool
+	// PathGlob, if set, matches the symbols' file paths. "*" and "?" stay
+	// within a directory and "**" spans any number; patterns without a
+	// slash match in any directory.
+	PathGlob string
+	Limit    int
+}
+
+// Search returns the best hits of a query, ranked by how well they match and
+// then by their degree in the graph.
+func (ix *Index) Search(q Query) ([]models.SearchHit, error) {
+	var glob *regexp.Regexp
+	if q.PathGlob != "" {
+		var err error
+		if glob, err = compileGlob(q.PathGlob); err != nil {
+			return nil, err
+		}
+	}
+	terms := Tokenize(q.Text)
+	hits := []models.SearchHit{}
+	if len(terms) == 0 {
+		return hits, nil
+	}
+	whole := strings.Join(terms, "")
+
+	// Each query word's scores by word ID, with the match quality
+	matches := make([]map[int]wordMatch, len(terms))
+	for i, term := range terms {
+		matches[i] = make(map[int]wordMatch)
+		for id, word := range ix.vocab {
+			if m, ok := matchWord(term, word); ok {
+				matches[i][id] = m
+			}
+		}
+	}
+
+	// Candidates have a word matching the first query word
+	candidates := make(map[int]bool)
+	for id := range matches[0] {
+		for _, i := range ix.postings[id] {
+			candidates[i] = true
+		}
+	}
+
+	for i := range candidates {
+		symbol := ix.symbols[i]
+		if !passes(symbol, q, glob) {
+			continue
+		}
+		total, quality, ok := 0.0, models.MatchExact, true
+		matched := make(map[int]bool)
+		for _, termMatches := range matches {
+			best, bestID := wordMatch{}, -1
+			for _, id := range ix.words[i] {
+				if m, found := termMatches[id]; found && m.score > best.score {
+					best, bestID = m, id
+				}
+			}
+			if bestID < 0 {
+				ok = false
+				break
+			}
+			total += best.score
+			matched[bestID] = true
+			quality = worseMatch(quality, best.quality)
+		}
+		if !ok {
+			continue
+		}
+		// Names of which the query covers more words rank higher
+		score := total / float64(len(terms))
+		score *= 0.7 + 0.3*math.Min(1, float64(len(matched))/float64(nameWords(ix.words[i])))
+		if ix.names[i] == whole {
+			score += fullNameBonus
+		}
+		score *= 1 + centralityWeight*math.Log1p(float64(symbol.Degree))
+		hits = append(hits, models.SearchHit{Symbol: symbol, Score: math.Round(score*1000) / 1000, Match: quality})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if len(hits[i].Name) != len(hits[j].Name) {
+			return len(hits[i].Name) < len(hits[j].Name)
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	return hits, nil
+}
+
+// nameWords returns the number of words of a name from its word IDs, which
+// end with the whole name if it has several.
+func nameWords(ids []int) int {
+	if len(ids) > 1 {
+		return len(ids) - 1
+	}
+	return 1
+}
+
+func passes(symbol models.Symbol, q Query, glob *regexp.Regexp) bool {
+	if len(q.Kinds) > 0 && !slices.Contains(q.Kinds, symbol.Kind) {
+		return false
+	}
+	if q.Language != "" && !strings.EqualFold(symbol.Language, q.Language) {
+		return false
+	}
+	if q.Exported != nil && (symbol.Kind == models.SymbolFile || symbol.IsExported != *q.Exported) {
+		return false
+	}
+	return glob == nil || glob.MatchString(symbol.File)
+}
+
+type wordMatch struct {
+	score   float64
+	quality string
+}
+
+// matchWord scores how well a query word matches a word of a name.
+func matchWord(term, word string) (wordMatch, bool) {
+	switch {
+	case term == word:
+		return wordMatch{exactScore, models.MatchExact}, true
+	case strings.HasPrefix(word, term):
+		cover := float64(len(term)) / float64(len(word))
+		return wordMatch{prefixScore + prefixCoverScore*cover, models.MatchPrefix}, true
+	}
+	allowed := typos(term)
+	if allowed == 0 {
+		return wordMatch{}, false
+	}
+	if d := editDistance(term, word, allowed); d <= allowed {
+		return wordMatch{fuzzyScore - 0.1*float64(d-1), models.MatchFuzzy}, true
+	}
+	// A misspelt prefix, allowing for a letter left out or added
+	for n := len(term) - 1; n <= len(term)+1; n++ {
+		if n < len(word) && editDistance(term, word[:n], allowed) <= allowed {
+			return wordMatch{fuzzyPrefixScore, models.MatchFuzzy}, true
+		}
+	}
+	return wordMatch{}, false
+}
+
+// typos returns the edits a query word may be off by: none for short words,
+// where one edit makes another word, and up to two for long ones.
+func typos(term string) int {
+	switch {
+	case len(term) >= 8:
+		return 2
+	case len(term) >= 4:
+		return 1
+	}
+	return 0
+}
+
+func worseMatch(a, b string) string {
+	order := map[string]int{models.MatchExact: 0, models.MatchPrefix: 1, models.MatchFuzzy: 2}
+	if order[b] > order[a] {
+		return b
+	}
+	return a
+}
+
+// editDistance returns the number of insertions, deletions, substitutions
+// and transpositions of adjacent bytes that turn a into b, or limit+1 once
+// it exceeds limit.
+func editDistance(a, b string, limit int) int {
+	if diff := len(a) - len(b); diff > limit || -diff > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return min(prev[len(b)], limit+1)
+}
+
+// Tokenize splits a name or query into lower-case words at punctuation,
+// changes from lower to upper case, the last capital of an acronym followed
+// by a lower-case letter, and letters following digits. "parseHTTPRequest2"
+// becomes "parse", "http" and "request2".
+func Tokenize(s string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if len(word) > 0 && unicode.IsLetter(r) {
+			prev := runes[i-1]
+			switch {
+			case unicode.IsDigit(prev),
+				unicode.IsUpper(r) && unicode.IsLower(prev),
+				unicode.IsUpper(r) && unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+				flush()
+			}
+		}
+		word = append(word, unicode.ToLower(r))
+	}
+	flush()
+	return words
+}
+
+// compileGlob turns a path glob into a regular expression. Other characters
+// than "*" and "?" match themselves.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	if !strings.Contains(glob, "/") {
+		glob = "**/" + glob
+	}
+	// Runes, not bytes, so that "?" matches one character of any script
+	runes := []rune(glob)
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+				// "**/" also matches no directory at all
+				if i+1 < len(runes) && runes[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid path glob %q: %w", glob, err)
+	}
+	return re, nil
+}
@@ -0,0 +1,128 @@
+package search
+
+import (
+	"codemap/backend/internal/models"
+	"slices"
+	"testing"
+)
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/api/main.go", true},
+		{"*.go", "main.go.orig", false},
+		{"cmd/*.go", "cmd/main.go", true},
+		{"cmd/*.go", "cmd/api/main.go", false},
+		{"cmd/**/*.go", "cmd/main.go", true},
+		{"cmd/**/*.go", "cmd/api/v1/main.go", true},
+		{"cmd/**", "cmd/api/main.go", true},
+		{"?.go", "a.go", true},
+		{"?.go", "ab.go", false},
+		{"src/[a].js", "src/[a].js", true},
+		{"src/[a].js", "src/a.js", false},
+		{"*.tsx", "components/Überblick.tsx", true},
+		{"Über*.tsx", "components/Überblick.tsx", true},
+		{"?ber*.tsx", "components/Überblick.tsx", true},
+		{"docs/??.md", "docs/日本.md", true},
+		{"docs/?.md", "docs/日本.md", false},
+		{"données/**/*.py", "données/a/b.py", true},
+	}
+	for _, tt := range tests {
+		re, err := compileGlob(tt.glob)
+		if err != nil {
+			t.Errorf("compileGlob(%q): %v", tt.glob, err)
+			continue
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("glob %q on %q = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"parseHTTPRequest2", []string{"parse", "http", "request2"}},
+		{"uploadFile", []string{"upload", "file"}},
+		{"UploadFile", []string{"upload", "file"}},
+		{"upload_file", []string{"upload", "file"}},
+		{"UPLOAD_FILE", []string{"upload", "file"}},
+		{"XMLHttpRequest", []string{"xml", "http", "request"}},
+		{"base64Encode", []string{"base64", "encode"}},
+		{"v2beta", []string{"v2", "beta"}},
+		{"src/api/handlers.go", []string{"src", "api", "handlers", "go"}},
+		{"  ", nil},
+		{"größeBerechnen", []string{"größe", "berechnen"}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMatchWord(t *testing.T) {
+	tests := []struct {
+		term, word string
+		ok         bool
+		kind       string
+	}{
+		{"upload", "upload", true, models.MatchExact},
+		{"up", "upload", true, models.MatchPrefix},
+		{"uplaod", "upload", true, models.MatchFuzzy},    // transposition
+		{"uplod", "upload", true, models.MatchFuzzy},     // deletion
+		{"uploda", "uploader", true, models.MatchFuzzy},  // misspelt prefix
+		{"requets", "requests", true, models.MatchFuzzy}, // transposition in a prefix
+		{"contorller", "controller", true, models.MatchFuzzy},
+		{"contrlolre", "controller", true, models.MatchFuzzy}, // two edits in a long word
+		{"get", "set", false, ""},                             // no typos in short words
+		{"file", "fill", true, models.MatchFuzzy},
+		{"file", "fold", false, ""},
+		{"upload", "download", false, ""},
+	}
+	for _, tt := range tests {
+		m, ok := matchWord(tt.term, tt.word)
+		if ok != tt.ok || (ok && m.quality != tt.kind) {
+			t.Errorf("matchWord(%q, %q) = %+v, %v, want %s, %v", tt.term, tt.word, m, ok, tt.kind, tt.ok)
+		}
+	}
+
+	// Exact matches rank above prefixes, which rank above typos
+	exact, _ := matchWord("upload", "upload")
+	prefix, _ := matchWord("uploa", "upload")
+	fuzzy, _ := matchWord("uplaod", "upload")
+	if !(exact.score > prefix.score && prefix.score > fuzzy.score) {
+		t.Errorf("scores exact %v, prefix %v, fuzzy %v are not ordered", exact.score, prefix.score, fuzzy.score)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"", "", 2, 0},
+		{"abc", "abc", 2, 0},
+		{"abc", "abd", 2, 1},
+		{"abc", "ab", 2, 1},
+		{"ab", "abc", 2, 1},
+		{"abc", "acb", 2, 1},
+		{"abcd", "badc", 2, 2},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 2, 3}, // capped at limit+1
+		{"a", "abcdef", 2, 3},       // lengths too far apart
+		{"", "abc", 5, 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package search
+
+// stem reduces an English word to its stem with the Porter stemming
+// algorithm, so that "upload", "uploads", "uploaded" and "uploading", or
+// "use", "used", "uses" and "using", meet. Words that are not plain
+// lower-case ASCII, such as identifiers in other scripts, are kept as they
+// are. See https://tartarus.org/martin/PorterStemmer/def.txt.
+func stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if c := word[i]; (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return word
+		}
+	}
+	b := []byte(word)
+	b = stemStep1a(b)
+	b = stemStep1b(b)
+	b = stemStep1c(b)
+	b = replaceSuffix(b, step2Suffixes, 0)
+	b = replaceSuffix(b, step3Suffixes, 0)
+	b = stemStep4(b)
+	b = stemStep5(b)
+	return string(b)
+}
+
+// A suffix and what it is replaced with.
+type suffixRule struct {
+	suffix, replacement string
+}
+
+var step2Suffixes = []suffixRule{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"bli", "ble"}, {"alli", "al"}, {"entli", "ent"},
+	{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+	{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+	{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+	{"logi", "log"},
+}
+
+var step3Suffixes = []suffixRule{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+var step4Suffixes = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+	"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+// consonant reports whether the letter at i is a consonant: not a vowel, and
+// for "y" not following a consonant.
+func consonant(b []byte, i int) bool {
+	switch b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !consonant(b, i-1)
+	}
+	return true
+}
+
+// measure returns the number of vowel-consonant sequences in b, m in
+// [C](VC){m}[V].
+func measure(b []byte) int {
+	n, i := 0, 0
+	for i < len(b) && consonant(b, i) {
+		i++
+	}
+	for i < len(b) {
+		for i < len(b) && !consonant(b, i) {
+			i++
+		}
+		if i == len(b) {
+			break
+		}
+		for i < len(b) && consonant(b, i) {
+			i++
+		}
+		n++
+	}
+	return n
+}
+
+func hasVowel(b []byte) bool {
+	for i := range b {
+		if !consonant(b, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleConsonant reports whether b ends with a double consonant.
+func doubleConsonant(b []byte) bool {
+	n := len(b)
+	return n >= 2 && b[n-1] == b[n-2] && consonant(b, n-1)
+}
+
+// cvc reports whether b ends consonant-vowel-consonant, the last not being
+// "w", "x" or "y", as in "hop" but not "snow".
+func cvc(b []byte) bool {
+	n := len(b)
+	if n < 3 || !consonant(b, n-3) || consonant(b, n-2) || !consonant(b, n-1) {
+		return false
+	}
+	c := b[n-1]
+	return c != 'w' && c != 'x' && c != 'y'
+}
+
+func hasSuffix(b []byte, suffix string) bool {
+	return len(b) >= len(suffix) && string(b[len(b)-len(suffix):]) == suffix
+}
+
+// replaceSuffix replaces the longest of the rules' suffixes that b ends with
+// if the measure of what precedes it is above min.
+func replaceSuffix(b []byte, rules []suffixRule, min int) []byte {
+	best := -1
+	for i, rule := range rules {
+		if hasSuffix(b, rule.suffix) && (best < 0 || len(rule.suffix) > len(rules[best].suffix)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return b
+	}
+	stem := b[:len(b)-len(rules[best].suffix)]
+	if measure(stem) <= min {
+		return b
+	}
+	return append(stem[:len(stem):len(stem)], rules[best].replacement...)
+}
+
+// stemStep1a removes plurals.
+func stemStep1a(b []byte) []byte {
+	switch {
+	case hasSuffix(b, "sses"), hasSuffix(b, "ies"):
+		return b[:len(b)-2]
+	case hasSuffix(b, "ss"):
+		return b
+	case hasSuffix(b, "s"):
+		return b[:len(b)-1]
+	}
+	return b
+}
+
+// stemStep1b removes past tenses and gerunds.
+func stemStep1b(b []byte) []byte {
+	if hasSuffix(b, "eed") {
+		if measure(b[:len(b)-3]) > 0 {
+			return b[:len(b)-1]
+		}
+		return b
+	}
+	var stem []byte
+	switch {
+	case hasSuffix(b, "ed") && hasVowel(b[:len(b)-2]):
+		stem = b[:len(b)-2]
+	case hasSuffix(b, "ing") && hasVowel(b[:len(b)-3]):
+		stem = b[:len(b)-3]
+	default:
+		return b
+	}
+	switch {
+	case hasSuffix(stem, "at"), hasSuffix(stem, "bl"), hasSuffix(stem, "iz"):
+		return append(stem[:len(stem):len(stem)], 'e')
+	case doubleConsonant(stem):
+		if c := stem[len(stem)-1]; c != 'l' && c != 's' && c != 'z' {
+			return stem[:len(stem)-1]
+		}
+	case measure(stem) == 1 && cvc(stem):
+		return append(stem[:len(stem):len(stem)], 'e')
+	}
+	return stem
+}
+
+// stemStep1c turns a final "y" into "i" after a vowel.
+func stemStep1c(b []byte) []byte {
+	if hasSuffix(b, "y") && hasVowel(b[:len(b)-1]) {
+		return append(b[:len(b)-1:len(b)-1], 'i')
+	}
+	return b
+}
+
+// stemStep4 removes suffixes of words of more than one syllable.
+func stemStep4(b []byte) []byte {
+	longest := ""
+	for _, suffix := range step4Suffixes {
+		if hasSuffix(b, suffix) && len(suffix) > len(longest) {
+			longest = suffix
+		}
+	}
+	if longest == "" {
+		return b
+	}
+	stem := b[:len(b)-len(longest)]
+	if measure(stem) <= 1 {
+		return b
+	}
+	if longest == "ion" && !hasSuffix(stem, "s") && !hasSuffix(stem, "t") {
+		return b
+	}
+	return stem
+}
+
+// stemStep5 removes a final "e" and turns a final "ll" into "l".
+func stemStep5(b []byte) []byte {
+	if hasSuffix(b, "e") {
+		stem := b[:len(b)-1]
+		if m := measure(stem); m > 1 || m == 1 && !cvc(stem) {
+			b = stem
+		}
+	}
+	if measure(b) > 1 && doubleConsonant(b) && hasSuffix(b, "l") {
+		b = b[:len(b)-1]
+	}
+	return b
+}
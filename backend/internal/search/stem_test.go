@@ -0,0 +1,108 @@
+package search
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	// Outputs of the reference implementation
+	tests := []struct {
+		word, want string
+	}{
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"ties", "ti"},
+		{"cats", "cat"},
+		{"feed", "feed"},
+		{"agreed", "agre"},
+		{"plastered", "plaster"},
+		{"motoring", "motor"},
+		{"sing", "sing"},
+		{"conflated", "conflat"},
+		{"troubled", "troubl"},
+		{"sized", "size"},
+		{"hopping", "hop"},
+		{"tanned", "tan"},
+		{"falling", "fall"},
+		{"hissing", "hiss"},
+		{"fizzed", "fizz"},
+		{"failing", "fail"},
+		{"filing", "file"},
+		{"happy", "happi"},
+		{"sky", "sky"},
+		{"relational", "relat"},
+		{"conditional", "condit"},
+		{"rational", "ration"},
+		{"digitizer", "digit"},
+		{"vietnamization", "vietnam"},
+		{"predication", "predic"},
+		{"operator", "oper"},
+		{"feudalism", "feudal"},
+		{"decisiveness", "decis"},
+		{"hopefulness", "hope"},
+		{"callousness", "callous"},
+		{"sensibiliti", "sensibl"},
+		{"triplicate", "triplic"},
+		{"formative", "form"},
+		{"formalize", "formal"},
+		{"electrical", "electr"},
+		{"goodness", "good"},
+		{"revival", "reviv"},
+		{"allowance", "allow"},
+		{"inference", "infer"},
+		{"airliner", "airlin"},
+		{"gyroscopic", "gyroscop"},
+		{"adjustable", "adjust"},
+		{"defensible", "defens"},
+		{"irritant", "irrit"},
+		{"replacement", "replac"},
+		{"adjustment", "adjust"},
+		{"dependent", "depend"},
+		{"adoption", "adopt"},
+		{"communism", "commun"},
+		{"activate", "activ"},
+		{"effective", "effect"},
+		{"bowdlerize", "bowdler"},
+		{"probate", "probat"},
+		{"rate", "rate"},
+		{"cease", "ceas"},
+		{"controll", "control"},
+		{"roll", "roll"},
+		{"generalizations", "gener"},
+		{"oscillators", "oscil"},
+		// Kept as they are
+		{"go", "go"},
+		{"größe", "größe"},
+		{"base64", "base64"},
+	}
+	for _, tt := range tests {
+		if got := stem(tt.word); got != tt.want {
+			t.Errorf("stem(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestStemEquivalences(t *testing.T) {
+	// Inflections of a word that searches must treat as the same
+	groups := [][]string{
+		{"upload", "uploads", "uploaded", "uploading"},
+		{"use", "used", "uses", "using"},
+		{"update", "updated", "updates", "updating"},
+		{"retry", "retries", "retried", "retrying"},
+		{"parse", "parsed", "parses", "parsing"},
+		{"run", "runs", "running"},
+		{"stop", "stops", "stopped", "stopping"},
+		{"create", "created", "creates", "creating"},
+		{"file", "files", "filed", "filing"},
+		{"process", "processes", "processed", "processing"},
+		{"index", "indexes", "indexed", "indexing"},
+		{"connect", "connected", "connecting", "connection", "connections"},
+		{"validate", "validated", "validating", "validation"},
+	}
+	for _, group := range groups {
+		want := stem(group[0])
+		for _, word := range group[1:] {
+			if got := stem(word); got != want {
+				t.Errorf("stem(%q) = %q, want %q like stem(%q)", word, got, want, group[0])
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package unidiff reads unified diffs, such as those of git diff, into the
+// line ranges they change in each file.
+package unidiff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LineRange is an inclusive range of lines of the original file. Lines
+// inserted without replacing any are recorded as the empty range
+// {Start: n+1, End: n} between lines n and n+1, which only overlaps spans
+// that contain both.
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Overlaps reports whether r touches the lines from start to end.
+func (r LineRange) Overlaps(start, end int) bool {
+	return start <= r.End && end >= r.Start
+}
+
+// FileChange is the change a diff makes to one file. OldPath is empty for
+// added files and NewPath for deleted ones.
+type FileChange struct {
+	OldPath string      `json:"old_path"`
+	NewPath string      `json:"new_path"`
+	Ranges  []LineRange `json:"ranges"`
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Parse reads the files and changed line ranges of a unified diff. Paths
+// lose git's a/ and b/ prefixes. Anything outside file headers and hunks,
+// such as commit messages or binary file notices, is ignored.
+func Parse(r io.Reader) ([]FileChange, error) {
+	var changes []FileChange
+	var current *FileChange
+	// Lines left in the current hunk on each side
+	var oldLeft, newLeft int
+	// The next line of the original file and the range being built
+	var oldLine int
+	var block *LineRange
+
+	endBlock := func() {
+		if block != nil {
+			current.Ranges = append(current.Ranges, *block)
+			block = nil
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, "-"):
+				// Deleted lines extend the block, or replace the lines an
+				// insertion was recorded between
+				if block == nil || block.Start > block.End {
+					block = &LineRange{Start: oldLine, End: oldLine}
+				} else {
+					block.End = oldLine
+				}
+				oldLine++
+				oldLeft--
+			case strings.HasPrefix(line, "+"):
+				if block == nil {
+					block = &LineRange{Start: oldLine, End: oldLine - 1}
+				}
+				newLeft--
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file"
+			default:
+				endBlock()
+				oldLine++
+				oldLeft--
+				newLeft--
+			}
+			if oldLeft <= 0 && newLeft <= 0 {
+				endBlock()
+				oldLeft, newLeft = 0, 0
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			changes = append(changes, FileChange{OldPath: diffPath(line[4:], "a/")})
+			current = &changes[len(changes)-1]
+		case strings.HasPrefix(line, "+++ ") && current != nil:
+			current.NewPath = diffPath(line[4:], "b/")
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk without file header", n)
+			}
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: invalid hunk header", n)
+			}
+			oldLine, _ = strconv.Atoi(m[1])
+			oldLeft, newLeft = hunkCount(m[2]), hunkCount(m[4])
+			// Hunks that only add lines name the line they follow
+			if oldLeft == 0 {
+				oldLine++
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, fmt.Errorf("diff ends inside a hunk")
+	}
+	return changes, nil
+}
+
+// hunkCount returns the line count of a hunk header, which is 1 if omitted.
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// diffPath returns the path of a file header, or "" for /dev/null.
+func diffPath(s, prefix string) string {
+	// Headers may carry a tab-separated timestamp
+	s, _, _ = strings.Cut(s, "\t")
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	if s == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(s, prefix)
+}
@@ -0,0 +1,170 @@
+package unidiff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want []FileChange
+	}{
+		{
+			name: "insertion only",
+			diff: `--- a/main.go
++++ b/main.go
+@@ -10,0 +11,2 @@ func main() {
++	a()
++	b()
+`,
+			want: []FileChange{{OldPath: "main.go", NewPath: "main.go", Ranges: []LineRange{{Start: 11, End: 10}}}},
+		},
+		{
+			name: "deletion",
+			diff: `--- a/main.go
++++ b/main.go
+@@ -5,4 +5,2 @@
+ five
+-six
+-seven
+ eight
+`,
+			want: []FileChange{{OldPath: "main.go", NewPath: "main.go", Ranges: []LineRange{{Start: 6, End: 7}}}},
+		},
+		{
+			name: "replacements in one hunk",
+			diff: `--- a/main.go
++++ b/main.go
+@@ -1,5 +1,5 @@
+-one
++uno
+ two
+ three
++drei
+-four
+ five
+`,
+			want: []FileChange{{OldPath: "main.go", NewPath: "main.go", Ranges: []LineRange{{Start: 1, End: 1}, {Start: 4, End: 4}}}},
+		},
+		{
+			name: "added file",
+			diff: `diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,2 @@
++package main
++
+`,
+			want: []FileChange{{OldPath: "", NewPath: "new.go", Ranges: []LineRange{{Start: 1, End: 0}}}},
+		},
+		{
+			name: "deleted file",
+			diff: `--- a/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package main
+-
+`,
+			want: []FileChange{{OldPath: "old.go", NewPath: "", Ranges: []LineRange{{Start: 1, End: 2}}}},
+		},
+		{
+			name: "no newline at end of file",
+			diff: `--- a/README
++++ b/README
+@@ -3 +3 @@
+-last
+\ No newline at end of file
++last line
+\ No newline at end of file
+`,
+			want: []FileChange{{OldPath: "README", NewPath: "README", Ranges: []LineRange{{Start: 3, End: 3}}}},
+		},
+		{
+			name: "prefixes",
+			diff: `--- a/a/b.go	2024-01-01 00:00:00
++++ b/a/b.go	2024-01-02 00:00:00
+@@ -1 +1 @@
+-x
++y
+--- src/plain.go
++++ src/plain.go
+@@ -2 +2 @@
+-x
++y
+--- "a/with space.go"
++++ "b/with space.go"
+@@ -1 +1 @@
+-x
++y
+`,
+			want: []FileChange{
+				{OldPath: "a/b.go", NewPath: "a/b.go", Ranges: []LineRange{{Start: 1, End: 1}}},
+				{OldPath: "src/plain.go", NewPath: "src/plain.go", Ranges: []LineRange{{Start: 2, End: 2}}},
+				{OldPath: "with space.go", NewPath: "with space.go", Ranges: []LineRange{{Start: 1, End: 1}}},
+			},
+		},
+		{
+			name: "lines that look like headers inside hunks",
+			diff: `--- a/notes.md
++++ b/notes.md
+@@ -1,2 +1,2 @@
+--- old
++++ new
+ same
+`,
+			want: []FileChange{{OldPath: "notes.md", NewPath: "notes.md", Ranges: []LineRange{{Start: 1, End: 1}}}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := Parse(strings.NewReader(tt.diff))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Parse = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+	}{
+		{"hunk without file header", "@@ -1 +1 @@\n-x\n+y\n"},
+		{"invalid hunk header", "--- a/x\n+++ b/x\n@@ -a +b @@\n"},
+		{"truncated hunk", "--- a/x\n+++ b/x\n@@ -1,3 +1,3 @@\n one\n"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(strings.NewReader(tt.diff)); err == nil {
+			t.Errorf("%s: Parse succeeded", tt.name)
+		}
+	}
+}
+
+func TestLineRangeOverlaps(t *testing.T) {
+	tests := []struct {
+		r          LineRange
+		start, end int
+		want       bool
+	}{
+		{LineRange{5, 7}, 1, 4, false},
+		{LineRange{5, 7}, 1, 5, true},
+		{LineRange{5, 7}, 7, 9, true},
+		{LineRange{5, 7}, 8, 9, false},
+		// An insertion between lines 10 and 11
+		{LineRange{11, 10}, 1, 10, false},
+		{LineRange{11, 10}, 11, 20, false},
+		{LineRange{11, 10}, 5, 15, true},
+	}
+	for _, tt := range tests {
+		if got := tt.r.Overlaps(tt.start, tt.end); got != tt.want {
+			t.Errorf("%+v.Overlaps(%d, %d) = %v, want %v", tt.r, tt.start, tt.end, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package uploads
+
+import (
+	"codemap/backend/internal/models"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for unknown or expired uploads.
+	ErrNotFound = errors.New("upload not found")
+	// ErrOffsetMismatch is returned when a chunk does not start where the upload left off.
+	ErrOffsetMismatch = errors.New("upload offset does not match")
+	// ErrTooLarge is returned when an upload is longer than the store accepts.
+	ErrTooLarge = errors.New("upload exceeds the maximum size")
+	// ErrIncomplete is returned when the data of an unfinished upload is requested.
+	ErrIncomplete = errors.New("upload is not complete")
+	// ErrDirect is returned when chunks are sent for an upload that goes straight to object storage.
+	ErrDirect = errors.New("upload is sent directly to object storage")
+)
+
+// Upload is the state of a resumable upload.
+type Upload struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	SHA256    string            `json:"sha256,omitempty"`
+	ObjectKey string            `json:"object_key,omitempty"`
+	Client    string            `json:"client,omitempty"` // charged for the upload
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Complete reports whether all bytes of the upload have been received.
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+var idPattern = regexp.MustCompile(`^upl_[0-9a-f]{24}$`)
+
+// Store keeps resumable uploads on disk as a data file that chunks are
+// appended to and a JSON info file. The offset of an upload is the size of its
+// data file, so bytes received before a dropped connection are never lost.
+// Chunks are hashed as they arrive and the SHA-256 state is saved alongside,
+// so a complete upload's digest is known without reading it again.
+// Uploads that are not finished within the expiry are purged.
+type Store struct {
+	dir     string
+	maxSize int64
+	expiry  time.Duration
+
+	mu       sync.Mutex
+	locks    map[string]*sync.Mutex
+	onExpire func(*Upload)
+}
+
+// NewStore creates a store under dir. A maxSize of zero accepts uploads of any length.
+func NewStore(dir string, maxSize int64, expiry time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return &Store{dir: dir, maxSize: maxSize, expiry: expiry, locks: make(map[string]*sync.Mutex)}, nil
+}
+
+// MaxSize returns the largest upload the store accepts, or zero if unlimited.
+func (s *Store) MaxSize() int64 {
+	return s.maxSize
+}
+
+// OnExpire registers a function called with each upload that is purged
+// because it expired before it was finished.
+func (s *Store) OnExpire(fn func(*Upload)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onExpire = fn
+}
+
+// Create starts a new upload of length bytes on behalf of client.
+func (s *Store) Create(length int64, client string, metadata map[string]string) (*Upload, error) {
+	upload, err := s.newUpload(length, client, metadata)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(s.dataPath(upload.ID))
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	if err := s.saveInfo(upload); err != nil {
+		os.Remove(s.dataPath(upload.ID))
+		return nil, err
+	}
+	return upload, nil
+}
+
+// CreateDirect records an upload that the client sends straight to object
+// storage under a key derived by objectKey from the upload ID. The client
+// declares the length and SHA-256 that the object is verified against.
+func (s *Store) CreateDirect(length int64, digest, client string, metadata map[string]string, objectKey func(id string) string) (*Upload, error) {
+	upload, err := s.newUpload(length, client, metadata)
+	if err != nil {
+		return nil, err
+	}
+	upload.SHA256 = digest
+	upload.ObjectKey = objectKey(upload.ID)
+	if err := s.saveInfo(upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+func (s *Store) newUpload(length int64, client string, metadata map[string]string) (*Upload, error) {
+	if s.maxSize > 0 && length > s.maxSize {
+		return nil, ErrTooLarge
+	}
+	s.purge()
+
+	now := time.Now().UTC()
+	return &Upload{
+		ID:        models.NewID("upl"),
+		Length:    length,
+		Client:    client,
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.expiry),
+	}, nil
+}
+
+func (s *Store) saveInfo(upload *Upload) error {
+	info, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.infoPath(upload.ID), info, 0644)
+}
+
+// Get returns the current state of an upload.
+func (s *Store) Get(id string) (*Upload, error) {
+	upload, err := s.loadInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	if upload.ObjectKey != "" {
+		return upload, nil
+	}
+	stat, err := os.Stat(s.dataPath(id))
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	upload.Offset = stat.Size()
+	if upload.Complete() {
+		h, err := s.hashState(id)
+		if err != nil {
+			return nil, err
+		}
+		upload.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	return upload, nil
+}
+
+// loadInfo reads the info file of an upload, whether it expired or not.
+func (s *Store) loadInfo(id string) (*Upload, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(s.infoPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var upload Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("corrupt upload %s: %w", id, err)
+	}
+	return &upload, nil
+}
+
+// Append writes a chunk that starts at offset to the upload. Whatever part of
+// the chunk is received before r fails is kept, and the updated upload is
+// returned together with the read error.
+func (s *Store) Append(id string, offset int64, r io.Reader) (*Upload, error) {
+	lock := s.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	upload, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.ObjectKey != "" {
+		return nil, ErrDirect
+	}
+	if offset != upload.Offset {
+		return upload, ErrOffsetMismatch
+	}
+
+	h, err := s.hashState(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(&hashingWriter{w: f, h: h}, io.LimitReader(r, upload.Length-upload.Offset))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if serr := s.saveHashState(id, h); err == nil {
+		err = serr
+	}
+	upload.Offset += n
+	if upload.Complete() {
+		upload.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	return upload, err
+}
+
+// hashingWriter hashes exactly the bytes that reach the underlying writer, so
+// the hash stays in step with the data file even after a short write.
+type hashingWriter struct {
+	w io.Writer
+	h hash.Hash
+}
+
+func (hw *hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.h.Write(p[:n])
+	return n, err
+}
+
+// hashState restores the SHA-256 state of the bytes received so far.
+func (s *Store) hashState(id string) (hash.Hash, error) {
+	h := sha256.New()
+	state, err := os.ReadFile(s.hashPath(id))
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, fmt.Errorf("corrupt hash state of upload %s: %w", id, err)
+	}
+	return h, nil
+}
+
+func (s *Store) saveHashState(id string, h hash.Hash) error {
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.hashPath(id), state, 0644)
+}
+
+// Path returns the data file of a complete upload.
+func (s *Store) Path(id string) (string, error) {
+	upload, err := s.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if upload.ObjectKey != "" {
+		return "", ErrDirect
+	}
+	if !upload.Complete() {
+		return "", ErrIncomplete
+	}
+	return s.dataPath(id), nil
+}
+
+// Delete removes an upload and its data.
+func (s *Store) Delete(id string) error {
+	if !idPattern.MatchString(id) {
+		return ErrNotFound
+	}
+	lock := s.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := os.Remove(s.infoPath(id)); os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.locks, id)
+	s.mu.Unlock()
+	for _, path := range []string{s.dataPath(id), s.hashPath(id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// purge removes expired uploads and reports them to the OnExpire function.
+func (s *Store) purge() {
+	s.mu.Lock()
+	onExpire := s.onExpire
+	s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !idPattern.MatchString(id) {
+			continue
+		}
+		if _, err := s.Get(id); errors.Is(err, ErrNotFound) {
+			upload, _ := s.loadInfo(id)
+			// Only the purge that deletes the upload reports it
+			if s.Delete(id) == nil && upload != nil && onExpire != nil {
+				onExpire(upload)
+			}
+		}
+	}
+}
+
+func (s *Store) lock(id string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[id] = l
+	}
+	return l
+}
+
+func (s *Store) dataPath(id string) string { return filepath.Join(s.dir, id+".bin") }
+func (s *Store) infoPath(id string) string { return filepath.Join(s.dir, id+".json") }
+func (s *Store) hashPath(id string) string { return filepath.Join(s.dir, id+".sha256") }
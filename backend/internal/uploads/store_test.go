@@ -0,0 +1,202 @@
+package uploads
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAppend(t *testing.T) {
+	failing := errors.New("connection dropped")
+	type chunk struct {
+		offset  int64
+		r       io.Reader
+		wantErr error
+		// wantOffset is the upload's offset after the chunk
+		wantOffset int64
+	}
+	tests := []struct {
+		name   string
+		data   string
+		chunks []chunk
+	}{
+		{
+			name: "one chunk",
+			data: "hello world",
+			chunks: []chunk{
+				{0, strings.NewReader("hello world"), nil, 11},
+			},
+		},
+		{
+			name: "several chunks",
+			data: "hello world",
+			chunks: []chunk{
+				{0, strings.NewReader("hello"), nil, 5},
+				{5, strings.NewReader(" "), nil, 6},
+				{6, strings.NewReader("world"), nil, 11},
+			},
+		},
+		{
+			name: "wrong offsets are refused",
+			data: "hello world",
+			chunks: []chunk{
+				{0, strings.NewReader("hello"), nil, 5},
+				{0, strings.NewReader("hello"), ErrOffsetMismatch, 5},
+				{7, strings.NewReader("orld"), ErrOffsetMismatch, 5},
+				{5, strings.NewReader(" world"), nil, 11},
+			},
+		},
+		{
+			name: "received bytes of a dropped chunk are kept",
+			data: "hello world",
+			chunks: []chunk{
+				{0, io.MultiReader(strings.NewReader("hel"), iotest.ErrReader(failing)), failing, 3},
+				{3, strings.NewReader("lo world"), nil, 11},
+			},
+		},
+		{
+			name: "bytes past the length are ignored",
+			data: "hello",
+			chunks: []chunk{
+				{0, strings.NewReader("hello world"), nil, 5},
+			},
+		},
+	}
+	for _, tt := range tests {
+		store, err := NewStore(t.TempDir(), 0, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		upload, err := store.Create(int64(len(tt.data)), "", map[string]string{"filename": "a.zip"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, c := range tt.chunks {
+			got, err := store.Append(upload.ID, c.offset, c.r)
+			if !errors.Is(err, c.wantErr) {
+				t.Errorf("%s: chunk %d: error %v, want %v", tt.name, i, err, c.wantErr)
+			}
+			if got == nil || got.Offset != c.wantOffset {
+				t.Errorf("%s: chunk %d: upload %+v, want offset %d", tt.name, i, got, c.wantOffset)
+			}
+		}
+
+		got, err := store.Get(upload.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !got.Complete() || got.SHA256 != digest(tt.data) || got.Metadata["filename"] != "a.zip" {
+			t.Errorf("%s: Get = %+v, want complete with sha256 %s", tt.name, got, digest(tt.data))
+		}
+		path, err := store.Path(upload.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != tt.data {
+			t.Errorf("%s: data %q, want %q", tt.name, data, tt.data)
+		}
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	store, err := NewStore(t.TempDir(), 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial, err := store.Create(4, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Append(partial.ID, 0, strings.NewReader("ab")); err != nil {
+		t.Fatal(err)
+	}
+	direct, err := store.CreateDirect(4, digest("abcd"), "", nil, func(id string) string { return "direct/" + id })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"too large", func() error { _, err := store.Create(11, "", nil); return err }, ErrTooLarge},
+		{"too large direct", func() error {
+			_, err := store.CreateDirect(11, "", "", nil, func(id string) string { return id })
+			return err
+		}, ErrTooLarge},
+		{"malformed ID", func() error { _, err := store.Get("../../etc/passwd"); return err }, ErrNotFound},
+		{"unknown ID", func() error { _, err := store.Get("upl_000000000000000000000000"); return err }, ErrNotFound},
+		{"incomplete", func() error { _, err := store.Path(partial.ID); return err }, ErrIncomplete},
+		{"chunk for a direct upload", func() error {
+			_, err := store.Append(direct.ID, 0, strings.NewReader("abcd"))
+			return err
+		}, ErrDirect},
+		{"path of a direct upload", func() error { _, err := store.Path(direct.ID); return err }, ErrDirect},
+		{"delete unknown", func() error { return store.Delete("upl_000000000000000000000000") }, ErrNotFound},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if got, err := store.Get(direct.ID); err != nil || got.ObjectKey != "direct/"+direct.ID || got.SHA256 != digest("abcd") {
+		t.Errorf("Get direct = %+v, %v", got, err)
+	}
+	if err := store.Delete(partial.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(partial.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestExpiredUploadsArePurged(t *testing.T) {
+	dir := t.TempDir()
+	expired, err := NewStore(dir, 0, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := expired.Create(3, "alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expired.Append(old.ID, 0, bytes.NewReader([]byte("abc"))); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Append to expired upload = %v, want ErrNotFound", err)
+	}
+
+	store, err := NewStore(dir, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var purged []*Upload
+	store.OnExpire(func(upload *Upload) { purged = append(purged, upload) })
+	if _, err := store.Create(3, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create(3, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 1 || purged[0].ID != old.ID || purged[0].Client != "alice" || purged[0].Length != 3 {
+		t.Errorf("OnExpire got %+v, want the expired upload once", purged)
+	}
+	for _, name := range []string{old.ID + ".json", old.ID + ".bin"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s of expired upload was not purged: %v", name, err)
+		}
+	}
+}
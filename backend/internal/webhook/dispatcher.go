@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"bytes"
+	"codemap/backend/internal/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Store is the persistence the dispatcher needs for subscriptions and the delivery log.
+type Store interface {
+	ListWebhooks(ctx context.Context, projectID string) ([]models.Webhook, error)
+	WebhookSecret(ctx context.Context, projectID, id string) (string, error)
+	SaveDelivery(ctx context.Context, d *models.WebhookDelivery) error
+}
+
+// Payload is the JSON body POSTed to subscribers.
+type Payload struct {
+	DeliveryID string    `json:"delivery_id"`
+	Event      string    `json:"event"`
+	ProjectID  string    `json:"project_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// Dispatcher delivers events to the webhooks subscribed to them. Deliveries run
+// in the background and are retried with exponential backoff.
+type Dispatcher struct {
+	store       Store
+	sealer      *Sealer
+	client      *http.Client
+	logger      *log.Logger
+	maxAttempts int
+	backoff     time.Duration
+	// allowPrivate permits deliveries to non-public addresses
+	allowPrivate bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher creates a dispatcher that makes up to maxAttempts delivery attempts per event.
+// Secrets are opened with sealer. Deliveries to non-public addresses are
+// refused unless allowPrivate is set.
+func NewDispatcher(store Store, sealer *Sealer, logger *log.Logger, maxAttempts int, timeout time.Duration, allowPrivate bool) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		store:       store,
+		sealer:      sealer,
+		client:      newClient(timeout, allowPrivate),
+		logger:      logger,
+		maxAttempts: maxAttempts,
+		backoff:     2 * time.Second,
+
+		allowPrivate: allowPrivate,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// CheckURL verifies that a URL may be subscribed; see the package's CheckURL.
+func (d *Dispatcher) CheckURL(ctx context.Context, raw string) error {
+	return CheckURL(ctx, raw, d.allowPrivate)
+}
+
+// Seal encrypts a webhook secret for storage.
+func (d *Dispatcher) Seal(secret string) (string, error) {
+	return d.sealer.Seal(secret)
+}
+
+// Dispatch sends event to every webhook of the project subscribed to it.
+func (d *Dispatcher) Dispatch(projectID, event string, data any) {
+	d.DispatchFunc(projectID, event, func(models.Webhook) (any, bool) { return data, true })
+}
+
+// DispatchFunc is like Dispatch but lets the caller build the data per webhook,
+// or skip a webhook by returning false.
+func (d *Dispatcher) DispatchFunc(projectID, event string, build func(hook models.Webhook) (any, bool)) {
+	hooks, err := d.store.ListWebhooks(d.ctx, projectID)
+	if err != nil {
+		d.logger.Printf("webhook: could not load subscriptions for project %s: %v", projectID, err)
+		return
+	}
+	for _, hook := range hooks {
+		if !hook.Subscribes(event) {
+			continue
+		}
+		data, ok := build(hook)
+		if !ok {
+			continue
+		}
+		payload := Payload{
+			DeliveryID: models.NewID("dlv"),
+			Event:      event,
+			ProjectID:  projectID,
+			OccurredAt: time.Now().UTC(),
+			Data:       data,
+		}
+		d.wg.Add(1)
+		go func(hook models.Webhook) {
+			defer d.wg.Done()
+			d.deliver(hook, payload)
+		}(hook)
+	}
+}
+
+// Close stops pending retries and waits for in-flight deliveries to finish.
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) deliver(hook models.Webhook, payload Payload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.logger.Printf("webhook: could not encode %s payload: %v", payload.Event, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	delivery := &models.WebhookDelivery{
+		ID:        payload.DeliveryID,
+		WebhookID: hook.ID,
+		Event:     payload.Event,
+		Status:    models.DeliveryPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	d.save(delivery)
+
+	secret, err := d.secret(hook)
+	if err != nil {
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = err.Error()
+		delivery.UpdatedAt = time.Now().UTC()
+		d.save(delivery)
+		return
+	}
+
+	wait := d.backoff
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		code, err := d.post(hook, secret, payload, body)
+		delivery.Attempts = int64(attempt)
+		delivery.ResponseCode = int64(code)
+		delivery.UpdatedAt = time.Now().UTC()
+		if err == nil {
+			delivery.Status = models.DeliverySucceeded
+			delivery.Error = ""
+			d.save(delivery)
+			return
+		}
+		delivery.Error = err.Error()
+		if attempt == d.maxAttempts {
+			break
+		}
+		d.save(delivery)
+
+		select {
+		case <-time.After(wait):
+			wait *= 2
+		case <-d.ctx.Done():
+			delivery.Error = "delivery abandoned during shutdown: " + delivery.Error
+			delivery.Status = models.DeliveryFailed
+			d.save(delivery)
+			return
+		}
+	}
+	delivery.Status = models.DeliveryFailed
+	d.save(delivery)
+}
+
+// secret returns the unsealed secret of a webhook.
+func (d *Dispatcher) secret(hook models.Webhook) (string, error) {
+	sealed, err := d.store.WebhookSecret(d.ctx, hook.ProjectID, hook.ID)
+	if err != nil {
+		return "", err
+	}
+	return d.sealer.Open(sealed)
+}
+
+// post makes a single delivery attempt. Any non-2xx response is an error.
+func (d *Dispatcher) post(hook models.Webhook, secret string, payload Payload, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CodeMap-Webhook/1.0")
+	req.Header.Set("X-CodeMap-Event", payload.Event)
+	req.Header.Set("X-CodeMap-Delivery", payload.DeliveryID)
+	req.Header.Set("X-CodeMap-Signature", Sign(secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) save(delivery *models.WebhookDelivery) {
+	// The delivery log must be written even while shutting down.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := d.store.SaveDelivery(ctx, delivery); err != nil {
+		d.logger.Printf("webhook: %v", err)
+	}
+}
+
+// Sign returns the X-CodeMap-Signature header value for body: the hex encoded
+// HMAC-SHA256 of the body keyed with the webhook secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
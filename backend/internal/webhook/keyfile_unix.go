@@ -0,0 +1,20 @@
+//go:build unix
+
+package webhook
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkKeyFile refuses key files that other users own or may read.
+func checkKeyFile(path string, info os.FileInfo) error {
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("webhook key %s has mode %04o, want 0600 or narrower", path, perm)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("webhook key %s is owned by uid %d, not by the server's uid %d", path, stat.Uid, os.Getuid())
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sealedPrefix marks secrets sealed by a Sealer.
+const sealedPrefix = "v1:"
+
+// Sealer encrypts webhook secrets before they are stored, as deliveries have
+// to be signed with the secret itself and it cannot be hashed. Secrets are
+// sealed with AES-256-GCM under a key kept outside the database.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// LoadSealer creates a sealer with the key in path. If the file does not exist
+// the key is generated and written first, unless create is false because
+// secrets sealed with the missing key are stored. The file must be owned by
+// the current user and readable by no one else.
+func LoadSealer(path string, create bool) (*Sealer, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if !create {
+			return nil, fmt.Errorf("webhook key %s does not exist, but webhook secrets sealed with it are stored", path)
+		}
+		return generateKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook key: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook key: %w", err)
+	}
+	if err := checkKeyFile(path, info); err != nil {
+		return nil, err
+	}
+	key, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook key: %w", err)
+	}
+	return NewSealer(key)
+}
+
+// generateKey writes a new random key to path and returns its sealer.
+func generateKey(path string) (*Sealer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create webhook key directory: %w", err)
+	}
+	// O_EXCL keeps a key another server just wrote
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return LoadSealer(path, false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write webhook key: %w", err)
+	}
+	_, err = f.Write(key)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write webhook key: %w", err)
+	}
+	return NewSealer(key)
+}
+
+// NewSealer creates a sealer with a 32 byte key.
+func NewSealer(key []byte) (*Sealer, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("webhook key must be 32 bytes, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts a secret for storage.
+func (s *Sealer) Seal(secret string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to seal webhook secret: %w", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(secret), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a secret sealed by Seal.
+func (s *Sealer) Open(sealed string) (string, error) {
+	raw, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return "", errors.New("webhook secret is not sealed")
+	}
+	data, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(data) < s.aead.NonceSize() {
+		return "", errors.New("webhook secret is malformed")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	secret, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("webhook secret was sealed with another key")
+	}
+	return string(secret), nil
+}
@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSealer(t *testing.T) {
+	sealer, err := NewSealer(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSealer(bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := sealer.Seal("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "s3cret") {
+		t.Fatalf("sealed secret %q holds the plaintext", sealed)
+	}
+
+	tests := []struct {
+		name    string
+		sealer  *Sealer
+		sealed  string
+		want    string
+		wantErr bool
+	}{
+		{name: "round trip", sealer: sealer, sealed: sealed, want: "s3cret"},
+		{name: "other key", sealer: other, sealed: sealed, wantErr: true},
+		{name: "plaintext", sealer: sealer, sealed: "s3cret", wantErr: true},
+		{name: "truncated", sealer: sealer, sealed: sealedPrefix + "AAAA", wantErr: true},
+		{name: "not base64", sealer: sealer, sealed: sealedPrefix + "!!", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.sealer.Open(tt.sealed)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: Open = %q, %v, want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadSealer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "webhook.key")
+	first, err := LoadSealer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("key file = %v, %v, want mode 0600", info, err)
+	}
+	sealed, err := first.Seal("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadSealer(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := second.Open(sealed); err != nil || got != "s3cret" {
+		t.Errorf("Open with reloaded key = %q, %v", got, err)
+	}
+}
+
+func TestLoadSealerRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    []byte // nil for a missing file
+		mode   os.FileMode
+		create bool
+	}{
+		{name: "missing with sealed secrets", create: false},
+		{name: "short key", key: []byte("short"), mode: 0600, create: true},
+		{name: "group readable", key: bytes.Repeat([]byte{1}, 32), mode: 0640, create: true},
+		{name: "world readable", key: bytes.Repeat([]byte{1}, 32), mode: 0644, create: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "webhook.key")
+			if tt.key != nil {
+				if err := os.WriteFile(path, tt.key, tt.mode); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chmod(path, tt.mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := LoadSealer(path, tt.create); err == nil {
+				t.Fatal("LoadSealer succeeded")
+			}
+			if tt.key == nil {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("a key was generated: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for webhook URLs that resolve to an address
+// of the server's own networks.
+var ErrPrivateAddress = errors.New("webhook URL must not resolve to a loopback, link-local or private address")
+
+// reservedPrefixes are ranges netip counts as global unicast but that lead
+// to the local host or its networks.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // this network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, embedding IPv4 addresses
+}
+
+// publicAddress reports whether webhooks may be delivered to addr, which
+// excludes the loopback, link-local, private and other non-global ranges a
+// subscriber could use to reach services behind the server.
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL verifies that a webhook URL is an absolute http(s) URL and, unless
+// allowPrivate is set, that its host only resolves to public addresses.
+// Deliveries check the address they connect to again, as DNS can change.
+func CheckURL(ctx context.Context, raw string, allowPrivate bool) error {
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return errors.New("webhook URL must be an absolute http(s) URL")
+	}
+	if allowPrivate {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", target.Hostname())
+	if err != nil {
+		return fmt.Errorf("could not resolve webhook host %s: %w", target.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// newClient returns the HTTP client deliveries are made with. Unless
+// allowPrivate is set, it refuses to connect to non-public addresses, which
+// also covers redirects and hosts whose DNS changed after the check at
+// creation. Proxies are not used, as they would connect on its behalf.
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddress(addr.Addr()) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	}
+	for _, tt := range tests {
+		if got := publicAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("publicAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		wantErr      bool
+		private      bool
+	}{
+		{url: "https://93.184.216.34/hook"},
+		{url: "http://127.0.0.1:8080/hook", wantErr: true, private: true},
+		{url: "http://[::1]/hook", wantErr: true, private: true},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: true, private: true},
+		{url: "http://127.0.0.1:8080/hook", allowPrivate: true},
+		{url: "ftp://93.184.216.34/hook", wantErr: true},
+		{url: "/hook", wantErr: true},
+		{url: "http://", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := CheckURL(context.Background(), tt.url, tt.allowPrivate)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckURL(%q, %v) = %v, want error %v", tt.url, tt.allowPrivate, err, tt.wantErr)
+			continue
+		}
+		if tt.private && !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("CheckURL(%q) = %v, want ErrPrivateAddress", tt.url, err)
+		}
+	}
+}
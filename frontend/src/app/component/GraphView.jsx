@@ -5,6 +5,28 @@ import cytoscape from "cytoscape";
 // Helper: Convert Neo4j data to Cytoscape format (with placeholder nodes and safe edges)
 // Helper: Convert Neo4j data to Cytoscape format (with placeholder nodes and safe edges)
 function neo4jToCytoscape(neo4jData) {
+  // Graph-shaped query results already carry deduplicated nodes and edges
+  if (neo4jData && Array.isArray(neo4jData.nodes)) {
+    return {
+      nodes: neo4jData.nodes.map(node => ({
+        data: {
+          ...node.props,
+          id: node.id,
+          label: node.props?.name || node.props?.path || node.labels[0] || node.id,
+          type: node.labels[0] || "Unknown"
+        }
+      })),
+      edges: (neo4jData.edges || []).map(edge => ({
+        data: {
+          ...edge.props,
+          id: edge.id,
+          source: edge.source,
+          target: edge.target,
+          label: edge.type
+        }
+      }))
+    };
+  }
   if (!neo4jData || !Array.isArray(neo4jData)) return { nodes: [], edges: [] };
 
   const nodes = new Map();
@@ -1,183 +1,69 @@
 "use client";
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import GraphView from "./GraphView";
+import { authHeaders } from "../lib/apiKey";
 
-const QueryDashboard = () => {
+const QueryDashboard = ({ apiKey = "" }) => {
   const [selectedQuery, setSelectedQuery] = useState(null);
   const [results, setResults] = useState(null);
   const [loading, setLoading] = useState(false);
 
-  // Real queries that help users understand their codebase COMPLETELY
-  const queryTemplates = [
-    // 🔍 UNDERSTANDING: What's in my codebase?
-    {
-      id: "codebase_overview",
-      name: "� Codebase Overview",
-      description: "Complete summary of your codebase structure",
-      icon: "�",
-      category: "🔍 Understanding",
-      query: "MATCH (n) RETURN labels(n)[0] as type, count(n) as count ORDER BY count DESC",
-      resultType: "table"
-    },
-    {
-      id: "file_languages",
-      name: "🌍 Languages Used", 
-      description: "Programming languages in your project",
-      icon: "🌍",
-      category: "🔍 Understanding",
-      query: "MATCH (f:File) WHERE f.language IS NOT NULL RETURN f.language as language, count(f) as files ORDER BY files DESC",
-      resultType: "table"
-    },
-    {
-      id: "largest_files",
-      name: "📈 Largest Files",
-      description: "Files with most functions/classes",
-      icon: "�", 
-      category: "🔍 Understanding",
-      query: "MATCH (f:File)-[:CONTAINS]->(item) WITH f.path as file, count(item) as size ORDER BY size DESC RETURN file, size LIMIT 20",
-      resultType: "table"
-    },
+  const [queryTemplates, setQueryTemplates] = useState([]);
 
-    // 🔗 CONNECTIONS: How things relate to each other
-    {
-      id: "complete_graph",
-      name: "🌐 Complete Code Graph",
-      description: "Full visualization of your codebase relationships", 
-      icon: "🌐",
-      category: "🔗 Connections",
-      query: "MATCH (n)-[r]->(m) RETURN n, r, m LIMIT 200",
-      resultType: "graph"
-    },
-    {
-      id: "file_dependencies",
-      name: "📁 File Import Network",
-      description: "How files depend on each other",
-      icon: "�",
-      category: "🔗 Connections", 
-      query: "MATCH (source:File)-[r:IMPORTS]->(target:File) RETURN source, r, target LIMIT 50",
-      resultType: "graph"
-    },
-    {
-      id: "function_network", 
-      name: "⚡ Function Call Network",
-      description: "Which functions call which functions",
-      icon: "⚡",
-      category: "🔗 Connections",
-      query: "MATCH (caller:Function)-[r:CALLS]->(callee:Function) RETURN caller, r, callee LIMIT 50",
-      resultType: "graph"
-    },
-    {
-      id: "class_hierarchy",
-      name: "🏗️ Class & Method Structure", 
-      description: "Classes and their methods relationship",
-      icon: "🏗️",
-      category: "🔗 Connections",
-      query: "MATCH (c:Class)-[r:HAS_METHOD]->(m:Function) RETURN c, r, m LIMIT 40",
-      resultType: "graph"
-    },
-
-    // 🎯 INSIGHTS: Important patterns and hotspots  
-    {
-      id: "central_files",
-      name: "🔥 Most Important Files",
-      description: "Files that many others depend on",
-      icon: "�",
-      category: "🎯 Insights",
-      query: "MATCH (f:File)<-[:IMPORTS]-(importer) WITH f, count(importer) as importers WHERE importers > 1 RETURN f.path as file, importers ORDER BY importers DESC LIMIT 15",
-      resultType: "table"
-    },
-    {
-      id: "popular_functions",
-      name: "⭐ Most Called Functions", 
-      description: "Functions used throughout your codebase",
-      icon: "⭐",
-      category: "🎯 Insights",
-      query: "MATCH (fn:Function)<-[:CALLS]-(caller) WITH fn, count(caller) as calls WHERE calls > 1 RETURN fn.name as function, calls ORDER BY calls DESC LIMIT 15",
-      resultType: "table"
-    },
-    {
-      id: "isolated_components",
-      name: "🏝️ Isolated Components",
-      description: "Files or functions with no connections",
-      icon: "🏝️", 
-      category: "🎯 Insights",
-      query: "MATCH (n) WHERE NOT (n)--() RETURN labels(n)[0] as type, n.name as name, n.path as path LIMIT 20",
-      resultType: "table"
-    },
+  // Display names and icons of the catalog's categories
+  const categoryInfo = {
+    understanding: { label: "🔍 Understanding", icon: "🔍" },
+    connections: { label: "🔗 Connections", icon: "🔗" },
+    insights: { label: "🎯 Insights", icon: "🎯" },
+    exploration: { label: "🔬 Exploration", icon: "🔬" },
+  };
 
-    // 🔬 EXPLORATION: Deep dive into specific areas
-    {
-      id: "exported_items",
-      name: "🚀 Public API Surface",
-      description: "All exported functions and classes",
-      icon: "🚀",
-      category: "🔬 Exploration", 
-      query: "MATCH (n) WHERE n.is_exported = true RETURN labels(n)[0] as type, n.name as name ORDER BY type, name",
-      resultType: "table"
-    },
-    {
-      id: "file_contents",
-      name: "📋 File Contents Breakdown",
-      description: "What each file contains (functions, classes)",
-      icon: "📋",
-      category: "🔬 Exploration",
-      query: "MATCH (f:File)-[:CONTAINS]->(item) RETURN f.path as file, labels(item)[0] as contains, item.name as name ORDER BY file LIMIT 100", 
-      resultType: "table"
-    }
-  ];
+  // The queries come from the server's named query catalog
+  useEffect(() => {
+    fetch("http://localhost:8080/v1/queries", { headers: authHeaders(apiKey) })
+      .then(response => response.json())
+      .then(entries => {
+        if (!Array.isArray(entries)) {
+          setQueryTemplates([]);
+          return;
+        }
+        setQueryTemplates(entries.map(entry => ({
+          id: entry.name,
+          name: entry.name.replace(/_/g, " "),
+          description: entry.description,
+          icon: categoryInfo[entry.category]?.icon || "📄",
+          category: categoryInfo[entry.category]?.label || entry.category,
+          resultType: entry.result,
+        })));
+      })
+      .catch(error => console.error("Could not load query catalog:", error));
+  }, [apiKey]);
 
   const categories = [...new Set(queryTemplates.map(q => q.category))];
 
-  // Convert Neo4j results to Cytoscape format
+  // Convert graph-shaped results to Cytoscape format
   const getCytoscapeData = () => {
-    if (!results || results.error) return { nodes: [], edges: [] };
-    
-    const nodes = new Map();
-    const edges = [];
-    
-    results.forEach((row, index) => {
-      Object.values(row).forEach(item => {
-        if (item && typeof item === 'object') {
-          // Handle nodes
-          if (item.elementId || item.identity) {
-            const nodeId = item.elementId || item.identity || `node_${index}`;
-            const labels = item.labels || ['Unknown'];
-            const properties = item.properties || {};
-            
-            nodes.set(nodeId, {
-              data: {
-                id: nodeId,
-                label: properties.name || properties.path || labels[0] || nodeId,
-                type: labels[0] || 'Unknown',
-                ...properties
-              }
-            });
-          }
-          
-          // Handle relationships
-          if (item.type && (item.startNodeElementId || item.start)) {
-            const startId = item.startNodeElementId || item.start;
-            const endId = item.endNodeElementId || item.end;
-            const edgeId = item.elementId || `edge_${index}`;
-            
-            edges.push({
-              data: {
-                id: edgeId,
-                source: startId,
-                target: endId,
-                label: item.type,
-                type: item.type,
-                ...item.properties
-              }
-            });
-          }
-        }
-      });
-    });
-    
+    if (!results || results.error || !results.nodes) return { nodes: [], edges: [] };
+
     return {
-      nodes: Array.from(nodes.values()),
-      edges: edges
+      nodes: results.nodes.map(node => ({
+        data: {
+          ...node.props,
+          id: node.id,
+          label: node.props.name || node.props.path || node.labels[0] || node.id,
+          type: node.labels[0] || 'Unknown'
+        }
+      })),
+      edges: results.edges.map(edge => ({
+        data: {
+          ...edge.props,
+          id: edge.id,
+          source: edge.source,
+          target: edge.target,
+          label: edge.type,
+          type: edge.type
+        }
+      }))
     };
   };
 
@@ -207,23 +93,24 @@ const QueryDashboard = () => {
     setSelectedQuery(template);
     
     try {
-      const response = await fetch("http://localhost:8080/v1/query", {
+      const response = await fetch(`http://localhost:8080/v1/queries/${template.id}/run`, {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
+          ...authHeaders(apiKey),
         },
         body: JSON.stringify({
-          query: template.query,
           params: {}
         }),
       });
 
       const data = await response.json();
 
-      console.log("Backend data" , data[0])
-      
       if (response.ok) {
-        setResults(data);
+        if (data.data.truncated) {
+          console.warn(`Results truncated by the ${data.data.truncated_by} limit`);
+        }
+        setResults(data.data);
       } else {
         console.error("Query failed:", data.error);
         setResults({ error: data.error });
@@ -247,7 +134,7 @@ const QueryDashboard = () => {
       );
     }
 
-    if (selectedQuery?.resultType === "table") {
+    if (results.format === "table") {
       return (
         <div className="bg-gray-800 rounded-lg p-4">
           <h3 className="text-lg font-semibold mb-4">Results</h3>
@@ -255,15 +142,15 @@ const QueryDashboard = () => {
             <table className="w-full text-sm">
               <thead>
                 <tr className="border-b border-gray-600">
-                  {results.length > 0 && Object.keys(results[0]).map(key => (
+                  {results.columns.map(key => (
                     <th key={key} className="text-left p-2">{key}</th>
                   ))}
                 </tr>
               </thead>
               <tbody>
-                {results.map((row, i) => (
+                {results.rows.map((row, i) => (
                   <tr key={i} className="border-b border-gray-700">
-                    {Object.values(row).map((value, j) => (
+                    {row.map((value, j) => (
                       <td key={j} className="p-2">{String(value)}</td>
                     ))}
                   </tr>
@@ -283,7 +170,7 @@ const QueryDashboard = () => {
         <div className="grid md:grid-cols-2 gap-4 mb-4">
           <div className="bg-gray-900 p-3 rounded">
             <h4 className="font-medium mb-2 text-teal-300">Statistics</h4>
-            <p className="text-sm">Total Results: {results.length}</p>
+            <p className="text-sm">Total Results: {results.records}</p>
             <p className="text-sm">Unique Nodes: {getCytoscapeData().nodes.length}</p>
             <p className="text-sm">Relationships: {getCytoscapeData().edges.length}</p>
           </div>
@@ -314,13 +201,13 @@ const QueryDashboard = () => {
           </div>
 
           <div>
-            <h4 className="font-medium mb-2 text-orange-300">Raw Neo4j Data:</h4>
+            <h4 className="font-medium mb-2 text-orange-300">Nodes:</h4>
             <pre className="bg-gray-900 p-3 rounded text-xs overflow-auto max-h-40">
-              {JSON.stringify(results.slice(0, 3), null, 2)}
+              {JSON.stringify(results.nodes.slice(0, 3), null, 2)}
             </pre>
-            {results.length > 3 && (
+            {results.nodes.length > 3 && (
               <p className="text-sm text-gray-400 mt-2">
-                Showing first 3 raw results. Total: {results.length}
+                Showing first 3 nodes. Total: {results.nodes.length}
               </p>
             )}
           </div>
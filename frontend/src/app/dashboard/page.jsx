@@ -1,8 +1,9 @@
 "use client";
 import Navbar from "../component/Navbar";
 import QueryDashboard from "../component/QueryDashboard";
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import GraphView from "../component/GraphView";
+import { authHeaders, loadApiKey, saveApiKey } from "../lib/apiKey";
 
 export default function Dashboard() {
   const [file, setFile] = useState(null);
@@ -10,6 +11,16 @@ export default function Dashboard() {
   const [message, setMessage] = useState("");
   const [uploadType, setUploadType] = useState("zip"); // "zip" or "github"
   const [loading, setLoading] = useState(false);
+  const [apiKey, setApiKey] = useState("");
+
+  useEffect(() => {
+    setApiKey(loadApiKey());
+  }, []);
+
+  const handleApiKeyChange = (event) => {
+    setApiKey(event.target.value.trim());
+    saveApiKey(event.target.value.trim());
+  };
 
   const handleFileChange = (event) => {
     if (event.target.files && event.target.files[0]) {
@@ -30,6 +41,7 @@ export default function Dashboard() {
 
       const res = await fetch("http://localhost:8080/v1/upload", {
         method: "POST",
+        headers: authHeaders(apiKey),
         body: formData,
       });
 
@@ -64,6 +76,7 @@ export default function Dashboard() {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
+          ...authHeaders(apiKey),
         },
         body: JSON.stringify({
           repo_url: githubUrl,
@@ -111,6 +124,20 @@ export default function Dashboard() {
             <section className="bg-gray-800 rounded-lg p-8 shadow-lg ">
               <div>
                 <h2 className="text-2xl font-semibold mb-6 text-center"> Upload Your Codebase</h2>
+                {/* API Key */}
+                <div className="mb-6 space-y-2">
+                  <input
+                    type="password"
+                    placeholder="API key (cm_...)"
+                    value={apiKey}
+                    onChange={handleApiKeyChange}
+                    autoComplete="off"
+                    className="w-full p-3 bg-gray-700 border border-gray-600 rounded-lg text-white placeholder-gray-400 focus:outline-none focus:border-teal-500 focus:ring-2 focus:ring-teal-500/20"
+                  />
+                  <p className="text-sm text-gray-400">
+                    Required unless the server runs with AUTH_ENABLED=false
+                  </p>
+                </div>
                 {/* Upload Type Toggle */}
                 <div className="flex justify-center mb-8">
                   <div className="flex bg-gray-700 rounded-lg p-1">
@@ -225,7 +252,7 @@ export default function Dashboard() {
 
   <section className="bg-gray-800 rounded-lg p-8 shadow-lg h-full flex flex-col">
               <h2 className="text-2xl font-semibold mb-6 text-center"> Query & Analyze</h2>
-              <QueryDashboard />
+              <QueryDashboard apiKey={apiKey} />
             </section>
 
       </div>
@@ -0,0 +1,20 @@
+// The CodeMap API requires an API key unless the server runs with
+// AUTH_ENABLED=false. The key is entered on the dashboard and kept in this
+// browser's local storage only.
+const STORAGE_KEY = "codemap.apiKey";
+
+export const loadApiKey = () => {
+  if (typeof window === "undefined") return "";
+  return window.localStorage.getItem(STORAGE_KEY) || "";
+};
+
+export const saveApiKey = (apiKey) => {
+  if (apiKey) {
+    window.localStorage.setItem(STORAGE_KEY, apiKey);
+  } else {
+    window.localStorage.removeItem(STORAGE_KEY);
+  }
+};
+
+// Headers that authenticate a request with the API key, if one is set
+export const authHeaders = (apiKey) => (apiKey ? { "X-API-Key": apiKey } : {});
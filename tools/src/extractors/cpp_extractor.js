@@ -1,3 +1,5 @@
+const { docComment, isStringLiteral, addString } = require('./text');
+
 function extract(tree, config) {
     const results = { functions: [], classes: [], imports: [] };
     const contextStack = [];
@@ -24,7 +26,7 @@ function extract(tree, config) {
         if (node.type === 'class_specifier') {
             const nameNode = node.childForFieldName('name');
             if (nameNode) {
-                const classObj = { name: nameNode.text, properties: [], methods: [], is_exported: true };
+                const classObj = { name: nameNode.text, properties: [], methods: [], is_exported: true, start_line: node.startPosition.row + 1, end_line: node.endPosition.row + 1, doc: docComment(node) };
                 results.classes.push(classObj);
                 contextStack.push(classObj);
                 isClassNode = true;
@@ -48,6 +50,10 @@ function extract(tree, config) {
                     return_types: [node.childForFieldName('type')?.text || 'void'],
                     is_exported: true,
                     is_method_of: isMethod ? currentContext.name : null,
+                    start_line: node.startPosition.row + 1,
+                    end_line: node.endPosition.row + 1,
+                    doc: docComment(node),
+                    strings: [],
                 };
                 results.functions.push(funcObj);
 
@@ -79,6 +85,10 @@ function extract(tree, config) {
             }
         }
 
+        if (isStringLiteral(node)) {
+            addString(contextStack.findLast(c => c.strings), node);
+        }
+
         for (const child of node.children) traverse(child);
 
         if (isClassNode || isFunctionNode) contextStack.pop();
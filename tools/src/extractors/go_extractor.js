@@ -1,3 +1,5 @@
+const { docComment, isStringLiteral, addString } = require('./text');
+
 function extract(tree, config) {
     const results = { functions: [], classes: [], imports: [] };
     const contextStack = [];
@@ -26,7 +28,7 @@ function extract(tree, config) {
                     .filter(c => c.type === 'field_declaration')
                     .flatMap(f => f.children.filter(id => id.type === 'field_identifier').map(id => id.text)) || [];
 
-                const classObj = { name: nameNode.text, properties, methods: [], is_exported: isExported };
+                const classObj = { name: nameNode.text, properties, methods: [], is_exported: isExported, start_line: node.startPosition.row + 1, end_line: node.endPosition.row + 1, doc: docComment(node) };
                 results.classes.push(classObj);
                 contextStack.push(classObj);
                 isClassNode = true;
@@ -50,6 +52,10 @@ function extract(tree, config) {
                     return_types: [node.childForFieldName('result')?.text || 'void'],
                     is_exported: isExported,
                     is_method_of: receiverType || null,
+                    start_line: node.startPosition.row + 1,
+                    end_line: node.endPosition.row + 1,
+                    doc: docComment(node),
+                    strings: [],
                 };
                 results.functions.push(funcObj);
 
@@ -71,6 +77,10 @@ function extract(tree, config) {
             }
         }
 
+        if (isStringLiteral(node)) {
+            addString(contextStack.findLast(c => c.strings), node);
+        }
+
         for (const child of node.children) traverse(child);
 
         if (isClassNode || isFunctionNode) contextStack.pop();
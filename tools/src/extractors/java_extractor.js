@@ -1,3 +1,5 @@
+const { docComment, isStringLiteral, addString } = require('./text');
+
 function extract(tree, config) {
     const results = { functions: [], classes: [], imports: [] };
     const contextStack = [];
@@ -23,7 +25,7 @@ function extract(tree, config) {
             const nameNode = node.childForFieldName('name');
             if (nameNode) {
                 const isExported = node.childForFieldName('modifiers')?.text.includes('public') ?? false;
-                const classObj = { name: nameNode.text, properties: [], methods: [], is_exported: isExported };
+                const classObj = { name: nameNode.text, properties: [], methods: [], is_exported: isExported, start_line: node.startPosition.row + 1, end_line: node.endPosition.row + 1, doc: docComment(node) };
                 results.classes.push(classObj);
                 contextStack.push(classObj);
                 isClassNode = true;
@@ -44,6 +46,10 @@ function extract(tree, config) {
                     return_types: [node.childForFieldName('type')?.text || 'void'],
                     is_exported: isExported,
                     is_method_of: currentContext ? currentContext.name : null,
+                    start_line: node.startPosition.row + 1,
+                    end_line: node.endPosition.row + 1,
+                    doc: docComment(node),
+                    strings: [],
                 };
                 results.functions.push(funcObj);
 
@@ -73,6 +79,10 @@ function extract(tree, config) {
             }
         }
 
+        if (isStringLiteral(node)) {
+            addString(contextStack.findLast(c => c.strings), node);
+        }
+
         for (const child of node.children) traverse(child);
 
         if (isClassNode || isFunctionNode) contextStack.pop();
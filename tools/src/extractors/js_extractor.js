@@ -1,3 +1,5 @@
+const { docComment, isStringLiteral, addString } = require('./text');
+
 function extract(tree, config) {
     const results = { functions: [], classes: [], imports: [] };
     const contextStack = [];
@@ -43,7 +45,7 @@ function extract(tree, config) {
         if (node.type === 'class_declaration') {
             const nameNode = node.childForFieldName('name');
             if (nameNode) {
-                const classObj = { name: nameNode.text, properties: [], methods: [], is_exported: false };
+                const classObj = { name: nameNode.text, properties: [], methods: [], is_exported: false, start_line: node.startPosition.row + 1, end_line: node.endPosition.row + 1, doc: docComment(node) };
                 results.classes.push(classObj);
                 contextStack.push(classObj);
                 isClassNode = true;
@@ -64,6 +66,10 @@ function extract(tree, config) {
                     return_types: [], // JS doesn't have explicit return types
                     is_exported: false,
                     is_method_of: isMethod ? currentContext.name : null,
+                    start_line: node.startPosition.row + 1,
+                    end_line: node.endPosition.row + 1,
+                    doc: docComment(node),
+                    strings: [],
                 };
                 results.functions.push(funcObj);
 
@@ -91,6 +97,10 @@ function extract(tree, config) {
             }
         }
 
+        if (isStringLiteral(node)) {
+            addString(contextStack.findLast(c => c.strings), node);
+        }
+
         for (const child of node.children) traverse(child);
 
         if (isClassNode || isFunctionNode) contextStack.pop();
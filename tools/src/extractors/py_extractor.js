@@ -49,6 +49,8 @@
 // }
 
 // module.exports = { extract };
+const { docComment, docstring, isStringLiteral, addString } = require('./text');
+
 function extract(tree, config) {
     const results = { functions: [], classes: [], imports: [] };
     const contextStack = [];
@@ -77,7 +79,7 @@ function extract(tree, config) {
                     .filter(c => c.type === 'expression_statement' && c.child(0).type === 'assignment')
                     .map(a => a.child(0).childForFieldName('left')?.text)
                     .filter(Boolean);
-                const classObj = { name: nameNode.text, properties, methods: [], is_exported: !nameNode.text.startsWith('_') };
+                const classObj = { name: nameNode.text, properties, methods: [], is_exported: !nameNode.text.startsWith('_'), start_line: node.startPosition.row + 1, end_line: node.endPosition.row + 1, doc: docstring(node) || docComment(node) };
                 results.classes.push(classObj);
                 contextStack.push(classObj);
                 isClassNode = true;
@@ -99,6 +101,10 @@ function extract(tree, config) {
                     return_types: [node.childForFieldName('return_type')?.text || 'any'],
                     is_exported: !nameNode.text.startsWith('_'),
                     is_method_of: isMethod ? currentContext.name : null,
+                    start_line: node.startPosition.row + 1,
+                    end_line: node.endPosition.row + 1,
+                    doc: docstring(node) || docComment(node),
+                    strings: [],
                 };
                 results.functions.push(funcObj);
 
@@ -119,6 +125,10 @@ function extract(tree, config) {
             }
         }
 
+        if (isStringLiteral(node)) {
+            addString(contextStack.findLast(c => c.strings), node);
+        }
+
         for (const child of node.children) traverse(child);
 
         if (isClassNode || isFunctionNode) contextStack.pop();
@@ -1,3 +1,5 @@
+const { docComment, isStringLiteral, addString } = require('./text');
+
 function extract(tree, config) {
     const results = { functions: [], classes: [], imports: [] };
     const contextStack = [];
@@ -24,7 +26,7 @@ function extract(tree, config) {
             const nameNode = node.childForFieldName('name');
             if (nameNode) {
                 const isExported = node.childForFieldName('modifiers')?.text.includes('public') ?? false;
-                const classObj = { name: nameNode.text, properties: [], methods: [], is_exported: isExported };
+                const classObj = { name: nameNode.text, properties: [], methods: [], is_exported: isExported, start_line: node.startPosition.row + 1, end_line: node.endPosition.row + 1, doc: docComment(node) };
                 results.classes.push(classObj);
                 contextStack.push(classObj);
                 isClassNode = true;
@@ -46,6 +48,10 @@ function extract(tree, config) {
                     return_types: [node.childForFieldName('return_type')?.text || 'Void'],
                     is_exported: isExported,
                     is_method_of: isMethod ? currentContext.name : null,
+                    start_line: node.startPosition.row + 1,
+                    end_line: node.endPosition.row + 1,
+                    doc: docComment(node),
+                    strings: [],
                 };
                 results.functions.push(funcObj);
                 if (isMethod) currentContext.methods.push(funcObj.name);
@@ -70,6 +76,10 @@ function extract(tree, config) {
             if (currentContext && callName) currentContext.calls.push(callName);
         }
 
+        if (isStringLiteral(node)) {
+            addString(contextStack.findLast(c => c.strings), node);
+        }
+
         for (const child of node.children) traverse(child);
 
         if (isClassNode || isFunctionNode) contextStack.pop();
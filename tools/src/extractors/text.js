@@ -0,0 +1,71 @@
+// Helpers shared by the extractors to capture the text that describes what
+// code does: doc comments and string literals. The server indexes both for
+// full-text search.
+
+// Caps on the string literals kept per function.
+const MAX_STRINGS = 20;
+const MAX_STRING_LENGTH = 200;
+
+// Nodes that wrap a declaration, so that its doc comment precedes them.
+const wrapperTypes = new Set([
+    'export_statement', 'decorated_definition', 'template_declaration', 'type_declaration',
+    'variable_declarator', 'lexical_declaration', 'variable_declaration',
+]);
+
+const stringTypes = new Set([
+    'string', 'string_literal', 'interpreted_string_literal', 'raw_string_literal',
+    'template_string', 'line_string_literal', 'multi_line_string_literal',
+]);
+
+// Returns the comments directly above a declaration, without comment markers.
+function docComment(node) {
+    let target = node;
+    while (target.parent && wrapperTypes.has(target.parent.type)) target = target.parent;
+
+    const blocks = [];
+    let row = target.startPosition.row;
+    for (let prev = target.previousSibling; prev && prev.type.includes('comment'); prev = prev.previousSibling) {
+        if (prev.endPosition.row < row - 1) break;
+        blocks.unshift(stripComment(prev.text));
+        row = prev.startPosition.row;
+    }
+    return blocks.join('\n').trim();
+}
+
+// Returns the docstring of a Python function or class.
+function docstring(node) {
+    const first = node.childForFieldName('body')?.firstNamedChild;
+    const str = first?.type === 'expression_statement' ? first.firstNamedChild : null;
+    return str?.type === 'string' ? stringValue(str).trim() : '';
+}
+
+function stripComment(text) {
+    return text
+        .replace(/^\/\*+|\*+\/$/g, '')
+        .split('\n')
+        .map(line => line.replace(/^\s*(\/\/+!?|#+|\*+)\s?/, ''))
+        .join('\n')
+        .trim();
+}
+
+function isStringLiteral(node) {
+    return stringTypes.has(node.type);
+}
+
+// Adds a string literal to a function's strings. Strings without letters,
+// such as separators and format verbs, say nothing about the code.
+function addString(funcObj, node) {
+    if (!funcObj || funcObj.strings.length >= MAX_STRINGS) return;
+    const value = stringValue(node).trim().slice(0, MAX_STRING_LENGTH);
+    if (/[A-Za-z]{2}/.test(value) && value !== funcObj.doc && !funcObj.strings.includes(value)) {
+        funcObj.strings.push(value);
+    }
+}
+
+function stringValue(node) {
+    return node.text
+        .replace(/^[A-Za-z@$]*("""|'''|["'`])/, '')
+        .replace(/("""|'''|["'`])$/, '');
+}
+
+module.exports = { docComment, docstring, isStringLiteral, addString };
@@ -8,6 +8,9 @@ const parser = new Parser();
 // --- Centralized list of directories to completely ignore ---
 const ignoreDirs = new Set(['.git', 'node_modules', 'temp-uploads', 'temp-clones']);
 
+// Git LFS replaces large files with small text pointers starting with this line.
+const lfsPointerHeader = 'version https://git-lfs.github.com/spec/v1';
+
 function analyzeFile(filePath) {
     const extension = path.extname(filePath);
 
@@ -26,6 +29,17 @@ function analyzeFile(filePath) {
 
     try {
         const fileContent = fs.readFileSync(filePath, 'utf8');
+
+        // LFS pointers are not source code; report them instead of parsing them.
+        if (fileContent.startsWith(lfsPointerHeader)) {
+            console.error(`[Processor] Skipping Git LFS pointer file: ${filePath}`);
+            return {
+                path: filePath,
+                language: config.grammar.name,
+                skipped: 'Git LFS pointer file; the real content was not fetched.',
+            };
+        }
+
         parser.setLanguage(config.grammar);
         const tree = parser.parse(fileContent);
         const analysis = config.extractor.extract(tree, config);